@@ -0,0 +1,55 @@
+// Package atomicfile writes files so that readers never see a partial
+// write.
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// WriteJSON writes the JSON encoding of v to a temporary file in the same
+// directory as filename, then renames it into place.  If indent is not
+// empty, the output is indented with it.  The directory is created if
+// it doesn't exist.
+func WriteJSON(filename string, v any, indent string) error {
+	dir := filepath.Dir(filename)
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "*.temp")
+	if err != nil {
+		return err
+	}
+	temp := f.Name()
+
+	encoder := json.NewEncoder(f)
+	if indent != "" {
+		encoder.SetIndent("", indent)
+	}
+	err = encoder.Encode(v)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(temp)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	err = os.Rename(temp, filename)
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sub", "test.json")
+
+	for _, indent := range []string{"", "    "} {
+		v := map[string]int{"a": 1, "b": 2}
+		err := WriteJSON(filename, v, indent)
+		if err != nil {
+			t.Fatalf("WriteJSON: %v", err)
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		var w map[string]int
+		err = json.Unmarshal(data, &w)
+		if err != nil || len(w) != 2 || w["a"] != 1 || w["b"] != 2 {
+			t.Errorf("Got %v (%v), expected %v", w, err, v)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("ReadDir: got %v %v", entries, err)
+	}
+
+	err = WriteJSON(filename, func() {}, "")
+	if err == nil {
+		t.Errorf("WriteJSON succeeded on unencodable value")
+	}
+	entries, err = os.ReadDir(filepath.Dir(filename))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Temporary file not removed: %v %v", entries, err)
+	}
+}
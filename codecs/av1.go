@@ -0,0 +1,322 @@
+package codecs
+
+import (
+	"errors"
+
+	"github.com/pion/rtp"
+)
+
+const av1ObuSequenceHeader = 1
+
+// av1SequenceHeaderOBU returns the first OBU of an AV1 RTP payload if it
+// is a sequence header, as well as the offset of its payload.
+func av1SequenceHeaderOBU(payload []byte) ([]byte, int, error) {
+	if len(payload) < 2 {
+		return nil, 0, errTruncated
+	}
+	// Z=0
+	if (payload[0] & 0x80) != 0 {
+		return nil, 0, errors.New("continuation OBU")
+	}
+	w := (payload[0] & 0x30) >> 4
+	obu := payload[1:]
+	if w != 1 {
+		length := 0
+		i := 0
+		for {
+			if i >= len(obu) || i >= 8 {
+				return nil, 0, errTruncated
+			}
+			length |= int(obu[i]&0x7f) << (i * 7)
+			i++
+			if (obu[i-1] & 0x80) == 0 {
+				break
+			}
+		}
+		if len(obu) < i+length {
+			return nil, 0, errTruncated
+		}
+		obu = obu[i : i+length]
+	}
+
+	if len(obu) < 1 {
+		return nil, 0, errTruncated
+	}
+	if (obu[0]&0x78)>>3 != av1ObuSequenceHeader {
+		return nil, 0, errors.New("not a sequence header")
+	}
+	offset := 1
+	if (obu[0] & 0x04) != 0 {
+		// obu_extension_flag
+		offset++
+	}
+	if (obu[0] & 0x02) != 0 {
+		// obu_has_size_field
+		for {
+			if offset >= len(obu) {
+				return nil, 0, errTruncated
+			}
+			offset++
+			if (obu[offset-1] & 0x80) == 0 {
+				break
+			}
+		}
+	}
+	if offset > len(obu) {
+		return nil, 0, errTruncated
+	}
+	return obu, offset, nil
+}
+
+type av1SequenceHeader struct {
+	profile              uint8
+	level                uint8
+	tier                 uint8
+	highBitdepth         bool
+	twelveBit            bool
+	monochrome           bool
+	subsamplingX         bool
+	subsamplingY         bool
+	chromaSamplePosition uint8
+	maxWidth, maxHeight  uint32
+}
+
+// uvlc reads a variable length unsigned integer as defined in the AV1
+// specification.
+func (r *bitReader) uvlc() (uint32, error) {
+	zeroes := 0
+	for {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			break
+		}
+		zeroes++
+	}
+	if zeroes >= 32 {
+		return (1 << 32) - 1, nil
+	}
+	v, err := r.bits(zeroes)
+	if err != nil {
+		return 0, err
+	}
+	return v + (1 << zeroes) - 1, nil
+}
+
+// parseAV1SequenceHeader parses the payload of a sequence header OBU, as
+// defined in Section 5.5 of the AV1 specification.
+func parseAV1SequenceHeader(data []byte) (av1SequenceHeader, error) {
+	var h av1SequenceHeader
+	r := bitReader{data: data}
+	var err error
+
+	// read returns the next n bits, and records the first error
+	read := func(n int) uint32 {
+		if err != nil {
+			return 0
+		}
+		var v uint32
+		v, err = r.bits(n)
+		return v
+	}
+	flag := func() bool {
+		return read(1) != 0
+	}
+
+	h.profile = uint8(read(3))
+	read(1) // still_picture
+	reduced := flag()
+	if reduced {
+		h.level = uint8(read(5))
+	} else {
+		decoderModelInfo := false
+		bufferDelayLength := 0
+		if flag() {
+			// timing_info
+			read(32)
+			read(32)
+			if flag() {
+				if err == nil {
+					_, err = r.uvlc()
+				}
+			}
+			decoderModelInfo = flag()
+			if decoderModelInfo {
+				bufferDelayLength = int(read(5)) + 1
+				read(32)
+				read(5)
+				read(5)
+			}
+		}
+		initialDisplayDelay := flag()
+		count := int(read(5)) + 1
+		for i := 0; i < count; i++ {
+			read(12) // operating_point_idc
+			level := uint8(read(5))
+			tier := uint8(0)
+			if level > 7 {
+				tier = uint8(read(1))
+			}
+			if i == 0 {
+				h.level = level
+				h.tier = tier
+			}
+			if decoderModelInfo && flag() {
+				read(bufferDelayLength)
+				read(bufferDelayLength)
+				read(1)
+			}
+			if initialDisplayDelay && flag() {
+				read(4)
+			}
+		}
+	}
+
+	widthBits := int(read(4)) + 1
+	heightBits := int(read(4)) + 1
+	h.maxWidth = read(widthBits) + 1
+	h.maxHeight = read(heightBits) + 1
+	if !reduced && flag() {
+		// frame_id_numbers_present_flag
+		read(4)
+		read(3)
+	}
+	// use_128x128_superblock, enable_filter_intra,
+	// enable_intra_edge_filter
+	read(3)
+	if !reduced {
+		// enable_interintra_compound, enable_masked_compound,
+		// enable_warped_motion, enable_dual_filter
+		read(4)
+		orderHint := flag()
+		if orderHint {
+			// enable_jnt_comp, enable_ref_frame_mvs
+			read(2)
+		}
+		forceScreenContentTools := uint32(2)
+		if !flag() {
+			forceScreenContentTools = read(1)
+		}
+		if forceScreenContentTools > 0 {
+			if !flag() {
+				read(1)
+			}
+		}
+		if orderHint {
+			read(3)
+		}
+	}
+	// enable_superres, enable_cdef, enable_restoration
+	read(3)
+
+	// color_config
+	h.highBitdepth = flag()
+	if h.profile == 2 && h.highBitdepth {
+		h.twelveBit = flag()
+	}
+	if h.profile != 1 {
+		h.monochrome = flag()
+	}
+	primaries, transfer, matrix := uint32(2), uint32(2), uint32(2)
+	if flag() {
+		primaries = read(8)
+		transfer = read(8)
+		matrix = read(8)
+	}
+	if h.monochrome {
+		h.subsamplingX = true
+		h.subsamplingY = true
+	} else if primaries == 1 && transfer == 13 && matrix == 0 {
+		// sRGB
+	} else {
+		read(1) // color_range
+		switch h.profile {
+		case 0:
+			h.subsamplingX = true
+			h.subsamplingY = true
+		case 1:
+		default:
+			if h.twelveBit {
+				h.subsamplingX = flag()
+				if h.subsamplingX {
+					h.subsamplingY = flag()
+				}
+			} else {
+				h.subsamplingX = true
+			}
+		}
+		if h.subsamplingX && h.subsamplingY {
+			h.chromaSamplePosition = uint8(read(2))
+		}
+	}
+
+	if err != nil {
+		return av1SequenceHeader{}, err
+	}
+	return h, nil
+}
+
+func av1Dimensions(payload []byte) (uint32, uint32) {
+	obu, offset, err := av1SequenceHeaderOBU(payload)
+	if err != nil {
+		return 0, 0
+	}
+	h, err := parseAV1SequenceHeader(obu[offset:])
+	if err != nil {
+		return 0, 0
+	}
+	return h.maxWidth, h.maxHeight
+}
+
+func boolBit(b bool, shift int) byte {
+	if b {
+		return 1 << shift
+	}
+	return 0
+}
+
+// AV1CodecConfiguration returns the AV1 codec configuration record
+// (av1C), as used in Matroska and ISOBMFF, built from the sequence header
+// carried in the keyframe packet.
+func AV1CodecConfiguration(packet *rtp.Packet) ([]byte, error) {
+	obu, offset, err := av1SequenceHeaderOBU(packet.Payload)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parseAV1SequenceHeader(obu[offset:])
+	if err != nil {
+		return nil, err
+	}
+
+	config := []byte{
+		0x81, // marker, version
+		h.profile<<5 | h.level,
+		h.tier<<7 | boolBit(h.highBitdepth, 6) |
+			boolBit(h.twelveBit, 5) | boolBit(h.monochrome, 4) |
+			boolBit(h.subsamplingX, 3) | boolBit(h.subsamplingY, 2) |
+			h.chromaSamplePosition,
+		0,
+	}
+
+	// the configuration OBUs must carry a size field
+	header := obu[0] | 0x02
+	config = append(config, header)
+	if (obu[0] & 0x04) != 0 {
+		config = append(config, obu[1])
+	}
+	size := len(obu) - offset
+	for {
+		b := byte(size & 0x7f)
+		size >>= 7
+		if size != 0 {
+			config = append(config, b|0x80)
+		} else {
+			config = append(config, b)
+			break
+		}
+	}
+	config = append(config, obu[offset:]...)
+	return config, nil
+}
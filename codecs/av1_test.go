@@ -0,0 +1,104 @@
+package codecs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// makeSequenceHeader returns the payload of an AV1 sequence header OBU
+// for profile 0, 8-bit 4:2:0.
+func makeSequenceHeader(width, height uint32) []byte {
+	var w bitWriter
+	w.bits(0, 3)  // seq_profile
+	w.bits(0, 1)  // still_picture
+	w.bits(0, 1)  // reduced_still_picture_header
+	w.bits(0, 1)  // timing_info_present_flag
+	w.bits(0, 1)  // initial_display_delay_present_flag
+	w.bits(0, 5)  // operating_points_cnt_minus_1
+	w.bits(0, 12) // operating_point_idc
+	w.bits(8, 5)  // seq_level_idx
+	w.bits(0, 1)  // seq_tier
+	w.bits(15, 4) // frame_width_bits_minus_1
+	w.bits(15, 4) // frame_height_bits_minus_1
+	w.bits(width-1, 16)
+	w.bits(height-1, 16)
+	w.bits(0, 1) // frame_id_numbers_present_flag
+	w.bits(0, 3)
+	w.bits(0, 4)
+	w.bits(1, 1) // enable_order_hint
+	w.bits(0, 2)
+	w.bits(1, 1) // seq_choose_screen_content_tools
+	w.bits(1, 1) // seq_choose_integer_mv
+	w.bits(6, 3) // order_hint_bits_minus_1
+	w.bits(0, 3)
+	w.bits(0, 1) // high_bitdepth
+	w.bits(0, 1) // mono_chrome
+	w.bits(0, 1) // color_description_present_flag
+	w.bits(0, 1) // color_range
+	w.bits(1, 2) // chroma_sample_position
+	w.bits(0, 1) // separate_uv_delta_q
+	w.bits(1, 1) // trailing bit
+	return w.data
+}
+
+func TestAV1SequenceHeader(t *testing.T) {
+	sh := makeSequenceHeader(1280, 720)
+	h, err := parseAV1SequenceHeader(sh)
+	if err != nil {
+		t.Fatalf("parseAV1SequenceHeader: %v", err)
+	}
+	if h.maxWidth != 1280 || h.maxHeight != 720 || h.level != 8 ||
+		!h.subsamplingX || !h.subsamplingY ||
+		h.chromaSamplePosition != 1 {
+		t.Errorf("Unexpected sequence header %#v", h)
+	}
+
+	_, err = parseAV1SequenceHeader(sh[:5])
+	if err == nil {
+		t.Errorf("Expected error for truncated sequence header")
+	}
+}
+
+func TestAV1CodecConfiguration(t *testing.T) {
+	sh := makeSequenceHeader(640, 480)
+
+	// W=1, N=1, the OBU has no size field
+	payload := append([]byte{0x18, av1ObuSequenceHeader << 3}, sh...)
+	packet := rtp.Packet{Payload: payload}
+
+	w, h := KeyframeDimensions("video/AV1", &packet)
+	if w != 640 || h != 480 {
+		t.Errorf("Expected 640x480, got %vx%v", w, h)
+	}
+
+	config, err := AV1CodecConfiguration(&packet)
+	if err != nil {
+		t.Fatalf("AV1CodecConfiguration: %v", err)
+	}
+	expected := append(
+		[]byte{0x81, 0x08, 0x0D, 0,
+			av1ObuSequenceHeader<<3 | 0x02, byte(len(sh))},
+		sh...,
+	)
+	if !bytes.Equal(config, expected) {
+		t.Errorf("Expected %v, got %v", expected, config)
+	}
+
+	// W=0, length-prefixed OBU with its own size field
+	obu := append([]byte{av1ObuSequenceHeader<<3 | 0x02, byte(len(sh))},
+		sh...)
+	payload = append([]byte{0x08, byte(len(obu))}, obu...)
+	config2, err := AV1CodecConfiguration(&rtp.Packet{Payload: payload})
+	if err != nil || !bytes.Equal(config2, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, config2, err)
+	}
+
+	_, err = AV1CodecConfiguration(
+		&rtp.Packet{Payload: []byte{0x18, 6 << 3, 0x10}},
+	)
+	if err == nil {
+		t.Errorf("Expected error for frame OBU")
+	}
+}
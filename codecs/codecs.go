@@ -180,6 +180,8 @@ func Keyframe(codec string, packet *rtp.Packet) (bool, bool) {
 			return (packet.Payload[1]&0x1F == 7), true
 		}
 		return false, false
+	} else if strings.EqualFold(codec, "video/h265") {
+		return h265Keyframe(packet.Payload)
 	}
 	return false, false
 }
@@ -225,6 +227,16 @@ func KeyframeDimensions(codec string, packet *rtp.Packet) (uint32, uint32) {
 			}
 		}
 		return w, h
+	} else if strings.EqualFold(codec, "video/h265") {
+		if packet == nil {
+			return 0, 0
+		}
+		return h265Dimensions(packet.Payload)
+	} else if strings.EqualFold(codec, "video/av1") {
+		if packet == nil {
+			return 0, 0
+		}
+		return av1Dimensions(packet.Payload)
 	} else {
 		return 0, 0
 	}
@@ -245,7 +257,9 @@ type Flags struct {
 	Discardable     bool
 }
 
-func PacketFlags(codec string, buf []byte) (Flags, error) {
+// HeaderFlags returns the flags that can be determined from the RTP
+// header alone, which is all we can do when the payload is encrypted.
+func HeaderFlags(buf []byte) (Flags, error) {
 	if len(buf) < 4 {
 		return Flags{}, errTruncated
 	}
@@ -254,6 +268,14 @@ func PacketFlags(codec string, buf []byte) (Flags, error) {
 
 	flags.Seqno = (uint16(buf[2]) << 8) | uint16(buf[3])
 	flags.Marker = (buf[1] & 0x80) != 0
+	return flags, nil
+}
+
+func PacketFlags(codec string, buf []byte) (Flags, error) {
+	flags, err := HeaderFlags(buf)
+	if err != nil {
+		return flags, err
+	}
 
 	if strings.EqualFold(codec, "video/vp8") {
 		var packet rtp.Packet
@@ -304,6 +326,16 @@ func PacketFlags(codec string, buf []byte) (Flags, error) {
 		flags.SidUpSync = flags.Keyframe || !vp9.P
 		flags.SidNonReference = (packet.Payload[0] & 0x01) != 0
 		return flags, nil
+	} else if strings.EqualFold(codec, "video/h264") ||
+		strings.EqualFold(codec, "video/h265") ||
+		strings.EqualFold(codec, "video/av1") {
+		var packet rtp.Packet
+		err := packet.Unmarshal(buf)
+		if err != nil {
+			return flags, err
+		}
+		flags.Keyframe, _ = Keyframe(codec, &packet)
+		return flags, nil
 	}
 	return flags, nil
 }
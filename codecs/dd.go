@@ -0,0 +1,314 @@
+package codecs
+
+import (
+	"errors"
+)
+
+// DependencyDescriptorURI is the URI of the AV1 Dependency Descriptor
+// RTP header extension.
+const DependencyDescriptorURI = "https://aomedia.org/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
+
+// Decode target indications, as defined in the AV1 RTP specification.
+const (
+	DTINotPresent  = 0
+	DTIDiscardable = 1
+	DTISwitch      = 2
+	DTIRequired    = 3
+)
+
+var errNoStructure = errors.New("no dependency structure")
+
+// A DependencyTemplate is a frame dependency template.
+type DependencyTemplate struct {
+	Sid, Tid uint8
+	DTIs     []uint8
+}
+
+// A DependencyStructure is the template dependency structure carried
+// in some dependency descriptors, typically on keyframes.
+type DependencyStructure struct {
+	TemplateIdOffset uint8
+	DecodeTargets    int
+	Chains           int
+	Templates        []DependencyTemplate
+	// the spatial and temporal layers of each decode target
+	TargetSid, TargetTid []uint8
+}
+
+// A DependencyDescriptor is a parsed dependency descriptor.
+type DependencyDescriptor struct {
+	Start, End  bool
+	TemplateId  uint8
+	FrameNumber uint16
+	Sid, Tid    uint8
+	DTIs        []uint8
+	// the new dependency structure, nil if none was attached
+	Structure *DependencyStructure
+}
+
+// ns reads a non-symmetric unsigned integer with n possible values.
+func (r *bitReader) ns(n uint32) (uint32, error) {
+	w := 0
+	for x := n; x != 0; x >>= 1 {
+		w++
+	}
+	m := (uint32(1) << w) - n
+	v, err := r.bits(w - 1)
+	if err != nil {
+		return 0, err
+	}
+	if v < m {
+		return v, nil
+	}
+	extra, err := r.bit()
+	if err != nil {
+		return 0, err
+	}
+	return (v << 1) - m + extra, nil
+}
+
+func parseDependencyStructure(r *bitReader) (*DependencyStructure, error) {
+	var s DependencyStructure
+
+	offset, err := r.bits(6)
+	if err != nil {
+		return nil, err
+	}
+	s.TemplateIdOffset = uint8(offset)
+	count, err := r.bits(5)
+	if err != nil {
+		return nil, err
+	}
+	s.DecodeTargets = int(count) + 1
+
+	// template_layers
+	var sid, tid uint8
+	for {
+		if len(s.Templates) >= 64 {
+			return nil, errors.New("too many templates")
+		}
+		s.Templates = append(s.Templates,
+			DependencyTemplate{Sid: sid, Tid: tid},
+		)
+		next, err := r.bits(2)
+		if err != nil {
+			return nil, err
+		}
+		if next == 3 {
+			break
+		}
+		switch next {
+		case 1:
+			tid++
+		case 2:
+			tid = 0
+			sid++
+		}
+	}
+	maxSid := sid
+
+	// template_dtis
+	for i := range s.Templates {
+		dtis := make([]uint8, s.DecodeTargets)
+		for j := range dtis {
+			v, err := r.bits(2)
+			if err != nil {
+				return nil, err
+			}
+			dtis[j] = uint8(v)
+		}
+		s.Templates[i].DTIs = dtis
+	}
+
+	// template_fdiffs
+	for range s.Templates {
+		for {
+			follows, err := r.bit()
+			if err != nil {
+				return nil, err
+			}
+			if follows == 0 {
+				break
+			}
+			err = r.skip(4)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// template_chains
+	chains, err := r.ns(uint32(s.DecodeTargets) + 1)
+	if err != nil {
+		return nil, err
+	}
+	s.Chains = int(chains)
+	if chains != 0 {
+		for i := 0; i < s.DecodeTargets; i++ {
+			_, err := r.ns(chains)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = r.skip(4 * len(s.Templates) * int(chains))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// decode_target_layers
+	s.TargetSid = make([]uint8, s.DecodeTargets)
+	s.TargetTid = make([]uint8, s.DecodeTargets)
+	for i := 0; i < s.DecodeTargets; i++ {
+		for _, t := range s.Templates {
+			if t.DTIs[i] == DTINotPresent {
+				continue
+			}
+			if t.Sid > s.TargetSid[i] {
+				s.TargetSid[i] = t.Sid
+			}
+			if t.Tid > s.TargetTid[i] {
+				s.TargetTid[i] = t.Tid
+			}
+		}
+	}
+
+	resolutions, err := r.bit()
+	if err != nil {
+		return nil, err
+	}
+	if resolutions != 0 {
+		err = r.skip(32 * (int(maxSid) + 1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// ParseDependencyDescriptor parses the value of a Dependency Descriptor
+// header extension.  Since most descriptors refer to a dependency
+// structure sent earlier, the caller must pass the most recent structure
+// received on the stream, if any.
+func ParseDependencyDescriptor(data []byte, structure *DependencyStructure) (DependencyDescriptor, error) {
+	var d DependencyDescriptor
+	if len(data) < 3 {
+		return d, errTruncated
+	}
+	d.Start = (data[0] & 0x80) != 0
+	d.End = (data[0] & 0x40) != 0
+	d.TemplateId = data[0] & 0x3F
+	d.FrameNumber = uint16(data[1])<<8 | uint16(data[2])
+
+	r := bitReader{data: data, offset: 24}
+	var customDTIs, customFdiffs, customChains bool
+	if len(data) > 3 {
+		var f [5]bool
+		for i := range f {
+			v, err := r.bit()
+			if err != nil {
+				return d, err
+			}
+			f[i] = v != 0
+		}
+		customDTIs, customFdiffs, customChains = f[2], f[3], f[4]
+		if f[0] {
+			s, err := parseDependencyStructure(&r)
+			if err != nil {
+				return d, err
+			}
+			d.Structure = s
+			structure = s
+		}
+		if f[1] {
+			if structure == nil {
+				return d, errNoStructure
+			}
+			// active_decode_targets_bitmask
+			err := r.skip(structure.DecodeTargets)
+			if err != nil {
+				return d, err
+			}
+		}
+	}
+
+	if structure == nil {
+		return d, errNoStructure
+	}
+	index := (int(d.TemplateId) + 64 - int(structure.TemplateIdOffset)) % 64
+	if index >= len(structure.Templates) {
+		return d, errors.New("unknown frame dependency template")
+	}
+	template := structure.Templates[index]
+	d.Sid = template.Sid
+	d.Tid = template.Tid
+
+	if customDTIs {
+		d.DTIs = make([]uint8, structure.DecodeTargets)
+		for i := range d.DTIs {
+			v, err := r.bits(2)
+			if err != nil {
+				return d, err
+			}
+			d.DTIs[i] = uint8(v)
+		}
+	} else {
+		d.DTIs = template.DTIs
+	}
+
+	if customFdiffs {
+		for {
+			size, err := r.bits(2)
+			if err != nil {
+				return d, err
+			}
+			if size == 0 {
+				break
+			}
+			err = r.skip(4 * int(size))
+			if err != nil {
+				return d, err
+			}
+		}
+	}
+
+	if customChains {
+		err := r.skip(8 * structure.Chains)
+		if err != nil {
+			return d, err
+		}
+	}
+
+	return d, nil
+}
+
+// SetFlags sets the layer-related fields of flags from the dependency
+// descriptor d, which was parsed using the dependency structure s.
+func (d *DependencyDescriptor) SetFlags(flags *Flags, s *DependencyStructure) {
+	flags.Start = d.Start
+	flags.End = d.End
+	flags.Sid = d.Sid
+	flags.Tid = d.Tid
+	flags.TidUpSync = flags.Keyframe
+	flags.SidUpSync = flags.Keyframe
+	flags.SidNonReference = true
+	flags.Discardable = true
+	for i, dti := range d.DTIs {
+		if i >= len(s.TargetSid) {
+			break
+		}
+		if dti == DTISwitch &&
+			s.TargetSid[i] == d.Sid && s.TargetTid[i] == d.Tid {
+			flags.TidUpSync = true
+		}
+		if dti == DTISwitch && s.TargetSid[i] == d.Sid {
+			flags.SidUpSync = true
+		}
+		if dti != DTINotPresent && s.TargetSid[i] > d.Sid {
+			flags.SidNonReference = false
+		}
+		if dti == DTISwitch || dti == DTIRequired {
+			flags.Discardable = false
+		}
+	}
+}
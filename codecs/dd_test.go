@@ -0,0 +1,124 @@
+package codecs
+
+import (
+	"testing"
+)
+
+// makeDependencyDescriptor returns a dependency descriptor for an L1T3
+// stream with four templates, optionally including the structure.
+func makeDependencyDescriptor(templateId uint8, structure bool) []byte {
+	var w bitWriter
+	w.bits(1, 1) // start_of_frame
+	w.bits(1, 1) // end_of_frame
+	w.bits(uint32(templateId), 6)
+	w.bits(42, 16) // frame_number
+	if !structure {
+		return w.data
+	}
+	w.bits(1, 1) // template_dependency_structure_present_flag
+	w.bits(0, 4)
+
+	w.bits(0, 6) // template_id_offset
+	w.bits(2, 5) // dt_cnt_minus_one
+	// template_layers: (0, 0), (0, 0), (0, 1), (0, 2)
+	for _, next := range []uint32{0, 1, 1, 3} {
+		w.bits(next, 2)
+	}
+	dtis := [][]uint32{
+		{DTISwitch, DTISwitch, DTISwitch},
+		{DTISwitch, DTISwitch, DTISwitch},
+		{DTINotPresent, DTISwitch, DTIRequired},
+		{DTINotPresent, DTINotPresent, DTIDiscardable},
+	}
+	for _, d := range dtis {
+		for _, v := range d {
+			w.bits(v, 2)
+		}
+	}
+	// template_fdiffs
+	w.bits(0, 1)
+	for i := 0; i < 3; i++ {
+		w.bits(1, 1)
+		w.bits(uint32(i), 4)
+		w.bits(0, 1)
+	}
+	// template_chains: one chain
+	w.bits(1, 2)
+	for i := 0; i < 4; i++ {
+		w.bits(uint32(i), 4)
+	}
+	w.bits(1, 1) // resolutions_present_flag
+	w.bits(639, 16)
+	w.bits(479, 16)
+	return w.data
+}
+
+func TestDependencyDescriptor(t *testing.T) {
+	d, err := ParseDependencyDescriptor(
+		makeDependencyDescriptor(0, true), nil,
+	)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	s := d.Structure
+	if s == nil || s.DecodeTargets != 3 || len(s.Templates) != 4 ||
+		s.Chains != 1 {
+		t.Fatalf("Unexpected structure %#v", s)
+	}
+	for i, tid := range []uint8{0, 1, 2} {
+		if s.TargetSid[i] != 0 || s.TargetTid[i] != tid {
+			t.Errorf("Target %v: got %v %v", i,
+				s.TargetSid[i], s.TargetTid[i])
+		}
+	}
+	if !d.Start || !d.End || d.FrameNumber != 42 || d.Tid != 0 {
+		t.Errorf("Unexpected descriptor %#v", d)
+	}
+
+	tests := []struct {
+		template                      uint8
+		tid                           uint8
+		tidUpSync, discardable, error bool
+	}{
+		{1, 0, true, false, false},
+		{2, 1, true, false, false},
+		{3, 2, false, true, false},
+		{4, 0, false, false, true},
+	}
+	for _, test := range tests {
+		d, err := ParseDependencyDescriptor(
+			makeDependencyDescriptor(test.template, false), s,
+		)
+		if test.error {
+			if err == nil {
+				t.Errorf("Template %v: expected error",
+					test.template)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Template %v: %v", test.template, err)
+			continue
+		}
+		var flags Flags
+		d.SetFlags(&flags, s)
+		if flags.Tid != test.tid || flags.Sid != 0 ||
+			flags.TidUpSync != test.tidUpSync ||
+			flags.Discardable != test.discardable ||
+			!flags.Start || !flags.End {
+			t.Errorf("Template %v: got %#v", test.template, flags)
+		}
+	}
+
+	_, err = ParseDependencyDescriptor(
+		makeDependencyDescriptor(1, false), nil,
+	)
+	if err == nil {
+		t.Errorf("Expected error without structure")
+	}
+
+	_, err = ParseDependencyDescriptor([]byte{0x80, 0}, s)
+	if err == nil {
+		t.Errorf("Expected error for truncated descriptor")
+	}
+}
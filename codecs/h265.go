@@ -0,0 +1,292 @@
+package codecs
+
+import (
+	"errors"
+)
+
+const (
+	h265NaluIDRWRADL = 19
+	h265NaluIDRNLP   = 20
+	h265NaluCRA      = 21
+	h265NaluVPS      = 32
+	h265NaluSPS      = 33
+	h265NaluAP       = 48
+	h265NaluFU       = 49
+)
+
+// h265Units calls f for each NAL unit in an H.265 RTP payload (RFC 7798).
+// For fragmentation units, f is only called for the first fragment.
+// The nal argument to f excludes the two-byte NAL unit header, and may
+// be truncated.  Iteration stops when f returns false.  h265Units returns
+// false if the payload could not be parsed.  We assume that DONL is not
+// in use.
+func h265Units(payload []byte, f func(tpe uint8, nal []byte) bool) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	tpe := (payload[0] >> 1) & 0x3F
+	switch {
+	case tpe < h265NaluAP:
+		f(tpe, payload[2:])
+		return true
+	case tpe == h265NaluAP:
+		i := 2
+		for i < len(payload) {
+			if i+2 > len(payload) {
+				return false
+			}
+			length := int(payload[i])<<8 | int(payload[i+1])
+			i += 2
+			if length < 2 || i+length > len(payload) {
+				return false
+			}
+			t := (payload[i] >> 1) & 0x3F
+			if !f(t, payload[i+2:i+length]) {
+				return true
+			}
+			i += length
+		}
+		return true
+	case tpe == h265NaluFU:
+		if len(payload) < 3 {
+			return false
+		}
+		if (payload[2] & 0x80) != 0 {
+			f(payload[2]&0x3F, payload[3:])
+		}
+		return true
+	default:
+		// PACI or reserved
+		return false
+	}
+}
+
+// h265Keyframe returns true if an H.265 payload starts a keyframe, which
+// we define as containing a VPS, an SPS or the start of an IRAP picture
+// (IDR_W_RADL, IDR_N_LP or CRA).
+func h265Keyframe(payload []byte) (bool, bool) {
+	found := false
+	ok := h265Units(payload, func(tpe uint8, nal []byte) bool {
+		switch tpe {
+		case h265NaluVPS, h265NaluSPS,
+			h265NaluIDRWRADL, h265NaluIDRNLP, h265NaluCRA:
+			found = true
+			return false
+		}
+		return true
+	})
+	if found {
+		return true, true
+	}
+	return false, ok
+}
+
+// h265Dimensions returns the dimensions of the picture described by the
+// first SPS found in an H.265 payload, or (0, 0) if none was found.
+func h265Dimensions(payload []byte) (uint32, uint32) {
+	var width, height uint32
+	h265Units(payload, func(tpe uint8, nal []byte) bool {
+		if tpe != h265NaluSPS {
+			return true
+		}
+		w, h, err := h265SPSDimensions(nal)
+		if err == nil {
+			width, height = w, h
+		}
+		return false
+	})
+	return width, height
+}
+
+// unescapeRBSP removes emulation prevention bytes.
+func unescapeRBSP(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	zeroes := 0
+	for _, b := range data {
+		if zeroes >= 2 && b == 3 {
+			zeroes = 0
+			continue
+		}
+		if b == 0 {
+			zeroes++
+		} else {
+			zeroes = 0
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+type bitReader struct {
+	data   []byte
+	offset int
+}
+
+var errBitReader = errors.New("read beyond end of data")
+
+func (r *bitReader) bit() (uint32, error) {
+	if r.offset >= len(r.data)*8 {
+		return 0, errBitReader
+	}
+	b := (r.data[r.offset/8] >> (7 - r.offset%8)) & 1
+	r.offset++
+	return uint32(b), nil
+}
+
+func (r *bitReader) bits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = (v << 1) | b
+	}
+	return v, nil
+}
+
+func (r *bitReader) skip(n int) error {
+	if r.offset+n > len(r.data)*8 {
+		return errBitReader
+	}
+	r.offset += n
+	return nil
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() (uint32, error) {
+	zeroes := 0
+	for {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			break
+		}
+		zeroes++
+		if zeroes > 31 {
+			return 0, errors.New("Exp-Golomb code too long")
+		}
+	}
+	v, err := r.bits(zeroes)
+	if err != nil {
+		return 0, err
+	}
+	return (1 << zeroes) - 1 + v, nil
+}
+
+// h265SPSDimensions parses an H.265 SPS, without its NAL unit header, and
+// returns the dimensions of the picture after applying the conformance
+// window.
+func h265SPSDimensions(nal []byte) (uint32, uint32, error) {
+	r := bitReader{data: unescapeRBSP(nal)}
+
+	// sps_video_parameter_set_id
+	err := r.skip(4)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxSubLayersMinus1, err := r.bits(3)
+	if err != nil {
+		return 0, 0, err
+	}
+	// sps_temporal_id_nesting_flag
+	err = r.skip(1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// profile_tier_level: general profile and level
+	err = r.skip(96)
+	if err != nil {
+		return 0, 0, err
+	}
+	var profilePresent, levelPresent [8]bool
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		p, err := r.bit()
+		if err != nil {
+			return 0, 0, err
+		}
+		l, err := r.bit()
+		if err != nil {
+			return 0, 0, err
+		}
+		profilePresent[i] = p != 0
+		levelPresent[i] = l != 0
+	}
+	if maxSubLayersMinus1 > 0 {
+		err = r.skip(2 * (8 - int(maxSubLayersMinus1)))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	for i := 0; i < int(maxSubLayersMinus1); i++ {
+		if profilePresent[i] {
+			err = r.skip(88)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		if levelPresent[i] {
+			err = r.skip(8)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	// sps_seq_parameter_set_id
+	_, err = r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	chromaFormat, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	if chromaFormat == 3 {
+		// separate_colour_plane_flag
+		err = r.skip(1)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	width, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := r.ue()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	window, err := r.bit()
+	if err != nil {
+		return 0, 0, err
+	}
+	if window != 0 {
+		var offsets [4]uint32
+		for i := range offsets {
+			offsets[i], err = r.ue()
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		subWidth, subHeight := uint32(1), uint32(1)
+		switch chromaFormat {
+		case 1:
+			subWidth, subHeight = 2, 2
+		case 2:
+			subWidth = 2
+		}
+		w := subWidth * (offsets[0] + offsets[1])
+		h := subHeight * (offsets[2] + offsets[3])
+		if w >= width || h >= height {
+			return 0, 0, errors.New("bad conformance window")
+		}
+		width -= w
+		height -= h
+	}
+	return width, height, nil
+}
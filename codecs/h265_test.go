@@ -0,0 +1,184 @@
+package codecs
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+type bitWriter struct {
+	data   []byte
+	offset int
+}
+
+func (w *bitWriter) bits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.offset%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if (v>>i)&1 != 0 {
+			w.data[len(w.data)-1] |= 1 << (7 - w.offset%8)
+		}
+		w.offset++
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for (v >> n) > 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// escape inserts emulation prevention bytes.
+func escape(data []byte) []byte {
+	var result []byte
+	zeroes := 0
+	for _, b := range data {
+		if zeroes >= 2 && b <= 3 {
+			result = append(result, 3)
+			zeroes = 0
+		}
+		if b == 0 {
+			zeroes++
+		} else {
+			zeroes = 0
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// makeSPS returns an H.265 SPS NAL unit, including its header.
+func makeSPS(width, height, bottom uint32, subLayers uint32) []byte {
+	var w bitWriter
+	w.bits(0, 4)           // sps_video_parameter_set_id
+	w.bits(subLayers-1, 3) // sps_max_sub_layers_minus1
+	w.bits(1, 1)           // sps_temporal_id_nesting_flag
+	w.bits(1, 8)           // profile space, tier, profile_idc
+	w.bits(0x60000000, 32) // compatibility flags
+	w.bits(0, 48)          // constraint flags
+	w.bits(93, 8)          // general_level_idc
+	for i := uint32(0); i < subLayers-1; i++ {
+		w.bits(0, 1) // sub_layer_profile_present_flag
+		w.bits(1, 1) // sub_layer_level_present_flag
+	}
+	if subLayers > 1 {
+		for i := subLayers - 1; i < 8; i++ {
+			w.bits(0, 2)
+		}
+	}
+	for i := uint32(0); i < subLayers-1; i++ {
+		w.bits(90, 8) // sub_layer_level_idc
+	}
+	w.ue(0) // sps_seq_parameter_set_id
+	w.ue(1) // chroma_format_idc
+	w.ue(width)
+	w.ue(height)
+	if bottom != 0 {
+		w.bits(1, 1)
+		w.ue(0)
+		w.ue(0)
+		w.ue(0)
+		w.ue(bottom)
+	} else {
+		w.bits(0, 1)
+	}
+	w.bits(0x1F, 8) // garbage
+	return append([]byte{h265NaluSPS << 1, 1}, escape(w.data)...)
+}
+
+func TestH265SPS(t *testing.T) {
+	sps := makeSPS(1920, 1088, 4, 1)
+	w, h, err := h265SPSDimensions(sps[2:])
+	if err != nil || w != 1920 || h != 1080 {
+		t.Errorf("Expected 1920x1080, got %vx%v (%v)", w, h, err)
+	}
+
+	sps = makeSPS(640, 480, 0, 3)
+	w, h, err = h265SPSDimensions(sps[2:])
+	if err != nil || w != 640 || h != 480 {
+		t.Errorf("Expected 640x480, got %vx%v (%v)", w, h, err)
+	}
+
+	_, _, err = h265SPSDimensions(sps[2:8])
+	if err == nil {
+		t.Errorf("Expected error for truncated SPS")
+	}
+}
+
+func TestH265Keyframe(t *testing.T) {
+	vps := []byte{h265NaluVPS << 1, 1, 0x0c, 0x01}
+	sps := makeSPS(1280, 720, 0, 1)
+	pps := []byte{34 << 1, 1, 0xc1}
+	idr := []byte{h265NaluIDRWRADL << 1, 1, 0xaf, 0x00}
+	idrnlp := []byte{h265NaluIDRNLP << 1, 1, 0xaf, 0x00}
+	cra := []byte{h265NaluCRA << 1, 1, 0xaf, 0x00}
+	bla := []byte{16 << 1, 1, 0xaf, 0x00}
+	trail := []byte{1 << 1, 1, 0xaa}
+
+	ap := []byte{h265NaluAP << 1, 1}
+	for _, n := range [][]byte{vps, sps, pps} {
+		ap = append(ap, byte(len(n)>>8), byte(len(n)))
+		ap = append(ap, n...)
+	}
+
+	fu := func(tpe uint8, start bool) []byte {
+		h := tpe
+		if start {
+			h |= 0x80
+		}
+		return []byte{h265NaluFU << 1, 1, h, 0xaa, 0xbb}
+	}
+
+	tests := []struct {
+		payload       []byte
+		kf, known     bool
+		width, height uint32
+	}{
+		{ap, true, true, 1280, 720},
+		{sps, true, true, 1280, 720},
+		{vps, true, true, 0, 0},
+		{idr, true, true, 0, 0},
+		{idrnlp, true, true, 0, 0},
+		{cra, true, true, 0, 0},
+		{bla, false, true, 0, 0},
+		{trail, false, true, 0, 0},
+		{fu(h265NaluSPS, true), true, true, 0, 0},
+		{fu(h265NaluSPS, false), false, true, 0, 0},
+		{fu(h265NaluIDRWRADL, true), true, true, 0, 0},
+		{fu(h265NaluCRA, true), true, true, 0, 0},
+		{fu(h265NaluIDRWRADL, false), false, true, 0, 0},
+		{ap[:5], false, false, 0, 0},
+		{[]byte{50 << 1, 1, 0, 0}, false, false, 0, 0},
+	}
+
+	for i, test := range tests {
+		packet := rtp.Packet{Payload: test.payload}
+		kf, known := Keyframe("video/H265", &packet)
+		if kf != test.kf || known != test.known {
+			t.Errorf("Keyframe(%v): got %v %v, expected %v %v",
+				i, kf, known, test.kf, test.known)
+		}
+		w, h := KeyframeDimensions("video/H265", &packet)
+		if w != test.width || h != test.height {
+			t.Errorf("Dimensions(%v): got %vx%v, expected %vx%v",
+				i, w, h, test.width, test.height)
+		}
+	}
+
+	buf, err := (&rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: 42},
+		Payload: ap,
+	}).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	flags, err := PacketFlags("video/H265", buf)
+	if err != nil || !flags.Keyframe || flags.Seqno != 42 {
+		t.Errorf("PacketFlags: got %v (%v)", flags, err)
+	}
+}
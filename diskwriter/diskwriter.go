@@ -3,6 +3,7 @@ package diskwriter
 import (
 	crand "crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -39,9 +40,12 @@ type Client struct {
 	group *group.Group
 	id    string
 
-	mu     sync.Mutex
-	down   map[string]*diskConn
-	closed bool
+	mu        sync.Mutex
+	down      map[string]*diskConn
+	usernames map[string]string
+	speaker   string
+	speakers  *os.File
+	closed    bool
 }
 
 func newId() string {
@@ -83,9 +87,81 @@ func (client *Client) Data() map[string]interface{} {
 }
 
 func (client *Client) PushClient(group, kind, id, username string, perms []string, data map[string]interface{}) error {
+	if group != client.group.Name() {
+		return nil
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.closed {
+		return nil
+	}
+
+	switch kind {
+	case "add", "change":
+		if client.usernames == nil {
+			client.usernames = make(map[string]string)
+		}
+		client.usernames[id] = username
+		// the dominant speaker was known before we joined
+		if kind == "add" && client.speaker == "" &&
+			id == client.group.ActiveSpeaker() {
+			return client.setSpeaker(id)
+		}
+	case "delete":
+		delete(client.usernames, id)
+	}
 	return nil
 }
 
+type speakerEntry struct {
+	Time     time.Time `json:"time"`
+	Id       string    `json:"id,omitempty"`
+	Username string    `json:"username,omitempty"`
+}
+
+// setSpeaker records a change of dominant speaker in a file next to the
+// recordings, so that they can be matched with the speaker.
+// Called locked.
+func (client *Client) setSpeaker(id string) error {
+	if id == client.speaker {
+		return nil
+	}
+	if client.speakers == nil {
+		directory := filepath.Join(Directory, client.group.Name())
+		err := os.MkdirAll(directory, 0700)
+		if err != nil {
+			return err
+		}
+		f, err := openDiskFile(directory, "speakers", "jsonl")
+		if err != nil {
+			return err
+		}
+		client.speakers = f
+	}
+	client.speaker = id
+	return json.NewEncoder(client.speakers).Encode(speakerEntry{
+		Time:     time.Now(),
+		Id:       id,
+		Username: client.usernames[id],
+	})
+}
+
+func (client *Client) ActiveSpeaker(group, id string) error {
+	if group != client.group.Name() {
+		return nil
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.closed {
+		return nil
+	}
+	return client.setSpeaker(id)
+}
+
 func (client *Client) RequestConns(target group.Client, g *group.Group, id string) error {
 	return nil
 }
@@ -99,6 +175,11 @@ func (client *Client) Close() error {
 	}
 	client.down = nil
 	client.closed = true
+	if client.speakers != nil {
+		err := client.speakers.Close()
+		client.speakers = nil
+		return err
+	}
 	return nil
 }
 
@@ -148,6 +229,10 @@ func (client *Client) PushConn(g *group.Group, id string, up conn.Up, tracks []c
 		return nil
 	}
 
+	if g.Description().E2EE {
+		return errors.New("cannot record end-to-end encrypted media")
+	}
+
 	directory := filepath.Join(Directory, client.group.Name())
 	err := os.MkdirAll(directory, 0700)
 	if err != nil {
@@ -326,7 +411,8 @@ func newDiskConn(client *Client, directory string, up conn.Up, remoteTracks []co
 
 	for _, remote := range remoteTracks {
 		codec := remote.Codec().MimeType
-		if strings.EqualFold(codec, "audio/opus") {
+		_, pcm := getWaveFormat(codec)
+		if strings.EqualFold(codec, "audio/opus") || pcm {
 			if audio == nil {
 				audio = remote
 			} else {
@@ -334,7 +420,9 @@ func newDiskConn(client *Client, directory string, up conn.Up, remoteTracks []co
 			}
 		} else if strings.EqualFold(codec, "video/vp8") ||
 			strings.EqualFold(codec, "video/vp9") ||
-			strings.EqualFold(codec, "video/h264") {
+			strings.EqualFold(codec, "video/h264") ||
+			strings.EqualFold(codec, "video/h265") ||
+			strings.EqualFold(codec, "video/av1") {
 			if video == nil || video.Label() == "l" {
 				video = remote
 			} else if remote.Label() != "l" {
@@ -374,6 +462,11 @@ func newDiskConn(client *Client, directory string, up conn.Up, remoteTracks []co
 				audioMaxLate,
 				&codecs.OpusPacket{}, codec.ClockRate,
 			)
+		} else if _, ok := getWaveFormat(codec.MimeType); ok {
+			builder = samplebuilder.New(
+				audioMaxLate,
+				&pcmDepacketizer{}, codec.ClockRate,
+			)
 		} else if strings.EqualFold(codec.MimeType, "video/vp8") {
 			builder = samplebuilder.New(
 				videoMaxLate,
@@ -392,6 +485,18 @@ func newDiskConn(client *Client, directory string, up conn.Up, remoteTracks []co
 				codec.ClockRate,
 			)
 			conn.hasVideo = true
+		} else if strings.EqualFold(codec.MimeType, "video/h265") {
+			builder = samplebuilder.New(
+				videoMaxLate, &codecs.H265Packet{},
+				codec.ClockRate,
+			)
+			conn.hasVideo = true
+		} else if strings.EqualFold(codec.MimeType, "video/av1") {
+			builder = samplebuilder.New(
+				videoMaxLate, &codecs.AV1Depacketizer{},
+				codec.ClockRate,
+			)
+			conn.hasVideo = true
 		} else {
 			// this shouldn't happen
 			return nil, errors.New(
@@ -731,6 +836,17 @@ func (conn *diskConn) initWriter(width, height uint32, track *diskTrack, ts uint
 		}
 	}
 
+	if !conn.hasVideo && len(conn.tracks) == 1 {
+		desc := conn.client.group.Description()
+		format, ok := getWaveFormat(
+			conn.tracks[0].remote.Codec().MimeType,
+		)
+		if desc != nil && desc.WAVRecording && ok &&
+			format.silence >= 0 {
+			return conn.initWavWriter(format, track, ts)
+		}
+	}
+
 	isWebm := true
 	var desc []mkvcore.TrackDescription
 	for i, t := range conn.tracks {
@@ -747,6 +863,21 @@ func (conn *diskConn) initWriter(width, height uint32, track *diskTrack, ts uint
 					Channels:          uint64(codec.Channels),
 				},
 			}
+		} else if format, ok := getWaveFormat(codec.MimeType); ok {
+			entry = webm.TrackEntry{
+				Name:         "Audio",
+				TrackNumber:  uint64(i + 1),
+				CodecID:      "A_MS/ACM",
+				CodecPrivate: format.marshal(),
+				TrackType:    2,
+				Audio: &webm.Audio{
+					SamplingFrequency: float64(
+						format.samplesPerSec,
+					),
+					Channels: uint64(format.channels),
+				},
+			}
+			isWebm = false
 		} else if strings.EqualFold(codec.MimeType, "video/vp8") {
 			entry = webm.TrackEntry{
 				Name:        "Video",
@@ -781,6 +912,37 @@ func (conn *diskConn) initWriter(width, height uint32, track *diskTrack, ts uint
 				},
 			}
 			isWebm = false
+		} else if strings.EqualFold(codec.MimeType, "video/h265") {
+			entry = webm.TrackEntry{
+				Name:        "Video",
+				TrackNumber: uint64(i + 1),
+				CodecID:     "V_MPEGH/ISO/HEVC",
+				TrackType:   1,
+				Video: &webm.Video{
+					PixelWidth:  uint64(width),
+					PixelHeight: uint64(height),
+				},
+			}
+			isWebm = false
+		} else if strings.EqualFold(codec.MimeType, "video/av1") {
+			if t.savedKf == nil {
+				return errors.New("no AV1 sequence header")
+			}
+			config, err := gcodecs.AV1CodecConfiguration(t.savedKf)
+			if err != nil {
+				return err
+			}
+			entry = webm.TrackEntry{
+				Name:         "Video",
+				TrackNumber:  uint64(i + 1),
+				CodecID:      "V_AV1",
+				CodecPrivate: config,
+				TrackType:    1,
+				Video: &webm.Video{
+					PixelWidth:  uint64(width),
+					PixelHeight: uint64(height),
+				},
+			}
 		} else {
 			return errors.New("unknown track type")
 		}
@@ -848,6 +1010,31 @@ func (conn *diskConn) initWriter(width, height uint32, track *diskTrack, ts uint
 	return nil
 }
 
+// initWavWriter creates a WAV file for an audio-only connection.
+// called locked
+func (conn *diskConn) initWavWriter(format waveFormat, track *diskTrack, ts uint32) error {
+	if track != nil {
+		track.adjustOrigin(ts)
+	}
+
+	err := conn.open("wav")
+	if err != nil {
+		return err
+	}
+
+	w, err := newWavWriter(conn.file, format)
+	if err != nil {
+		conn.file.Close()
+		conn.file = nil
+		return err
+	}
+
+	conn.width = 0
+	conn.height = 0
+	conn.tracks[0].writer = w
+	return nil
+}
+
 func (t *diskTrack) GetMaxBitrate() (uint64, int, int) {
 	return ^uint64(0), -1, -1
 }
@@ -1,9 +1,14 @@
 package diskwriter
 
 import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/jech/galene/group"
 	"github.com/jech/galene/rtptime"
 )
 
@@ -171,3 +176,65 @@ func TestAdjustOriginLocalRemote(t *testing.T) {
 		t.Errorf("Expected 132, got %v", value(c.tracks[0].origin))
 	}
 }
+
+func TestSpeakers(t *testing.T) {
+	Directory = t.TempDir()
+	g, err := group.Add("speakers-test", &group.Description{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("speakers-test")
+
+	client := New(g)
+	client.PushClient("speakers-test", "add", "a", "alice", nil, nil)
+	client.PushClient("speakers-test", "add", "b", "bob", nil, nil)
+	client.ActiveSpeaker("other", "b")
+	client.ActiveSpeaker("speakers-test", "a")
+	client.ActiveSpeaker("speakers-test", "a")
+	client.ActiveSpeaker("speakers-test", "b")
+	client.PushClient("speakers-test", "delete", "b", "bob", nil, nil)
+	client.ActiveSpeaker("speakers-test", "")
+	err = client.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	client.ActiveSpeaker("speakers-test", "a")
+
+	files, err := filepath.Glob(
+		filepath.Join(Directory, "speakers-test", "*.jsonl"),
+	)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Glob: %v %v", files, err)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	var entries []speakerEntry
+	decoder := json.NewDecoder(f)
+	for {
+		var e speakerEntry
+		err := decoder.Decode(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	expected := []speakerEntry{{Id: "a", Username: "alice"},
+		{Id: "b", Username: "bob"}, {}}
+	if len(entries) != len(expected) {
+		t.Fatalf("Got %v, expected %v", entries, expected)
+	}
+	for i, e := range entries {
+		if e.Id != expected[i].Id ||
+			e.Username != expected[i].Username || e.Time.IsZero() {
+			t.Errorf("Entry %v: got %v, expected %v",
+				i, e, expected[i])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package diskwriter
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+)
+
+// A waveFormat describes an audio codec in the format of the Windows
+// WAVEFORMATEX structure, which is used both by WAV files and by the
+// A_MS/ACM codec in Matroska.
+type waveFormat struct {
+	tag            uint16
+	channels       uint16
+	samplesPerSec  uint32
+	avgBytesPerSec uint32
+	blockAlign     uint16
+	bitsPerSample  uint16
+	// the value of an encoded sample of silence, or -1 if unknown
+	silence int
+}
+
+// getWaveFormat returns the format of a sample-based audio codec, or
+// false if codec is not supported.
+func getWaveFormat(codec string) (waveFormat, bool) {
+	switch strings.ToLower(codec) {
+	case "audio/pcmu":
+		return waveFormat{7, 1, 8000, 8000, 1, 8, 0xFF}, true
+	case "audio/pcma":
+		return waveFormat{6, 1, 8000, 8000, 1, 8, 0xD5}, true
+	case "audio/g722":
+		// G.722 is sampled at 16kHz, but its RTP clock runs at 8kHz
+		return waveFormat{0x028F, 1, 16000, 8000, 1, 4, -1}, true
+	}
+	return waveFormat{}, false
+}
+
+// marshal returns the 18-byte WAVEFORMATEX structure.
+func (f waveFormat) marshal() []byte {
+	b := make([]byte, 18)
+	binary.LittleEndian.PutUint16(b[0:], f.tag)
+	binary.LittleEndian.PutUint16(b[2:], f.channels)
+	binary.LittleEndian.PutUint32(b[4:], f.samplesPerSec)
+	binary.LittleEndian.PutUint32(b[8:], f.avgBytesPerSec)
+	binary.LittleEndian.PutUint16(b[12:], f.blockAlign)
+	binary.LittleEndian.PutUint16(b[14:], f.bitsPerSample)
+	// cbSize is zero
+	return b
+}
+
+// pcmDepacketizer is a depacketizer for sample-based audio codecs,
+// where every packet can be decoded independently.
+type pcmDepacketizer struct{}
+
+func (d *pcmDepacketizer) Unmarshal(packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, errors.New("empty packet")
+	}
+	return packet, nil
+}
+
+func (d *pcmDepacketizer) IsPartitionHead(payload []byte) bool {
+	return true
+}
+
+func (d *pcmDepacketizer) IsPartitionTail(marker bool, payload []byte) bool {
+	return true
+}
+
+const wavHeaderSize = 46
+
+// A wavWriter writes a single audio track to a WAV file.  It implements
+// the same interface as the Matroska block writers.  Since WAV files
+// have no timestamps, gaps are filled with silence.
+type wavWriter struct {
+	file    *os.File
+	format  waveFormat
+	written int64
+}
+
+func newWavWriter(file *os.File, format waveFormat) (*wavWriter, error) {
+	if format.silence < 0 {
+		return nil, errors.New("codec cannot be written to WAV")
+	}
+	w := &wavWriter{file: file, format: format}
+	err := w.writeHeader()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wavWriter) writeHeader() error {
+	size := uint32(w.written)
+	pad := uint32(w.written & 1)
+	header := make([]byte, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(
+		header, wavHeaderSize-8+size+pad,
+	)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 18)
+	header = append(header, w.format.marshal()...)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, size)
+	_, err := w.file.WriteAt(header, 0)
+	return err
+}
+
+// Write writes a sample with timestamp in milliseconds since the origin.
+func (w *wavWriter) Write(keyframe bool, timestamp int64, data []byte) (int, error) {
+	if timestamp < 0 {
+		return 0, nil
+	}
+	position := timestamp * int64(w.format.avgBytesPerSec) / 1000
+	if position > w.written {
+		silence := make([]byte, position-w.written)
+		for i := range silence {
+			silence[i] = byte(w.format.silence)
+		}
+		err := w.write(silence)
+		if err != nil {
+			return 0, err
+		}
+	} else if position < w.written {
+		// overlaps with data already written
+		overlap := w.written - position
+		if overlap >= int64(len(data)) {
+			return 0, nil
+		}
+		data = data[overlap:]
+	}
+	err := w.write(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *wavWriter) write(data []byte) error {
+	n, err := w.file.WriteAt(data, wavHeaderSize+w.written)
+	w.written += int64(n)
+	return err
+}
+
+func (w *wavWriter) Close() error {
+	if w.written&1 != 0 {
+		// RIFF chunks are padded to an even size
+		_, err := w.file.WriteAt([]byte{0}, wavHeaderSize+w.written)
+		if err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	err := w.writeHeader()
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,80 @@
+package diskwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWaveFormat(t *testing.T) {
+	f, ok := getWaveFormat("audio/PCMU")
+	if !ok || f.tag != 7 || f.samplesPerSec != 8000 {
+		t.Errorf("Unexpected format for PCMU: %v %v", f, ok)
+	}
+	f, ok = getWaveFormat("audio/G722")
+	if !ok || f.samplesPerSec != 16000 || f.avgBytesPerSec != 8000 {
+		t.Errorf("Unexpected format for G722: %v %v", f, ok)
+	}
+	_, ok = getWaveFormat("audio/opus")
+	if ok {
+		t.Errorf("Opus is not a wave format")
+	}
+	if len(f.marshal()) != 18 {
+		t.Errorf("Bad WAVEFORMATEX length")
+	}
+}
+
+func TestWavWriter(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.wav")
+	file, err := os.Create(fn)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	format, _ := getWaveFormat("audio/PCMA")
+	w, err := newWavWriter(file, format)
+	if err != nil {
+		t.Fatalf("newWavWriter: %v", err)
+	}
+
+	sample := bytes.Repeat([]byte{1}, 160)
+	for _, ts := range []int64{0, 20, 60, 70} {
+		_, err := w.Write(true, ts, sample)
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	// entirely in the past
+	w.Write(true, 0, []byte{2, 2, 2})
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	// 70ms plus one 20ms sample, at 8 bytes per ms
+	size := 90 * 8
+	if len(data) != wavHeaderSize+size ||
+		string(data[:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " ||
+		string(data[38:42]) != "data" {
+		t.Fatalf("Unexpected file layout (%v bytes)", len(data))
+	}
+	if binary.LittleEndian.Uint32(data[4:]) != uint32(len(data)-8) ||
+		binary.LittleEndian.Uint32(data[42:]) != uint32(size) {
+		t.Errorf("Bad chunk sizes")
+	}
+	body := data[wavHeaderSize:]
+	if body[40*8-1] != 1 || body[40*8] != 0xD5 || body[60*8-1] != 0xD5 ||
+		body[60*8] != 1 || body[size-1] != 1 {
+		t.Errorf("Bad silence filling")
+	}
+
+	_, err = newWavWriter(file, waveFormat{silence: -1})
+	if err == nil {
+		t.Errorf("Expected error for unknown silence")
+	}
+}
@@ -0,0 +1,322 @@
+package estimator
+
+import (
+	"sync"
+)
+
+const (
+	// the number of sent packets that we remember
+	delaySentSize = 1 << 12
+	// packets sent within this interval are grouped together, in µs
+	delayGroupInterval = 5000
+	// the number of delay samples used for computing the trend
+	delayWindow = 20
+	// the smoothing factor applied to the accumulated delay
+	delaySmoothing = 0.9
+	// the gain applied to the trend before comparing to the threshold
+	delayGain = 4.0
+	// the initial value of the adaptive threshold, in ms
+	delayInitThreshold = 12.5
+	// the interval over which the acknowledged rate is computed, in µs
+	delayAckedInterval = 500000
+	// the minimum interval between two decreases, in µs
+	delayDecreaseInterval = 300000
+	// we consider the estimate to be stale after this long, in µs
+	delayTimeout = 2000000
+
+	initDelayRate = 512 * 1000
+	minDelayRate  = 9600
+	maxDelayRate  = 1 << 30
+)
+
+type delaySignal int
+
+const (
+	delayNormal delaySignal = iota
+	delayOveruse
+	delayUnderuse
+)
+
+type sentPacket struct {
+	seqno uint16
+	valid bool
+	size  uint32
+	time  uint64
+}
+
+type packetGroup struct {
+	valid   bool
+	first   uint64
+	send    uint64
+	arrival uint64
+}
+
+type delayPoint struct {
+	x, y float64
+}
+
+// An Arrival describes the fate of a packet as reported by the receiver
+// in transport-wide congestion control feedback.  Time is the arrival
+// time in microseconds, as measured by the receiver's clock; only
+// differences between arrival times are meaningful.
+type Arrival struct {
+	Seqno    uint16
+	Received bool
+	Time     uint64
+}
+
+// A Delay is a delay-based bandwidth estimator in the style of Google
+// Congestion Control.  It is fed with the send times of packets carrying
+// a transport-wide sequence number, and with the arrival times reported
+// by the receiver, and estimates the available bandwidth by detecting
+// the growth of queueing delay along the path.  All times are in
+// microseconds.
+type Delay struct {
+	mu   sync.Mutex
+	sent [delaySentSize]sentPacket
+
+	group, prev packetGroup
+	accumulated float64
+	smoothed    float64
+	points      []delayPoint
+	numDeltas   int
+	threshold   float64
+	thresholdAt uint64
+	signal      delaySignal
+
+	ackedBytes uint64
+	ackedStart uint64
+	acked      uint64
+
+	rate         uint64
+	lastUpdate   uint64
+	lastDecrease uint64
+	lastFeedback uint64
+}
+
+// NewDelay creates a new delay-based estimator.
+func NewDelay() *Delay {
+	return &Delay{
+		threshold: delayInitThreshold,
+		rate:      initDelayRate,
+	}
+}
+
+// Sent records that a packet with transport-wide sequence number seqno
+// and size bytes was sent at time now.
+func (d *Delay) Sent(seqno uint16, size uint32, now uint64) {
+	d.mu.Lock()
+	d.sent[seqno%delaySentSize] = sentPacket{
+		seqno: seqno,
+		valid: true,
+		size:  size,
+		time:  now,
+	}
+	d.mu.Unlock()
+}
+
+// Feedback processes a batch of arrivals reported by the receiver at
+// time now and updates the estimate.
+func (d *Delay) Feedback(arrivals []Arrival, now uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, a := range arrivals {
+		if !a.Received {
+			continue
+		}
+		p := &d.sent[a.Seqno%delaySentSize]
+		if !p.valid || p.seqno != a.Seqno {
+			continue
+		}
+		p.valid = false
+		d.ack(p.size, a.Time)
+		d.packet(p.time, a.Time)
+	}
+
+	d.update(now)
+	d.lastFeedback = now
+}
+
+// called locked
+func (d *Delay) ack(size uint32, arrival uint64) {
+	if d.ackedStart == 0 || arrival < d.ackedStart {
+		d.ackedStart = arrival
+		d.ackedBytes = 0
+	}
+	d.ackedBytes += uint64(size)
+	if arrival-d.ackedStart >= delayAckedInterval {
+		d.acked = d.ackedBytes * 8 * 1000000 /
+			(arrival - d.ackedStart)
+		d.ackedStart = arrival
+		d.ackedBytes = 0
+	}
+}
+
+// called locked
+func (d *Delay) packet(send, arrival uint64) {
+	if !d.group.valid {
+		d.group = packetGroup{true, send, send, arrival}
+		return
+	}
+
+	if send < d.group.first+delayGroupInterval {
+		if send > d.group.send {
+			d.group.send = send
+		}
+		if arrival > d.group.arrival {
+			d.group.arrival = arrival
+		}
+		return
+	}
+
+	if d.prev.valid {
+		ds := float64(int64(d.group.send-d.prev.send)) / 1000
+		da := float64(int64(d.group.arrival-d.prev.arrival)) / 1000
+		d.delta(da-ds, d.group.arrival)
+	}
+	d.prev = d.group
+	d.group = packetGroup{true, send, send, arrival}
+}
+
+// delta processes one sample of delay variation, in milliseconds, and
+// updates the overuse signal.  Called locked.
+func (d *Delay) delta(delta float64, arrival uint64) {
+	if d.numDeltas < 60 {
+		d.numDeltas++
+	}
+	d.accumulated += delta
+	d.smoothed = delaySmoothing*d.smoothed +
+		(1-delaySmoothing)*d.accumulated
+	d.points = append(d.points,
+		delayPoint{float64(arrival) / 1000, d.smoothed},
+	)
+	if len(d.points) > delayWindow {
+		d.points = d.points[1:]
+	}
+	if len(d.points) < delayWindow {
+		return
+	}
+
+	trend := slope(d.points) * float64(d.numDeltas) * delayGain
+	d.detect(trend, arrival)
+}
+
+// called locked
+func (d *Delay) detect(trend float64, arrival uint64) {
+	if trend > d.threshold {
+		d.signal = delayOveruse
+	} else if trend < -d.threshold {
+		d.signal = delayUnderuse
+	} else {
+		d.signal = delayNormal
+	}
+
+	abs := trend
+	if abs < 0 {
+		abs = -abs
+	}
+	// don't adapt the threshold to spikes
+	if abs < d.threshold+15 {
+		dt := float64(100)
+		if d.thresholdAt != 0 && arrival > d.thresholdAt {
+			dt = float64(arrival-d.thresholdAt) / 1000
+			if dt > 100 {
+				dt = 100
+			}
+		}
+		k := 0.0087
+		if abs > d.threshold {
+			k = 0.039
+		}
+		d.threshold += k * (abs - d.threshold) * dt
+		if d.threshold < 6 {
+			d.threshold = 6
+		} else if d.threshold > 600 {
+			d.threshold = 600
+		}
+	}
+	d.thresholdAt = arrival
+}
+
+// update applies the rate controller.  Called locked.
+func (d *Delay) update(now uint64) {
+	dt := uint64(0)
+	if d.lastUpdate != 0 && now > d.lastUpdate {
+		dt = now - d.lastUpdate
+		if dt > 1000000 {
+			dt = 1000000
+		}
+	}
+	d.lastUpdate = now
+
+	switch d.signal {
+	case delayOveruse:
+		if d.lastDecrease != 0 &&
+			now-d.lastDecrease < delayDecreaseInterval {
+			return
+		}
+		base := d.rate
+		if d.acked != 0 && d.acked < base {
+			base = d.acked
+		}
+		d.rate = base * 85 / 100
+		d.lastDecrease = now
+	case delayUnderuse:
+		// the queues are draining, hold
+	case delayNormal:
+		// multiplicative increase by 8% per second
+		rate := d.rate + d.rate*dt*8/(100*1000000)
+		// don't increase far beyond what we are actually sending,
+		// in case we are application-limited
+		if d.acked != 0 {
+			limit := d.acked*3/2 + 10000
+			if rate > limit {
+				rate = limit
+			}
+			if rate < d.rate {
+				rate = d.rate
+			}
+		}
+		d.rate = rate
+	}
+
+	if d.rate < minDelayRate {
+		d.rate = minDelayRate
+	} else if d.rate > maxDelayRate {
+		d.rate = maxDelayRate
+	}
+}
+
+// Estimate returns the estimated available bandwidth in bits per second.
+// It returns ^uint64(0) if we haven't received recent feedback.
+func (d *Delay) Estimate(now uint64) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastFeedback == 0 || now < d.lastFeedback ||
+		now-d.lastFeedback > delayTimeout {
+		return ^uint64(0)
+	}
+	return d.rate
+}
+
+// slope returns the slope of the least-squares linear fit of points.
+func slope(points []delayPoint) float64 {
+	var sx, sy float64
+	for _, p := range points {
+		sx += p.x
+		sy += p.y
+	}
+	mx := sx / float64(len(points))
+	my := sy / float64(len(points))
+
+	var num, den float64
+	for _, p := range points {
+		num += (p.x - mx) * (p.y - my)
+		den += (p.x - mx) * (p.x - mx)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
@@ -0,0 +1,61 @@
+package estimator
+
+import (
+	"testing"
+)
+
+// simulate sends packets of size bytes at rate bits/s through a
+// bottleneck of capacity bits/s for duration µs, with feedback every
+// 100ms.  It returns the last estimate.
+func simulate(d *Delay, start uint64, rate, capacity uint64, duration uint64) uint64 {
+	const size = 1000
+	interval := size * 8 * 1000000 / rate
+	transmit := size * 8 * 1000000 / capacity
+
+	var arrivals []Arrival
+	var seqno uint16
+	var last uint64
+	feedback := start
+	for now := start; now < start+duration; now += interval {
+		d.Sent(seqno, size, now)
+		arrival := now + 20000
+		if last+transmit > arrival {
+			arrival = last + transmit
+		}
+		last = arrival
+		arrivals = append(arrivals, Arrival{seqno, true, arrival})
+		seqno++
+
+		if now >= feedback+100000 {
+			d.Feedback(arrivals, now)
+			arrivals = arrivals[:0]
+			feedback = now
+		}
+	}
+	return d.Estimate(start + duration)
+}
+
+func TestDelayUncongested(t *testing.T) {
+	d := NewDelay()
+	if e := d.Estimate(1); e != ^uint64(0) {
+		t.Errorf("Expected no estimate, got %v", e)
+	}
+	e := simulate(d, 1, 800000, 10000000, 10000000)
+	if e <= initDelayRate {
+		t.Errorf("Estimate didn't increase: %v", e)
+	}
+	if e > 800000*3/2+10000 {
+		t.Errorf("Estimate increased too much: %v", e)
+	}
+}
+
+func TestDelayCongested(t *testing.T) {
+	d := NewDelay()
+	e := simulate(d, 1, 2000000, 1000000, 5000000)
+	if e >= 1000000 {
+		t.Errorf("Estimate didn't decrease: %v", e)
+	}
+	if e < minDelayRate {
+		t.Errorf("Estimate too low: %v", e)
+	}
+}
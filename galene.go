@@ -18,6 +18,7 @@ import (
 	"github.com/jech/galene/group"
 	"github.com/jech/galene/ice"
 	"github.com/jech/galene/limit"
+	"github.com/jech/galene/rtpconn"
 	"github.com/jech/galene/token"
 	"github.com/jech/galene/turnserver"
 	"github.com/jech/galene/webserver"
@@ -26,6 +27,8 @@ import (
 func main() {
 	var cpuprofile, memprofile, mutexprofile, httpAddr string
 	var udpRange string
+	var tcpPort int
+	var cacheMemory int64
 
 	flag.StringVar(&httpAddr, "http", ":8443", "web server `address`")
 	flag.StringVar(&webserver.StaticRoot, "static", "./static/",
@@ -46,13 +49,32 @@ func main() {
 		"store mutex profile in `file`")
 	flag.StringVar(&udpRange, "udp-range", "",
 		"UDP `port` (multiplexing) or port1-port2 (range)")
+	flag.IntVar(&tcpPort, "tcp-port", 0,
+		"TCP `port` for ICE-TCP (0 to disable)")
+	flag.DurationVar(&ice.ProbeInterval, "ice-probe", ice.ProbeInterval,
+		"`interval` between health checks of TURN servers (0 to disable)")
 	flag.BoolVar(&group.UseMDNS, "mdns", false, "gather mDNS addresses")
 	flag.BoolVar(&ice.ICERelayOnly, "relay-only", false,
 		"require use of TURN relays for all media traffic")
 	flag.StringVar(&turnserver.Address, "turn", "auto",
 		"built-in TURN server `address` (\"\" to disable)")
+	flag.StringVar(&turnserver.TLSAddress, "turns", "",
+		"public `host:port` of the built-in TURN server's TLS listener")
+	flag.DurationVar(&turnserver.MaxLifetime, "turn-lifetime",
+		turnserver.MaxLifetime,
+		"maximum `duration` of a TURN allocation (0 for unlimited)")
+	flag.IntVar(&turnserver.MaxRate, "turn-rate", turnserver.MaxRate,
+		"maximum `rate` of a TURN allocation in bits/s (0 for unlimited)")
+	flag.Int64Var(&cacheMemory, "cache-memory",
+		rtpconn.CacheBudget.Limit()/(1024*1024),
+		"memory used by packet caches in `megabytes` (0 for unlimited)")
 	flag.Parse()
 
+	if cacheMemory < 0 {
+		log.Fatalf("Cache memory: must be positive or zero")
+	}
+	rtpconn.CacheBudget.SetLimit(cacheMemory * 1024 * 1024)
+
 	if udpRange != "" {
 		if strings.ContainsRune(udpRange, '-') {
 			var min, max uint16
@@ -77,6 +99,16 @@ func main() {
 		}
 	}
 
+	if tcpPort != 0 {
+		if tcpPort < 0 || tcpPort > 0xFFFF {
+			log.Fatalf("TCP: bad port %v", tcpPort)
+		}
+		err := group.SetTCPMux(tcpPort)
+		if err != nil {
+			log.Fatalf("TCP: %v", err)
+		}
+	}
+
 	if cpuprofile != "" {
 		f, err := os.Create(cpuprofile)
 		if err != nil {
@@ -133,6 +165,14 @@ func main() {
 	// make sure the list of public groups is updated early
 	go group.Update()
 
+	if turnserver.TLSAddress != "" && webserver.Insecure {
+		log.Printf("TURN over TLS requires TLS in the web server")
+		turnserver.TLSAddress = ""
+	}
+	turnserver.GetCertificate = webserver.GetCertificate
+	turnserver.AddressFilter = group.ICEAddressAllowed
+	turnserver.PublicAddress = group.ICEPublicAddress
+
 	// causes the built-in server to start if required
 	ice.Update()
 	defer turnserver.Stop()
@@ -146,6 +186,9 @@ func main() {
 	signal.Notify(terminate, syscall.SIGINT, syscall.SIGTERM)
 
 	go relayTest()
+	if ice.ProbeInterval > 0 {
+		go ice.Prober()
+	}
 
 	ticker := time.NewTicker(15 * time.Minute)
 	defer ticker.Stop()
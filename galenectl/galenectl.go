@@ -117,6 +117,58 @@ var commands = map[string]command{
 		command:     deleteTokenCmd,
 		description: "delete a token",
 	},
+	"show-config": {
+		command:     showConfigCmd,
+		description: "show server configuration",
+	},
+	"update-config": {
+		command:     updateConfigCmd,
+		description: "change the server configuration",
+	},
+	"show-ice-servers": {
+		command:     showICEServersCmd,
+		description: "show ICE servers",
+	},
+	"set-ice-servers": {
+		command:     setICEServersCmd,
+		description: "set ICE servers from standard input",
+	},
+	"delete-ice-servers": {
+		command:     deleteICEServersCmd,
+		description: "delete ICE servers, use the built-in TURN server",
+	},
+	"list-clients": {
+		command:     listClientsCmd,
+		description: "list the clients connected to a group",
+	},
+	"kick-client": {
+		command:     kickClientCmd,
+		description: "disconnect a client",
+	},
+	"set-client-permissions": {
+		command:     setClientPermissionsCmd,
+		description: "change a connected client's permissions",
+	},
+	"lock-group": {
+		command:     lockGroupCmd,
+		description: "lock a running group",
+	},
+	"unlock-group": {
+		command:     unlockGroupCmd,
+		description: "unlock a running group",
+	},
+	"wallops": {
+		command:     wallopsCmd,
+		description: "send a message to a group's operators",
+	},
+	"start-recording": {
+		command:     startRecordingCmd,
+		description: "start recording a group",
+	},
+	"stop-recording": {
+		command:     stopRecordingCmd,
+		description: "stop recording a group",
+	},
 }
 
 func main() {
@@ -541,6 +593,32 @@ func postJSON(url string, value any) (string, error) {
 	return location, nil
 }
 
+// patchJSON applies a JSON merge patch (RFC 7396).
+func patchJSON(url string, patch any) error {
+	j, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PATCH", url, bytes.NewReader(j))
+	if err != nil {
+		return err
+	}
+	setAuthorization(req)
+
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpError{resp.StatusCode, resp.Status}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
 func updateJSON[T any](url string, update func(T) T) error {
 	var old T
 	etag, err := getJSON(url, &old)
@@ -592,6 +670,27 @@ func deleteValue(url string) error {
 	return nil
 }
 
+func sendText(method string, url string, text string) error {
+	req, err := http.NewRequest(method, url, strings.NewReader(text))
+	if err != nil {
+		return err
+	}
+	setAuthorization(req)
+	if text != "" {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpError{resp.StatusCode, resp.Status}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
 func setPasswordCmd(cmdname string, args []string) {
 	var groupname, username string
 	var wildcard bool
@@ -924,23 +1023,15 @@ func updateGroupCmd(cmdname string, args []string) {
 		log.Fatalf("Decode standard input: %v", err)
 	}
 
-	err = updateJSON(u, func(m map[string]any) map[string]any {
-		// command line, if any, overrides template
-		for k, v := range data {
-			if v == nil {
-				delete(m, k)
-			} else {
-				m[k] = v
-			}
-		}
-		if unrestrictedTokens.set {
-			m["unrestricted-tokens"] = unrestrictedTokens.value
-		}
-		if autoSubgroups.set {
-			m["auto-subgroups"] = autoSubgroups.value
-		}
-		return m
-	})
+	// command line, if any, overrides template
+	if unrestrictedTokens.set {
+		data["unrestricted-tokens"] = unrestrictedTokens.value
+	}
+	if autoSubgroups.set {
+		data["auto-subgroups"] = autoSubgroups.value
+	}
+
+	err = patchJSON(u, data)
 
 	if err != nil {
 		log.Fatalf("Update group: %v", err)
@@ -967,6 +1058,10 @@ func parsePermissions(p string, expand bool) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	if !pp.Builtin() {
+		// custom roles are expanded by the server
+		return []string{p}, nil
+	}
 	return pp.Permissions(nil), nil
 }
 
@@ -1196,20 +1291,12 @@ func updateUserCmd(cmdname string, args []string) {
 		log.Fatalf("Decode standard input: %v", err)
 	}
 
-	err = updateJSON(u, func(m map[string]any) map[string]any {
-		// command line, if any, overrides template
-		for k, v := range data {
-			if v == nil {
-				delete(m, k)
-			} else {
-				m[k] = v
-			}
-		}
-		if permissions.set {
-			m["permissions"] = perms
-		}
-		return m
-	})
+	// command line, if any, overrides template
+	if permissions.set {
+		data["permissions"] = perms
+	}
+
+	err = patchJSON(u, data)
 
 	if err != nil {
 		log.Fatalf("Update user: %v", err)
@@ -1555,3 +1642,403 @@ func deleteTokenCmd(cmdname string, args []string) {
 		log.Fatalf("Delete token: %v", err)
 	}
 }
+
+func showValue(u string) {
+	var value any
+	_, err := getJSON(u, &value)
+	if err != nil {
+		log.Fatalf("Get: %v", err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(&value)
+	if err != nil {
+		log.Fatalf("Encode: %v", err)
+	}
+}
+
+func showConfigCmd(cmdname string, args []string) {
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname,
+		"%v [option...] %v\n",
+		os.Args[0], cmdname,
+	)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	u, err := url.JoinPath(serverURL, "/galene-api/v0/.config")
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+	showValue(u)
+}
+
+func updateConfigCmd(cmdname string, args []string) {
+	var canonicalHost, proxyURL stringOption
+	var writableGroups boolOption
+	var doJSON bool
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname,
+		"%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.Var(&canonicalHost, "canonical-host", "canonical `hostname`")
+	cmd.Var(&proxyURL, "proxy-url", "`URL` of the reverse proxy")
+	cmd.Var(&writableGroups, "writable-groups",
+		"allow modifying groups and configuration through the API",
+	)
+	cmd.BoolVar(&doJSON, "json", false,
+		"read JSON template from standard input",
+	)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	u, err := url.JoinPath(serverURL, "/galene-api/v0/.config")
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	data, err := stdinJSON(doJSON)
+	if err != nil {
+		log.Fatalf("Decode standard input: %v", err)
+	}
+
+	// command line, if any, overrides template
+	if canonicalHost.set {
+		data["canonicalHost"] = canonicalHost.value
+	}
+	if proxyURL.set {
+		data["proxyURL"] = proxyURL.value
+	}
+	if writableGroups.set {
+		data["writableGroups"] = writableGroups.value
+	}
+
+	err = patchJSON(u, data)
+	if err != nil {
+		log.Fatalf("Update configuration: %v", err)
+	}
+}
+
+func showICEServersCmd(cmdname string, args []string) {
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname,
+		"%v [option...] %v\n",
+		os.Args[0], cmdname,
+	)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	u, err := url.JoinPath(serverURL, "/galene-api/v0/.ice-servers")
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+	showValue(u)
+}
+
+func setICEServersCmd(cmdname string, args []string) {
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname,
+		"%v [option...] %v < ice-servers.json\n",
+		os.Args[0], cmdname,
+	)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	var servers []any
+	decoder := json.NewDecoder(os.Stdin)
+	err := decoder.Decode(&servers)
+	if err != nil {
+		log.Fatalf("Decode standard input: %v", err)
+	}
+
+	u, err := url.JoinPath(serverURL, "/galene-api/v0/.ice-servers")
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+	err = putJSON(u, servers, true)
+	if err != nil {
+		log.Fatalf("Set ICE servers: %v", err)
+	}
+}
+
+func deleteICEServersCmd(cmdname string, args []string) {
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname,
+		"%v [option...] %v\n",
+		os.Args[0], cmdname,
+	)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	u, err := url.JoinPath(serverURL, "/galene-api/v0/.ice-servers")
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+	err = deleteValue(u)
+	if err != nil {
+		log.Fatalf("Delete ICE servers: %v", err)
+	}
+}
+
+type clientInfo struct {
+	Id          string   `json:"id"`
+	Username    string   `json:"username"`
+	Permissions []string `json:"permissions"`
+	Address     string   `json:"address"`
+	Streams     []struct {
+		Id     string   `json:"id"`
+		Label  string   `json:"label"`
+		Tracks []string `json:"tracks"`
+	} `json:"streams"`
+}
+
+func listClientsCmd(cmdname string, args []string) {
+	var groupname string
+	var long bool
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.BoolVar(&long, "l", false, "display client streams")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" {
+		log.Fatal("Option \"-group\" is required.")
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname, ".clients/",
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	var clients []clientInfo
+	_, err = getJSON(u, &clients)
+	if err != nil {
+		log.Fatalf("Get clients: %v", err)
+	}
+	for _, c := range clients {
+		fmt.Printf("%-24s %-20s %-8s %-24s %v\n", c.Id, c.Username,
+			formatRawPermissions(c.Permissions), c.Address,
+			len(c.Streams),
+		)
+		if !long {
+			continue
+		}
+		for _, s := range c.Streams {
+			fmt.Printf("    %-20s %-12s %v\n", s.Id, s.Label,
+				strings.Join(s.Tracks, ","),
+			)
+		}
+	}
+}
+
+func kickClientCmd(cmdname string, args []string) {
+	var groupname, clientid, message string
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.StringVar(&clientid, "client", "", "client `id`")
+	cmd.StringVar(&message, "message", "", "`message` sent to the client")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" || clientid == "" {
+		log.Fatal("Options \"-group\" and \"-client\" are required.")
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname,
+		".clients", clientid,
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	err = sendText("DELETE", u, message)
+	if err != nil {
+		log.Fatalf("Kick client: %v", err)
+	}
+}
+
+func setClientPermissionsCmd(cmdname string, args []string) {
+	var groupname, clientid, permissions string
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.StringVar(&clientid, "client", "", "client `id`")
+	cmd.StringVar(&permissions, "permissions", "", "permissions")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" || clientid == "" || permissions == "" {
+		log.Fatal("Options \"-group\", \"-client\" " +
+			"and \"-permissions\" are required.")
+	}
+
+	perms, err := parsePermissions(permissions, false)
+	if err != nil {
+		log.Fatalf("Parse permissions: %v", err)
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname,
+		".clients", clientid, ".permissions",
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	err = putJSON(u, perms, true)
+	if err != nil {
+		log.Fatalf("Set permissions: %v", err)
+	}
+}
+
+// liveCmd implements the commands that act on a running group without
+// any additional options.
+func liveCmd(cmdname string, args []string, kind string, method string, what string) {
+	var groupname string
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" {
+		log.Fatal("Option \"-group\" is required.")
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname, kind,
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	err = sendText(method, u, "")
+	if err != nil {
+		log.Fatalf("%v: %v", what, err)
+	}
+}
+
+func lockGroupCmd(cmdname string, args []string) {
+	var groupname, message string
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...]\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.StringVar(&message, "message", "", "lock `message`")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" {
+		log.Fatal("Option \"-group\" is required.")
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname, ".lock",
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	err = sendText("PUT", u, message)
+	if err != nil {
+		log.Fatalf("Lock group: %v", err)
+	}
+}
+
+func unlockGroupCmd(cmdname string, args []string) {
+	liveCmd(cmdname, args, ".lock", "DELETE", "Unlock group")
+}
+
+func wallopsCmd(cmdname string, args []string) {
+	var groupname string
+	cmd := flag.NewFlagSet(cmdname, flag.ExitOnError)
+	setUsage(cmd, cmdname, "%v [option...] %v [option...] message...\n",
+		os.Args[0], cmdname,
+	)
+	cmd.StringVar(&groupname, "group", "", "group `name`")
+	cmd.Parse(args)
+
+	if cmd.NArg() == 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	if groupname == "" {
+		log.Fatal("Option \"-group\" is required.")
+	}
+
+	u, err := url.JoinPath(
+		serverURL, "/galene-api/v0/.groups/", groupname, ".wallops",
+	)
+	if err != nil {
+		log.Fatalf("Build URL: %v", err)
+	}
+
+	err = sendText("POST", u, strings.Join(cmd.Args(), " "))
+	if err != nil {
+		log.Fatalf("Send message: %v", err)
+	}
+}
+
+func startRecordingCmd(cmdname string, args []string) {
+	liveCmd(cmdname, args, ".recording", "PUT", "Start recording")
+}
+
+func stopRecordingCmd(cmdname string, args []string) {
+	liveCmd(cmdname, args, ".recording", "DELETE", "Stop recording")
+}
@@ -0,0 +1,179 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jech/galene/atomicfile"
+)
+
+var ErrConfigurationNotWritable = &NotAuthorisedError{
+	errors.New("configuration is not writable"),
+}
+
+// serialises updates to the configuration file
+var configurationWriteMu sync.Mutex
+
+func configurationFilename() string {
+	return filepath.Join(DataDirectory, "config.json")
+}
+
+// readConfigurationFile reads the configuration file from disk, and returns
+// it together with a suitable ETag.  A missing file yields an empty
+// configuration.
+func readConfigurationFile() (*Configuration, string, error) {
+	f, err := os.Open(configurationFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		return &Configuration{}, makeETag(0, time.Unix(0, 0)), nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	var conf Configuration
+	err = d.Decode(&conf)
+	if err != nil {
+		return nil, "", err
+	}
+	conf.modTime = fi.ModTime()
+	conf.fileSize = fi.Size()
+	return &conf, makeETag(fi.Size(), fi.ModTime()), nil
+}
+
+// sanitise returns a copy of the configuration without any passwords.
+func (conf *Configuration) sanitise() *Configuration {
+	c := *conf
+	if conf.Users != nil {
+		c.Users = make(map[string]UserDescription, len(conf.Users))
+		for k, u := range conf.Users {
+			u.Password = Password{}
+			c.Users[k] = u
+		}
+	}
+	return &c
+}
+
+// checkAdmin returns an error if the configuration doesn't allow any
+// administrator to log in.  Roles are resolved against conf itself, which
+// is not necessarily the configuration on disk.
+func (conf *Configuration) checkAdmin() error {
+	for _, u := range conf.Users {
+		if u.Password.Type == "" && u.Password.Key == nil {
+			continue
+		}
+		perms := u.Permissions.permissions
+		if name := u.Permissions.name; name != "" {
+			if p, ok := permissionsMap[name]; ok {
+				perms = p
+			} else {
+				perms = conf.Roles[name].Permissions
+			}
+		}
+		if member("admin", perms) {
+			return nil
+		}
+	}
+	return UserError("configuration has no administrator with a password")
+}
+
+// GetSanitisedConfiguration returns the configuration without any
+// passwords, together with a suitable ETag.
+func GetSanitisedConfiguration() (*Configuration, string, error) {
+	conf, etag, err := readConfigurationFile()
+	if err != nil {
+		return nil, "", err
+	}
+	return conf.sanitise(), etag, nil
+}
+
+// GetConfigurationTag returns an ETag for the configuration.
+func GetConfigurationTag() (string, error) {
+	_, etag, err := readConfigurationFile()
+	return etag, err
+}
+
+// updateConfiguration writes a new configuration, keeping the passwords
+// of any users that don't specify a password.  Called with
+// configurationWriteMu held.
+func updateConfiguration(old, conf *Configuration) error {
+	if !old.WritableGroups {
+		return ErrConfigurationNotWritable
+	}
+
+	newconf := *conf
+	if conf.Users != nil {
+		newconf.Users = make(map[string]UserDescription, len(conf.Users))
+		for k, u := range conf.Users {
+			if u.Password.Type == "" && u.Password.Key == nil {
+				u.Password = old.Users[k].Password
+			}
+			newconf.Users[k] = u
+		}
+	}
+
+	if newconf.Admin != nil {
+		return UserError("field \"admin\" is obsolete")
+	}
+	err := newconf.checkNetwork()
+	if err != nil {
+		return UserError(err.Error())
+	}
+	err = newconf.checkRoles()
+	if err != nil {
+		return err
+	}
+	err = newconf.checkAdmin()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteJSON(configurationFilename(), &newconf, "")
+}
+
+// UpdateConfiguration overwrites the configuration if it matches a given
+// ETag.  Users without a password keep their current password.
+func UpdateConfiguration(etag string, conf *Configuration) error {
+	configurationWriteMu.Lock()
+	defer configurationWriteMu.Unlock()
+
+	old, oldetag, err := readConfigurationFile()
+	if err != nil {
+		return err
+	}
+	if etag != oldetag {
+		return ErrTagMismatch
+	}
+	return updateConfiguration(old, conf)
+}
+
+// PatchConfiguration applies a JSON merge patch to the sanitised
+// configuration.  If etag is not empty, the patch is only applied if it
+// matches.
+func PatchConfiguration(etag string, patch []byte) error {
+	configurationWriteMu.Lock()
+	defer configurationWriteMu.Unlock()
+
+	old, oldetag, err := readConfigurationFile()
+	if err != nil {
+		return err
+	}
+	if etag != "" && etag != oldetag {
+		return ErrTagMismatch
+	}
+	conf, err := patchJSON(old.sanitise(), patch)
+	if err != nil {
+		return err
+	}
+	return updateConfiguration(old, conf)
+}
@@ -0,0 +1,139 @@
+package group
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateConfiguration(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("setupTest: %v", err)
+	}
+
+	conf, etag, err := GetSanitisedConfiguration()
+	if err != nil || etag == "" {
+		t.Fatalf("GetSanitisedConfiguration: %v %v", etag, err)
+	}
+	err = UpdateConfiguration(etag, conf)
+	if !errors.Is(err, ErrConfigurationNotWritable) {
+		t.Errorf("UpdateConfiguration: got %v, expected not writable",
+			err)
+	}
+
+	err = os.WriteFile(filepath.Join(DataDirectory, "config.json"),
+		[]byte(`{"writableGroups": true, "users": {
+                    "root": {"password": "pw", "permissions": "admin"}
+                }}`), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	conf, etag, err = GetSanitisedConfiguration()
+	if err != nil {
+		t.Fatalf("GetSanitisedConfiguration: %v", err)
+	}
+	if pw := conf.Users["root"].Password; pw.Type != "" || pw.Key != nil {
+		t.Errorf("Configuration is not sanitised: %v", pw)
+	}
+
+	conf.CanonicalHost = "galene.example.org"
+	err = UpdateConfiguration("\"badetag\"", conf)
+	if !errors.Is(err, ErrTagMismatch) {
+		t.Errorf("UpdateConfiguration: got %v, expected ErrTagMismatch",
+			err)
+	}
+
+	err = UpdateConfiguration(etag, conf)
+	if err != nil {
+		t.Errorf("UpdateConfiguration: %v", err)
+	}
+
+	c, err := GetConfiguration()
+	if err != nil {
+		t.Fatalf("GetConfiguration: %v", err)
+	}
+	ok, _ := c.Users["root"].Password.Match("pw")
+	if c.CanonicalHost != "galene.example.org" || !ok {
+		t.Errorf("Bad configuration %#v", c)
+	}
+
+	bad := []string{
+		`{"users": null}`,
+		`{"users": {"root": {"permissions": "observe"}}}`,
+		`{"users": {"root": null, "vimes": {"permissions": "admin"}}}`,
+		`{"publicAddresses": ["not an address"]}`,
+		`{"unknown-field": true}`,
+	}
+	for _, p := range bad {
+		err = PatchConfiguration("", []byte(p))
+		var usererr UserError
+		if !errors.As(err, &usererr) {
+			t.Errorf("PatchConfiguration %v: got %v, "+
+				"expected UserError", p, err)
+		}
+	}
+
+	err = PatchConfiguration("", []byte(`{"users": {
+            "root": null,
+            "vimes": {"password": "pw2", "permissions": "admin"}
+        }}`))
+	if err != nil {
+		t.Errorf("PatchConfiguration: %v", err)
+	}
+	c, err = GetConfiguration()
+	if err != nil {
+		t.Fatalf("GetConfiguration: %v", err)
+	}
+	_, found := c.Users["root"]
+	ok, _ = c.Users["vimes"].Password.Match("pw2")
+	if found || !ok || c.CanonicalHost != "galene.example.org" {
+		t.Errorf("Bad configuration %#v", c)
+	}
+}
+
+func TestCheckAdminRoles(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("setupTest: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(DataDirectory, "config.json"),
+		[]byte(`{"writableGroups": true, "roles": {
+                    "boss": {"permissions": ["admin"]}
+                }, "users": {
+                    "root": {"password": "pw", "permissions": "boss"}
+                }}`), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// redefining the role would lock out the only administrator
+	err = PatchConfiguration("", []byte(`{"roles": {
+            "boss": {"permissions": ["present"]}
+        }}`))
+	var usererr UserError
+	if !errors.As(err, &usererr) {
+		t.Errorf("PatchConfiguration: got %v, expected UserError", err)
+	}
+
+	// a new administrator role is usable in the same update
+	err = PatchConfiguration("", []byte(`{"roles": {
+            "boss": null,
+            "chief": {"permissions": ["admin", "op"]}
+        }, "users": {
+            "root": {"password": "pw", "permissions": "chief"}
+        }}`))
+	if err != nil {
+		t.Errorf("PatchConfiguration: %v", err)
+	}
+	c, err := GetConfiguration()
+	if err != nil {
+		t.Fatalf("GetConfiguration: %v", err)
+	}
+	_, ok := c.Roles["chief"]
+	if !ok || c.Users["root"].Permissions.name != "chief" {
+		t.Errorf("Bad configuration %#v", c)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jech/galene/atomicfile"
 	"github.com/jech/galene/token"
 )
 
@@ -35,9 +36,12 @@ var permissionsMap = map[string][]string{
 	"admin":   {"admin"},
 }
 
+// NewPermissions returns the permissions corresponding to a built-in or
+// custom role.  Custom roles are only checked when a description is read
+// or written.
 func NewPermissions(name string) (Permissions, error) {
 	_, ok := permissionsMap[name]
-	if !ok {
+	if !ok && !validRoleName(name) {
 		return Permissions{}, ErrUnknownPermission
 	}
 	return Permissions{
@@ -45,12 +49,22 @@ func NewPermissions(name string) (Permissions, error) {
 	}, nil
 }
 
+// Builtin returns true if p is a built-in role.
+func (p Permissions) Builtin() bool {
+	_, ok := permissionsMap[p.name]
+	return ok
+}
+
 func (p Permissions) Permissions(desc *Description) []string {
 	if p.name == "" {
 		return p.permissions
 	}
 
-	perms := permissionsMap[p.name]
+	// the caller may modify the result
+	role, _ := getRole(desc, p.name)
+	perms := append(
+		make([]string, 0, len(role.Permissions)), role.Permissions...,
+	)
 
 	op := false
 	present := false
@@ -69,14 +83,22 @@ func (p Permissions) Permissions(desc *Description) []string {
 		}
 	}
 
-	if desc != nil && desc.AllowRecording {
+	allowRecording := desc != nil && desc.AllowRecording
+	if role.AllowRecording != nil {
+		allowRecording = *role.AllowRecording
+	}
+	unrestrictedTokens := desc != nil && desc.UnrestrictedTokens
+	if role.UnrestrictedTokens != nil {
+		unrestrictedTokens = *role.UnrestrictedTokens
+	}
+
+	if allowRecording && (desc == nil || !desc.E2EE) {
 		if op && !record {
-			// copy the slice
 			perms = append([]string{"record"}, perms...)
 		}
 	}
 
-	if desc != nil && desc.UnrestrictedTokens {
+	if unrestrictedTokens {
 		if present && !token {
 			perms = append([]string{"token"}, perms...)
 		}
@@ -111,13 +133,11 @@ func (p *Permissions) UnmarshalJSON(b []byte) error {
 	var s string
 	err = json.Unmarshal(b, &s)
 	if err == nil {
-		_, ok := permissionsMap[s]
-		if !ok {
-			return ErrUnknownPermission
-		}
-		*p = Permissions{
-			name: s,
+		pp, err := NewPermissions(s)
+		if err != nil {
+			return err
 		}
+		*p = pp
 		return nil
 	}
 	return err
@@ -184,6 +204,24 @@ type Description struct {
 	// The maximum number of simultaneous clients.  Unlimited if 0.
 	MaxClients int `json:"max-clients,omitempty"`
 
+	// The maximum number of streams that a single client may publish
+	// simultaneously.  Unlimited if 0.
+	MaxClientStreams int `json:"max-client-streams,omitempty"`
+
+	// The maximum number of clients whose video is forwarded to each
+	// client, chosen among the most recent speakers.  Unlimited if 0.
+	LastN int `json:"last-n,omitempty"`
+
+	// If positive, the Opus audio of the group is mixed by the server,
+	// and each client receives a single audio track containing the
+	// given number of loudest speakers.
+	AudioMixing int `json:"audio-mixing,omitempty"`
+
+	// The maximum rate, in bytes per second, at which each client may
+	// send data over forwarded data channels.  A default is used if 0,
+	// and data channels are not forwarded if negative.
+	DataChannelRate int `json:"data-channel-rate,omitempty"`
+
 	// The time for which history entries are kept.
 	MaxHistoryAge int `json:"max-history-age,omitempty"`
 
@@ -196,6 +234,13 @@ type Description struct {
 	// Whether recording is allowed.
 	AllowRecording bool `json:"allow-recording,omitempty"`
 
+	// Whether audio-only recordings of G.711 should be written as WAV
+	WAVRecording bool `json:"wav-recording,omitempty"`
+
+	// Whether media is end-to-end encrypted.  If true, the server
+	// doesn't parse media payloads, and recording is not possible.
+	E2EE bool `json:"e2ee,omitempty"`
+
 	// Whether creating tokens is allowed
 	UnrestrictedTokens bool `json:"unrestricted-tokens,omitempty"`
 
@@ -208,6 +253,9 @@ type Description struct {
 	// Whether to kick all users when the last op logs out.
 	Autokick bool `json:"autokick,omitempty"`
 
+	// Custom roles, usable in addition to the built-in ones
+	Roles map[string]Role `json:"roles,omitempty"`
+
 	// Users allowed to login
 	Users map[string]UserDescription `json:"users,omitempty"`
 
@@ -399,43 +447,12 @@ func rewriteDescriptionFile(filename string, desc *Description) error {
 		return ErrDescriptionsNotWritable
 	}
 
-	dir := filepath.Dir(filename)
-
-	err = os.MkdirAll(dir, 0700)
-	if err != nil {
-		return err
-	}
-
-	f, err := os.CreateTemp(dir, "*.temp")
-	if err != nil {
-		return err
-	}
-	temp := f.Name()
-
-	encoder := json.NewEncoder(f)
-	err = encoder.Encode(desc)
-	if err == nil {
-		err = f.Sync()
-	}
-	if err != nil {
-		f.Close()
-		os.Remove(temp)
-		return err
-	}
-	err = f.Close()
+	err = desc.checkRoles()
 	if err != nil {
-		os.Remove(temp)
 		return err
 	}
 
-	err = os.Rename(temp, filename)
-	if err != nil {
-		os.Remove(temp)
-		return err
-	}
-
-	return nil
-
+	return atomicfile.WriteJSON(filename, desc, "")
 }
 
 // readDescription reads a group's description from disk
@@ -469,6 +486,11 @@ func readDescription(name string, allowSubgroups bool) (*Description, error) {
 		return nil, err
 	}
 
+	err = desc.checkRoles()
+	if err != nil {
+		return nil, err
+	}
+
 	if isSubgroup {
 		if !desc.AutoSubgroups {
 			return nil, os.ErrNotExist
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"log"
 	"maps"
+	"net"
 	"net/url"
 	"os"
 	"path"
@@ -18,8 +19,10 @@ import (
 
 	"github.com/pion/ice/v4"
 	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 
+	gcodecs "github.com/jech/galene/codecs"
 	"github.com/jech/galene/token"
 )
 
@@ -27,6 +30,7 @@ var Directory, DataDirectory string
 var UseMDNS bool
 var UDPMin, UDPMax uint16
 var udpMux ice.UDPMux
+var tcpMux ice.TCPMux
 
 type NotAuthorisedError struct {
 	err error
@@ -108,6 +112,8 @@ type Group struct {
 	history     []ChatHistoryEntry
 	timestamp   time.Time
 	data        map[string]interface{}
+
+	speakers speakerDetector
 }
 
 func (g *Group) Name() string {
@@ -203,10 +209,22 @@ func (g *Group) API() (*webrtc.API, error) {
 	return APIFromNames(codecs)
 }
 
-func fmtpValue(fmtp, key string) string {
+// DownAPI is like API, but returns an API suitable for down connections,
+// which additionally negotiates transport-wide congestion control.
+func (g *Group) DownAPI() (*webrtc.API, error) {
+	g.mu.Lock()
+	codecs := g.description.Codecs
+	g.mu.Unlock()
+
+	return apiFromNames(codecs, true)
+}
+
+// FmtpValue returns the value of parameter key in an SDP fmtp line, or
+// the empty string if it is not present.
+func FmtpValue(fmtp, key string) string {
 	fields := strings.Split(fmtp, ";")
 	for _, f := range fields {
-		k, v, found := strings.Cut(f, "=")
+		k, v, found := strings.Cut(strings.TrimSpace(f), "=")
 		if found && k == key {
 			return v
 		}
@@ -219,7 +237,7 @@ func CodecPayloadType(codec webrtc.RTPCodecCapability) (webrtc.PayloadType, erro
 	case "video/vp8":
 		return 96, nil
 	case "video/vp9":
-		profile := fmtpValue(codec.SDPFmtpLine, "profile-id")
+		profile := FmtpValue(codec.SDPFmtpLine, "profile-id")
 		switch profile {
 		case "", "0":
 			return 98, nil
@@ -232,7 +250,7 @@ func CodecPayloadType(codec webrtc.RTPCodecCapability) (webrtc.PayloadType, erro
 	case "video/av1":
 		return 35, nil
 	case "video/h264":
-		profile := fmtpValue(codec.SDPFmtpLine, "profile-level-id")
+		profile := FmtpValue(codec.SDPFmtpLine, "profile-level-id")
 		if profile == "" {
 			return 102, nil
 		}
@@ -249,8 +267,12 @@ func CodecPayloadType(codec webrtc.RTPCodecCapability) (webrtc.PayloadType, erro
 				"unknown H.264 profile %v", profile,
 			)
 		}
+	case "video/h265":
+		return 116, nil
 	case "audio/opus":
 		return 111, nil
+	case "audio/red":
+		return 63, nil
 	case "audio/g722":
 		return 9, nil
 	case "audio/pcmu":
@@ -271,6 +293,13 @@ var VideoRTCPFeedback = []webrtc.RTCPFeedback{
 	{"ccm", "fir"},
 }
 
+// VideoDownRTCPFeedback are the RTCP feedback types that we negotiate
+// for video tracks on down connections.
+var VideoDownRTCPFeedback = append(
+	VideoRTCPFeedback[:len(VideoRTCPFeedback):len(VideoRTCPFeedback)],
+	webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC},
+)
+
 // AudioRTCPFeedback is like VideoRTCPFeedback but for audio tracks.
 var AudioRTCPFeedback = []webrtc.RTCPFeedback(nil)
 
@@ -315,6 +344,14 @@ func codecsFromName(name string) ([]webrtc.RTPCodecParameters, error) {
 				VideoRTCPFeedback,
 			},
 		}
+	case "h265":
+		codecs = []webrtc.RTPCodecCapability{
+			{
+				"video/H265", 90000, 0,
+				"profile-id=1",
+				VideoRTCPFeedback,
+			},
+		}
 	case "opus":
 		codecs = []webrtc.RTPCodecCapability{
 			{
@@ -351,7 +388,7 @@ func codecsFromName(name string) ([]webrtc.RTPCodecParameters, error) {
 		return nil, errors.New("unknown codec")
 	}
 
-	parms := make([]webrtc.RTPCodecParameters, 0, len(codecs))
+	parms := make([]webrtc.RTPCodecParameters, 0, 2*len(codecs))
 	for _, c := range codecs {
 		ptype, err := CodecPayloadType(c)
 		if err != nil {
@@ -363,27 +400,83 @@ func codecsFromName(name string) ([]webrtc.RTPCodecParameters, error) {
 			RTPCodecCapability: c,
 			PayloadType:        ptype,
 		})
+		if strings.HasPrefix(strings.ToLower(c.MimeType), "video/") {
+			parms = append(parms, RTXCodec(ptype))
+		} else if strings.EqualFold(c.MimeType, "audio/opus") {
+			parms = append(parms, REDCodec(ptype))
+		}
 	}
 	return parms, nil
 }
 
+// REDCodec returns the parameters of the RED codec (RFC 2198) used for
+// sending redundant audio encoded with the codec with payload type ptype.
+func REDCodec(ptype webrtc.PayloadType) webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    "audio/red",
+			ClockRate:   48000,
+			Channels:    2,
+			SDPFmtpLine: fmt.Sprintf("%v/%v", ptype, ptype),
+		},
+		PayloadType: 63,
+	}
+}
+
+// RTXCodec returns the parameters of the RTX codec (RFC 4588) used for
+// retransmissions of the video codec with payload type ptype.
+func RTXCodec(ptype webrtc.PayloadType) webrtc.RTPCodecParameters {
+	return webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeRTX,
+			ClockRate:   90000,
+			SDPFmtpLine: fmt.Sprintf("apt=%v", ptype),
+		},
+		PayloadType: ptype + 1,
+	}
+}
+
 func SetUDPMux(port int) error {
 	var err error
 	udpMux, err = ice.NewMultiUDPMuxFromPort(port)
 	return err
 }
 
+// SetTCPMux causes all peer connections to offer passive ICE-TCP
+// candidates on the given port.
+func SetTCPMux(port int) error {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+	if err != nil {
+		return err
+	}
+	tcpMux = ice.NewTCPMuxDefault(ice.TCPMuxParams{
+		Listener:        l,
+		ReadBufferSize:  8,
+		WriteBufferSize: 4 * 1024 * 1024,
+	})
+	return nil
+}
+
 func APIFromCodecs(codecs []webrtc.RTPCodecParameters) (*webrtc.API, error) {
+	return apiFromCodecs(codecs, false)
+}
+
+func apiFromCodecs(codecs []webrtc.RTPCodecParameters, down bool) (*webrtc.API, error) {
 	s := webrtc.SettingEngine{}
 	s.SetSRTPReplayProtectionWindow(512)
 	s.DisableActiveTCP(true)
 	if !UseMDNS {
 		s.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
 	}
+	getNetworkConfiguration().configureNetwork(&s)
 
 	m := webrtc.MediaEngine{}
 
 	for _, codec := range codecs {
+		// we only generate RED, we don't know how to receive it
+		if !down && strings.EqualFold(codec.MimeType, "audio/red") {
+			continue
+		}
 		tpe := webrtc.RTPCodecTypeVideo
 		if strings.HasPrefix(strings.ToLower(codec.MimeType), "audio/") {
 			tpe = webrtc.RTPCodecTypeAudio
@@ -401,11 +494,62 @@ func APIFromCodecs(codecs []webrtc.RTPCodecParameters) (*webrtc.API, error) {
 		s.SetEphemeralUDPPortRange(UDPMin, UDPMax)
 	}
 
+	if tcpMux != nil {
+		s.SetICETCPMux(tcpMux)
+		s.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6,
+		})
+	}
+
 	err := webrtc.ConfigureSimulcastExtensionHeaders(&m)
 	if err != nil {
 		return nil, err
 	}
 
+	// audio levels are only used for active speaker detection,
+	// don't negotiate them on down connections
+	err = m.RegisterHeaderExtension(
+		webrtc.RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI},
+		webrtc.RTPCodecTypeAudio,
+		webrtc.RTPTransceiverDirectionRecvonly,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the dependency descriptor is used for layer selection with AV1,
+	// we strip it before forwarding
+	err = m.RegisterHeaderExtension(
+		webrtc.RTPHeaderExtensionCapability{
+			URI: gcodecs.DependencyDescriptorURI,
+		},
+		webrtc.RTPCodecTypeVideo,
+		webrtc.RTPTransceiverDirectionRecvonly,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if down {
+		// we only implement the sender side of transport-wide
+		// congestion control, don't negotiate it on up connections
+		m.RegisterFeedback(
+			webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC},
+			webrtc.RTPCodecTypeVideo,
+		)
+		err = m.RegisterHeaderExtension(
+			webrtc.RTPHeaderExtensionCapability{
+				URI: sdp.TransportCCURI,
+			},
+			webrtc.RTPCodecTypeVideo,
+			webrtc.RTPTransceiverDirectionSendonly,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ir := interceptor.Registry{}
 
 	return webrtc.NewAPI(
@@ -416,6 +560,10 @@ func APIFromCodecs(codecs []webrtc.RTPCodecParameters) (*webrtc.API, error) {
 }
 
 func APIFromNames(names []string) (*webrtc.API, error) {
+	return apiFromNames(names, false)
+}
+
+func apiFromNames(names []string, down bool) (*webrtc.API, error) {
 	if len(names) == 0 {
 		names = []string{"vp8", "opus"}
 	}
@@ -429,7 +577,7 @@ func APIFromNames(names []string) (*webrtc.API, error) {
 		codecs = append(codecs, cs...)
 	}
 
-	return APIFromCodecs(codecs)
+	return apiFromCodecs(codecs, down)
 }
 
 func Add(name string, desc *Description) (*Group, error) {
@@ -759,6 +907,9 @@ func DelClient(c Client) {
 			g.Name(), "delete", c.Id(), c.Username(), nil, nil,
 		)
 	}
+	if g.speakers.remove(c.Id(), time.Now()) {
+		g.notifySpeaker()
+	}
 	autoLockKick(g)
 }
 
@@ -932,6 +1083,16 @@ type Configuration struct {
 	WritableGroups   bool                       `json:"writableGroups,omitempty"`
 	Users            map[string]UserDescription `json:"users,omitempty"`
 
+	// ICE gathering
+	PublicAddresses      []string `json:"publicAddresses,omitempty"`
+	AllowInterfaces      []string `json:"allowInterfaces,omitempty"`
+	DenyInterfaces       []string `json:"denyInterfaces,omitempty"`
+	AllowAddressFamilies []string `json:"allowAddressFamilies,omitempty"`
+	DenyAddressFamilies  []string `json:"denyAddressFamilies,omitempty"`
+
+	// Custom roles, usable in all groups
+	Roles map[string]Role `json:"roles,omitempty"`
+
 	// obsolete fields
 	Admin []ClientPattern `json:"admin,omitempty"`
 }
@@ -988,6 +1149,14 @@ func GetConfiguration() (*Configuration, error) {
 		log.Printf("%v: field \"admin\" is obsolete, ignored", filename)
 		conf.Admin = nil
 	}
+	err = conf.checkNetwork()
+	if err != nil {
+		return nil, err
+	}
+	err = conf.checkRoles()
+	if err != nil {
+		return nil, err
+	}
 	configuration.configuration = &conf
 	return configuration.configuration, nil
 }
@@ -1070,6 +1239,7 @@ func (g *Group) getPermission(creds ClientCredentials) (string, []string, error)
 		if err != nil {
 			return "", nil, &NotAuthorisedError{err: err}
 		}
+		perms = desc.ExpandRoles(perms)
 		if username == "" && creds.Username != nil {
 			if g.userExists(*creds.Username) {
 				return "", nil, ErrDuplicateUsername
@@ -1114,6 +1284,7 @@ type Status struct {
 	Locked            bool   `json:"locked,omitempty"`
 	ClientCount       *int   `json:"clientCount,omitempty"`
 	CanChangePassword bool   `json:"canChangePassword,omitempty"`
+	E2EE              bool   `json:"e2ee,omitempty"`
 }
 
 // Status returns a group's status.
@@ -1161,6 +1332,7 @@ func (g *Group) Status(authentified bool, base *url.URL) Status {
 		AuthServer:  desc.AuthServer,
 		AuthPortal:  desc.AuthPortal,
 		Description: desc.Description,
+		E2EE:        desc.E2EE,
 	}
 
 	if authentified || desc.Public {
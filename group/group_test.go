@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -59,6 +60,10 @@ func TestGroup(t *testing.T) {
 	if err != nil || api == nil {
 		t.Errorf("Couldn't get API: %v", err)
 	}
+	api, err = g.DownAPI()
+	if err != nil || api == nil {
+		t.Errorf("Couldn't get down API: %v", err)
+	}
 
 	if names := GetNames(); len(names) != 2 {
 		t.Errorf("Expected 2, got %v", names)
@@ -296,6 +301,11 @@ func TestExtraPermissions(t *testing.T) {
 	})
 	doit("john", []string{"token", "present", "message"})
 	doit("james", []string{})
+
+	d.E2EE = true
+
+	doit("jch", []string{"op", "token", "present", "message", "caption"})
+	doit("john", []string{"token", "present", "message"})
 }
 
 func TestUsernameTaken(t *testing.T) {
@@ -333,12 +343,13 @@ func TestFmtpValue(t *testing.T) {
 		{"foo=1;bar=2;quux=3", "foo", "1"},
 		{"foo=1;bar=2;quux=3", "bar", "2"},
 		{"foo=1;bar=2;quux=3", "fu", ""},
+		{"minptime=10; useinbandfec=1", "useinbandfec", "1"},
 	}
 
 	for _, test := range fmtpTests {
-		v := fmtpValue(test.fmtp, test.key)
+		v := FmtpValue(test.fmtp, test.key)
 		if v != test.value {
-			t.Errorf("fmtpValue(%v, %v) = %v, expected %v",
+			t.Errorf("FmtpValue(%v, %v) = %v, expected %v",
 				test.fmtp, test.key, v, test.value,
 			)
 		}
@@ -377,7 +388,7 @@ func TestValidGroupName(t *testing.T) {
 
 func TestPayloadTypeDistinct(t *testing.T) {
 	names := []string{
-		"vp8", "vp9", "av1", "h264",
+		"vp8", "vp9", "av1", "h264", "h265",
 		"opus", "g722", "pcmu", "pcma",
 	}
 
@@ -394,13 +405,89 @@ func TestPayloadTypeDistinct(t *testing.T) {
 			t.Errorf("%v: %v", codec, err)
 			continue
 		}
-		if other, ok := m[pt]; ok {
-			t.Errorf(
-				"Duplicate ptype %v: %v and %v",
-				pt, n, other,
-			)
-			continue
+		if pt != codec[0].PayloadType {
+			t.Errorf("%v: expected ptype %v, got %v",
+				n, pt, codec[0].PayloadType)
+		}
+		for _, c := range codec {
+			if other, ok := m[c.PayloadType]; ok {
+				t.Errorf(
+					"Duplicate ptype %v: %v and %v",
+					c.PayloadType, n, other,
+				)
+				continue
+			}
+			m[c.PayloadType] = n
 		}
-		m[pt] = n
+	}
+}
+
+func TestRedundancyCodecs(t *testing.T) {
+	codecs, err := codecsFromName("vp8")
+	if err != nil {
+		t.Fatalf("vp8: %v", err)
+	}
+	if len(codecs) != 2 {
+		t.Fatalf("Expected 2 codecs, got %v", codecs)
+	}
+	rtx := codecs[1]
+	if rtx.MimeType != webrtc.MimeTypeRTX || rtx.PayloadType != 97 ||
+		rtx.SDPFmtpLine != "apt=96" {
+		t.Errorf("Expected RTX for 96, got %v", rtx)
+	}
+
+	codecs, err = codecsFromName("opus")
+	if err != nil || len(codecs) != 2 {
+		t.Fatalf("Expected opus and RED, got %v %v", codecs, err)
+	}
+	red := codecs[1]
+	if red.MimeType != "audio/red" || red.PayloadType != 63 ||
+		red.SDPFmtpLine != "111/111" {
+		t.Errorf("Expected RED for 111, got %v", red)
+	}
+}
+
+func TestTCPMux(t *testing.T) {
+	err := SetTCPMux(0)
+	if err != nil {
+		t.Fatalf("SetTCPMux: %v", err)
+	}
+	defer func() {
+		tcpMux.Close()
+		tcpMux = nil
+	}()
+
+	api, err := APIFromNames([]string{"opus"})
+	if err != nil {
+		t.Fatalf("APIFromNames: %v", err)
+	}
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("NewPeerConnection: %v", err)
+	}
+	defer pc.Close()
+
+	_, err = pc.CreateDataChannel("test", nil)
+	if err != nil {
+		t.Fatalf("CreateDataChannel: %v", err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	err = pc.SetLocalDescription(offer)
+	if err != nil {
+		t.Fatalf("SetLocalDescription: %v", err)
+	}
+	select {
+	case <-gathered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Gathering timed out")
+	}
+
+	if !strings.Contains(pc.LocalDescription().SDP, "tcptype passive") {
+		t.Errorf("No passive TCP candidate in %v",
+			pc.LocalDescription().SDP)
 	}
 }
@@ -0,0 +1,156 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// addressFamily returns "ipv4" or "ipv6".
+func addressFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// checkNetwork checks the network options of a configuration.
+func (conf *Configuration) checkNetwork() error {
+	for _, p := range append(conf.AllowInterfaces, conf.DenyInterfaces...) {
+		_, err := path.Match(p, "")
+		if err != nil {
+			return fmt.Errorf("bad interface pattern %v", p)
+		}
+	}
+	families := append(
+		conf.AllowAddressFamilies, conf.DenyAddressFamilies...,
+	)
+	for _, f := range families {
+		if f != "ipv4" && f != "ipv6" {
+			return fmt.Errorf("unknown address family %v", f)
+		}
+	}
+	global := make(map[string]bool)
+	mapped := make(map[string]bool)
+	for _, a := range conf.PublicAddresses {
+		public, private, found := strings.Cut(a, "/")
+		ip := net.ParseIP(public)
+		if ip == nil {
+			return fmt.Errorf("bad public address %v", a)
+		}
+		family := addressFamily(ip)
+		if found {
+			ip2 := net.ParseIP(private)
+			if ip2 == nil || addressFamily(ip2) != family {
+				return fmt.Errorf("bad private address %v", a)
+			}
+			mapped[family] = true
+		} else {
+			if global[family] {
+				return errors.New(
+					"multiple public addresses " +
+						"without a private address",
+				)
+			}
+			global[family] = true
+		}
+		if global[family] && mapped[family] {
+			return errors.New(
+				"public address without a private address " +
+					"mixed with mapped addresses",
+			)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		ok, _ := path.Match(p, value)
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceAllowed returns true if the network interface with the given
+// name may be used for ICE.
+func (conf *Configuration) interfaceAllowed(name string) bool {
+	if len(conf.AllowInterfaces) > 0 &&
+		!matchAny(conf.AllowInterfaces, name) {
+		return false
+	}
+	return !matchAny(conf.DenyInterfaces, name)
+}
+
+// addressAllowed returns true if the given local address may be used for
+// ICE.
+func (conf *Configuration) addressAllowed(ip net.IP) bool {
+	family := addressFamily(ip)
+	if len(conf.AllowAddressFamilies) > 0 &&
+		!member(family, conf.AllowAddressFamilies) {
+		return false
+	}
+	return !member(family, conf.DenyAddressFamilies)
+}
+
+// publicAddress returns the public address that corresponds to the given
+// local address, or nil if it is not mapped.
+func (conf *Configuration) publicAddress(ip net.IP) net.IP {
+	for _, a := range conf.PublicAddresses {
+		public, private, found := strings.Cut(a, "/")
+		pub := net.ParseIP(public)
+		if pub == nil || addressFamily(pub) != addressFamily(ip) {
+			continue
+		}
+		if !found || net.ParseIP(private).Equal(ip) {
+			return pub
+		}
+	}
+	return nil
+}
+
+func getNetworkConfiguration() *Configuration {
+	conf, err := GetConfiguration()
+	if err != nil {
+		log.Printf("Read config.json: %v", err)
+		return &Configuration{}
+	}
+	return conf
+}
+
+// ICEAddressAllowed returns true if the local address ip of the network
+// interface ifname may be used for ICE, according to config.json.
+func ICEAddressAllowed(ifname string, ip net.IP) bool {
+	conf := getNetworkConfiguration()
+	return conf.interfaceAllowed(ifname) && conf.addressAllowed(ip)
+}
+
+// ICEPublicAddress returns the public address that corresponds to the
+// local address ip according to config.json, or nil if there is none.
+func ICEPublicAddress(ip net.IP) net.IP {
+	return getNetworkConfiguration().publicAddress(ip)
+}
+
+// configureNetwork applies the network options of the configuration to
+// a setting engine.
+func (conf *Configuration) configureNetwork(s *webrtc.SettingEngine) {
+	if len(conf.PublicAddresses) > 0 {
+		s.SetNAT1To1IPs(
+			conf.PublicAddresses, webrtc.ICECandidateTypeHost,
+		)
+	}
+	if len(conf.AllowInterfaces) > 0 || len(conf.DenyInterfaces) > 0 {
+		s.SetInterfaceFilter(conf.interfaceAllowed)
+	}
+	if len(conf.AllowAddressFamilies) > 0 ||
+		len(conf.DenyAddressFamilies) > 0 {
+		s.SetIPFilter(conf.addressAllowed)
+	}
+}
@@ -0,0 +1,107 @@
+package group
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCheckNetwork(t *testing.T) {
+	good := []Configuration{
+		{},
+		{PublicAddresses: []string{"203.0.113.1"}},
+		{PublicAddresses: []string{"203.0.113.1", "2001:db8::1"}},
+		{PublicAddresses: []string{
+			"203.0.113.1/10.0.0.1", "203.0.113.2/10.0.0.2",
+		}},
+		{AllowInterfaces: []string{"eth*"}},
+		{DenyAddressFamilies: []string{"ipv6"}},
+	}
+	for _, conf := range good {
+		err := conf.checkNetwork()
+		if err != nil {
+			t.Errorf("%v: %v", conf, err)
+		}
+	}
+
+	bad := []Configuration{
+		{PublicAddresses: []string{"galene.org"}},
+		{PublicAddresses: []string{"203.0.113.1/2001:db8::1"}},
+		{PublicAddresses: []string{"203.0.113.1", "203.0.113.2"}},
+		{PublicAddresses: []string{
+			"203.0.113.1", "203.0.113.2/10.0.0.2",
+		}},
+		{DenyInterfaces: []string{"eth["}},
+		{AllowAddressFamilies: []string{"ipx"}},
+	}
+	for _, conf := range bad {
+		err := conf.checkNetwork()
+		if err == nil {
+			t.Errorf("%v: no error", conf)
+		}
+	}
+}
+
+func TestInterfaceAllowed(t *testing.T) {
+	conf := Configuration{
+		AllowInterfaces: []string{"eth*", "wlan0"},
+		DenyInterfaces:  []string{"eth1"},
+	}
+	tests := map[string]bool{
+		"eth0":    true,
+		"eth1":    false,
+		"wlan0":   true,
+		"docker0": false,
+	}
+	for name, allowed := range tests {
+		if conf.interfaceAllowed(name) != allowed {
+			t.Errorf("%v: expected %v", name, allowed)
+		}
+	}
+
+	conf = Configuration{DenyInterfaces: []string{"docker*", "veth*"}}
+	if !conf.interfaceAllowed("eth0") || conf.interfaceAllowed("veth42") {
+		t.Errorf("Deny list failed")
+	}
+}
+
+func TestAddressAllowed(t *testing.T) {
+	ip4 := net.ParseIP("192.0.2.1")
+	ip6 := net.ParseIP("2001:db8::1")
+
+	conf := Configuration{}
+	if !conf.addressAllowed(ip4) || !conf.addressAllowed(ip6) {
+		t.Errorf("Empty configuration failed")
+	}
+	conf = Configuration{DenyAddressFamilies: []string{"ipv6"}}
+	if !conf.addressAllowed(ip4) || conf.addressAllowed(ip6) {
+		t.Errorf("Deny list failed")
+	}
+	conf = Configuration{AllowAddressFamilies: []string{"ipv6"}}
+	if conf.addressAllowed(ip4) || !conf.addressAllowed(ip6) {
+		t.Errorf("Allow list failed")
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	conf := Configuration{
+		PublicAddresses: []string{
+			"203.0.113.1/10.0.0.1", "2001:db8::1",
+		},
+	}
+	tests := []struct{ local, public string }{
+		{"10.0.0.1", "203.0.113.1"},
+		{"10.0.0.2", ""},
+		{"fd00::1", "2001:db8::1"},
+	}
+	for _, test := range tests {
+		p := conf.publicAddress(net.ParseIP(test.local))
+		if test.public == "" {
+			if p != nil {
+				t.Errorf("%v: got %v, expected nil", test.local, p)
+			}
+		} else if !p.Equal(net.ParseIP(test.public)) {
+			t.Errorf("%v: got %v, expected %v",
+				test.local, p, test.public)
+		}
+	}
+}
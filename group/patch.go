@@ -0,0 +1,151 @@
+package group
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// mergePatch applies a JSON merge patch, as defined in RFC 7396, to
+// a decoded JSON value.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// patchJSON applies a JSON merge patch to the JSON representation of
+// value, and decodes the result into a fresh value of the same type.
+func patchJSON[T any](value *T, patch []byte) (*T, error) {
+	var p any
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, UserError(fmt.Sprintf("bad patch: %v", err))
+	}
+
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var t any
+	err = json.Unmarshal(v, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = json.Marshal(mergePatch(t, p))
+	if err != nil {
+		return nil, err
+	}
+	var result T
+	d := json.NewDecoder(bytes.NewReader(v))
+	d.DisallowUnknownFields()
+	err = d.Decode(&result)
+	if err != nil {
+		return nil, UserError(fmt.Sprintf("bad patch: %v", err))
+	}
+	return &result, nil
+}
+
+// PatchDescription applies a JSON merge patch to a sanitised description.
+// If etag is not empty, the patch is only applied if it matches.
+func PatchDescription(name, etag string, patch []byte) error {
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	old, err := readDescription(name, false)
+	if err != nil {
+		return err
+	}
+	if etag != "" && etag != makeETag(old.fileSize, old.modTime) {
+		return ErrTagMismatch
+	}
+
+	desc := *old
+	desc.Users = nil
+	desc.WildcardUser = nil
+	desc.AuthKeys = nil
+	newdesc, err := patchJSON(&desc, patch)
+	if err != nil {
+		return err
+	}
+	newdesc.FileName = old.FileName
+	err = upgradeDescription(newdesc)
+	if err != nil {
+		return err
+	}
+	if newdesc.Users != nil || newdesc.WildcardUser != nil ||
+		newdesc.AuthKeys != nil {
+		return UserError("cannot patch users or keys")
+	}
+
+	newdesc.Users = old.Users
+	newdesc.WildcardUser = old.WildcardUser
+	newdesc.AuthKeys = old.AuthKeys
+	return rewriteDescriptionFile(old.FileName, newdesc)
+}
+
+// PatchUser applies a JSON merge patch to a sanitised user description.
+// If etag is not empty, the patch is only applied if it matches.
+func PatchUser(group, username string, wildcard bool, etag string, patch []byte) error {
+	if wildcard && username != "" {
+		return UserError("wildcard with username")
+	}
+
+	groups.mu.Lock()
+	defer groups.mu.Unlock()
+
+	desc, err := readDescription(group, false)
+	if err != nil {
+		return err
+	}
+	if etag != "" && etag != makeETag(desc.fileSize, desc.modTime) {
+		return ErrTagMismatch
+	}
+
+	var old UserDescription
+	if wildcard {
+		if desc.WildcardUser == nil {
+			return os.ErrNotExist
+		}
+		old = *desc.WildcardUser
+	} else {
+		var ok bool
+		old, ok = desc.Users[username]
+		if !ok {
+			return os.ErrNotExist
+		}
+	}
+
+	user := old
+	user.Password = Password{}
+	newuser, err := patchJSON(&user, patch)
+	if err != nil {
+		return err
+	}
+	if newuser.Password.Type != "" || newuser.Password.Key != nil {
+		return UserError("cannot patch password")
+	}
+	newuser.Password = old.Password
+
+	if wildcard {
+		desc.WildcardUser = newuser
+	} else {
+		desc.Users[username] = *newuser
+	}
+	return rewriteDescriptionFile(desc.FileName, desc)
+}
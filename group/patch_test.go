@@ -0,0 +1,209 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// the examples from RFC 7396 Appendix A
+var mergePatchTests = []struct{ target, patch, result string }{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, test := range mergePatchTests {
+		var target, patch, result any
+		err := json.Unmarshal([]byte(test.target), &target)
+		if err == nil {
+			err = json.Unmarshal([]byte(test.patch), &patch)
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(test.result), &result)
+		}
+		if err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		r := mergePatch(target, patch)
+		if !reflect.DeepEqual(r, result) {
+			t.Errorf("%v + %v: got %v, expected %v",
+				test.target, test.patch, r, test.result,
+			)
+		}
+	}
+}
+
+func TestPatchDescription(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("setupTest: %v", err)
+	}
+
+	err = PatchDescription("test", "", []byte(`{}`))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PatchDescription: got %v, expected ErrNotExist", err)
+	}
+
+	err = UpdateDescription("test", "", &Description{
+		DisplayName: "Test", Contact: "jch",
+	})
+	if err != nil {
+		t.Fatalf("UpdateDescription: %v", err)
+	}
+	err = UpdateUser("test", "jch", false, "", &UserDescription{
+		Permissions: Permissions{name: "op"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	err = SetUserPassword("test", "jch", false, Password{
+		Type: "plain", Key: new(string),
+	})
+	if err != nil {
+		t.Fatalf("SetUserPassword: %v", err)
+	}
+
+	err = PatchDescription("test", "\"badetag\"", []byte(`{}`))
+	if !errors.Is(err, ErrTagMismatch) {
+		t.Errorf("PatchDescription: got %v, expected ErrTagMismatch",
+			err)
+	}
+
+	_, etag, err := GetSanitisedDescription("test")
+	if err != nil {
+		t.Fatalf("GetSanitisedDescription: %v", err)
+	}
+	err = PatchDescription("test", etag,
+		[]byte(`{"contact": null, "public": true, "max-clients": 10}`),
+	)
+	if err != nil {
+		t.Errorf("PatchDescription: %v", err)
+	}
+
+	desc, err := GetDescription("test")
+	if err != nil {
+		t.Fatalf("GetDescription: %v", err)
+	}
+	if desc.DisplayName != "Test" || desc.Contact != "" ||
+		!desc.Public || desc.MaxClients != 10 {
+		t.Errorf("Bad description %#v", desc)
+	}
+	if u, ok := desc.Users["jch"]; !ok || u.Password.Type != "plain" {
+		t.Errorf("User was not preserved: %#v", desc.Users)
+	}
+
+	bad := []string{
+		`{"users": {"vimes": {"permissions": "op"}}}`,
+		`{"op": [{"username": "vimes"}]}`,
+		`{"authKeys": []}`,
+		`{"unknown-field": true}`,
+		`{"max-clients": "ten"}`,
+		`not json`,
+	}
+	for _, p := range bad {
+		err = PatchDescription("test", "", []byte(p))
+		var usererr UserError
+		if !errors.As(err, &usererr) {
+			t.Errorf("PatchDescription %v: got %v, "+
+				"expected UserError", p, err)
+		}
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("setupTest: %v", err)
+	}
+
+	err = UpdateDescription("test", "", &Description{})
+	if err != nil {
+		t.Fatalf("UpdateDescription: %v", err)
+	}
+
+	for _, wildcard := range []bool{false, true} {
+		username := "jch"
+		if wildcard {
+			username = ""
+		}
+		err = PatchUser("test", username, wildcard, "",
+			[]byte(`{"permissions": "present"}`),
+		)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("PatchUser: got %v, expected ErrNotExist",
+				err)
+		}
+
+		err = UpdateUser("test", username, wildcard, "",
+			&UserDescription{
+				Permissions: Permissions{name: "observe"},
+			},
+		)
+		if err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+		err = SetUserPassword("test", username, wildcard, Password{
+			Type: "wildcard",
+		})
+		if err != nil {
+			t.Fatalf("SetUserPassword: %v", err)
+		}
+
+		_, etag, err := GetSanitisedUser("test", username, wildcard)
+		if err != nil {
+			t.Fatalf("GetSanitisedUser: %v", err)
+		}
+		err = PatchUser("test", username, wildcard, etag,
+			[]byte(`{"permissions": "present"}`),
+		)
+		if err != nil {
+			t.Errorf("PatchUser: %v", err)
+		}
+
+		err = PatchUser("test", username, wildcard, etag,
+			[]byte(`{"permissions": "op"}`),
+		)
+		if !errors.Is(err, ErrTagMismatch) {
+			t.Errorf("PatchUser: got %v, expected ErrTagMismatch",
+				err)
+		}
+
+		err = PatchUser("test", username, wildcard, "",
+			[]byte(`{"password": "secret"}`),
+		)
+		var usererr UserError
+		if !errors.As(err, &usererr) {
+			t.Errorf("PatchUser: got %v, expected UserError", err)
+		}
+
+		desc, err := GetDescription("test")
+		if err != nil {
+			t.Fatalf("GetDescription: %v", err)
+		}
+		u := desc.WildcardUser
+		if !wildcard {
+			uu := desc.Users[username]
+			u = &uu
+		}
+		if u.Permissions.name != "present" ||
+			u.Password.Type != "wildcard" {
+			t.Errorf("Bad user %#v", u)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package group
+
+import (
+	"fmt"
+)
+
+// A Role is a named set of permissions defined in a group description or
+// in the configuration file.  If the flags are set, they override the
+// group options of the same name for the users with this role.
+type Role struct {
+	Permissions        []string `json:"permissions"`
+	AllowRecording     *bool    `json:"allow-recording,omitempty"`
+	UnrestrictedTokens *bool    `json:"unrestricted-tokens,omitempty"`
+}
+
+// rawPermissions are the permissions that may not be used as role names,
+// since they would be ambiguous in a list of permissions.
+var rawPermissions = []string{"op", "present", "message", "caption",
+	"token", "record", "admin", "system",
+	"present-audio", "present-camera", "present-screenshare",
+}
+
+// validRoleName returns true if name may be used for a custom role.
+func validRoleName(name string) bool {
+	if name == "" || member(name, rawPermissions) {
+		return false
+	}
+	_, builtin := permissionsMap[name]
+	return !builtin
+}
+
+// getRole returns the named role, looking first at the built-in roles,
+// then at the roles defined in desc, then at the ones defined in the
+// configuration file.
+func getRole(desc *Description, name string) (Role, bool) {
+	perms, ok := permissionsMap[name]
+	if ok {
+		return Role{Permissions: perms}, true
+	}
+	if desc != nil {
+		role, ok := desc.Roles[name]
+		if ok {
+			return role, true
+		}
+	}
+	conf, err := GetConfiguration()
+	if err == nil {
+		role, ok := conf.Roles[name]
+		if ok {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// checkRoleNames checks that the names of custom roles don't collide
+// with built-in ones, and that their permissions are either raw
+// permissions or the names of built-in roles.
+func checkRoleNames(roles map[string]Role) error {
+	for name, role := range roles {
+		if !validRoleName(name) {
+			return fmt.Errorf("bad role name %v", name)
+		}
+		for _, p := range role.Permissions {
+			_, builtin := permissionsMap[p]
+			if !builtin && !member(p, rawPermissions) {
+				return fmt.Errorf(
+					"role %v: unknown permission %v",
+					name, p,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns an error if p refers to a role that is defined neither in
+// desc nor in the configuration file.
+func (p Permissions) Check(desc *Description) error {
+	if p.name == "" {
+		return nil
+	}
+	_, ok := getRole(desc, p.name)
+	if !ok {
+		return fmt.Errorf("%w %v", ErrUnknownPermission, p.name)
+	}
+	return nil
+}
+
+// checkRoles checks that the roles of a description are well-formed, and
+// that all users refer to existing roles.
+func (desc *Description) checkRoles() error {
+	err := checkRoleNames(desc.Roles)
+	if err != nil {
+		return UserError(err.Error())
+	}
+	for _, u := range desc.Users {
+		err := u.Permissions.Check(desc)
+		if err != nil {
+			return err
+		}
+	}
+	if desc.WildcardUser != nil {
+		return desc.WildcardUser.Permissions.Check(desc)
+	}
+	return nil
+}
+
+// checkRoles checks that the roles of the configuration are well-formed,
+// and that all administrators refer to existing roles.
+func (conf *Configuration) checkRoles() error {
+	err := checkRoleNames(conf.Roles)
+	if err != nil {
+		return UserError(err.Error())
+	}
+	for _, u := range conf.Users {
+		name := u.Permissions.name
+		if name == "" {
+			continue
+		}
+		_, builtin := permissionsMap[name]
+		_, custom := conf.Roles[name]
+		if !builtin && !custom {
+			return fmt.Errorf("%w %v", ErrUnknownPermission, name)
+		}
+	}
+	return nil
+}
+
+// ExpandRoles replaces the names of custom roles in a list of
+// permissions, such as the one in a token, with the corresponding
+// permissions.  Other permissions are left unchanged.
+func (desc *Description) ExpandRoles(perms []string) []string {
+	result := make([]string, 0, len(perms))
+	for _, p := range perms {
+		pp := []string{p}
+		if validRoleName(p) {
+			if _, ok := getRole(desc, p); ok {
+				pp = Permissions{name: p}.Permissions(desc)
+			}
+		}
+		for _, q := range pp {
+			if !member(q, result) {
+				result = append(result, q)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("setupTest: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(DataDirectory, "config.json"),
+		[]byte(`{"writableGroups": true, "roles": {
+                    "speaker": {"permissions": ["present"]}
+                }}`), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(Directory, "test.json"),
+		[]byte(`{"allow-recording": true, "roles": {
+                    "moderator": {"permissions": ["op", "message"]},
+                    "speaker": {"permissions": ["present", "message"]}
+                }, "users": {
+                    "jch": {"password": "pw", "permissions": "moderator"}
+                }, "wildcard-user": {
+                    "password": {"type": "wildcard"},
+                    "permissions": "speaker"
+                }}`), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(Directory, "test2.json"),
+		[]byte(`{"users": {
+                    "jch": {"password": "pw", "permissions": "speaker"}
+                }}`), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	desc, err := GetDescription("test")
+	if err != nil {
+		t.Fatalf("GetDescription: %v", err)
+	}
+	p := desc.Users["jch"].Permissions.Permissions(desc)
+	if !permissionsEqual(p, []string{"record", "op", "message"}) {
+		t.Errorf("moderator: got %v", p)
+	}
+	// roles in the group override the ones in config.json
+	p = desc.WildcardUser.Permissions.Permissions(desc)
+	if !permissionsEqual(p, []string{"present", "message"}) {
+		t.Errorf("speaker: got %v", p)
+	}
+
+	// results may be modified by the caller
+	p[0] = "admin"
+	p = desc.WildcardUser.Permissions.Permissions(desc)
+	if !permissionsEqual(p, []string{"present", "message"}) {
+		t.Errorf("speaker after modification: got %v", p)
+	}
+
+	desc2, err := GetDescription("test2")
+	if err != nil {
+		t.Fatalf("GetDescription: %v", err)
+	}
+	p = desc2.Users["jch"].Permissions.Permissions(desc2)
+	if !permissionsEqual(p, []string{"present"}) {
+		t.Errorf("speaker from config: got %v", p)
+	}
+
+	p = desc.ExpandRoles([]string{"moderator", "message", "unknown"})
+	if !permissionsEqual(p, []string{"record", "op", "message", "unknown"}) {
+		t.Errorf("ExpandRoles: got %v", p)
+	}
+	p = desc2.ExpandRoles([]string{"op", "speaker"})
+	if !permissionsEqual(p, []string{"op", "present"}) {
+		t.Errorf("ExpandRoles: got %v", p)
+	}
+
+	err = UpdateUser("test2", "john", false, "", &UserDescription{
+		Permissions: Permissions{name: "moderator"},
+	})
+	if !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("UpdateUser: got %v, expected ErrUnknownPermission",
+			err)
+	}
+
+	err = PatchDescription("test", "", []byte(`{"roles": null}`))
+	if !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("PatchDescription: got %v, "+
+			"expected ErrUnknownPermission", err)
+	}
+}
+
+func TestRoleFlags(t *testing.T) {
+	var desc Description
+	err := json.Unmarshal([]byte(`{
+            "allow-recording": true,
+            "roles": {
+                "moderator": {
+                    "permissions": ["op", "message"],
+                    "allow-recording": false
+                },
+                "recorder": {
+                    "permissions": ["op", "present"],
+                    "unrestricted-tokens": true
+                }
+            }
+        }`), &desc)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	tests := []struct {
+		role  string
+		perms []string
+	}{
+		{"moderator", []string{"op", "message"}},
+		{"recorder", []string{"token", "record", "op", "present"}},
+		{"op", []string{"record", "op", "present", "message", "caption",
+			"token"}},
+	}
+	for _, test := range tests {
+		p := Permissions{name: test.role}.Permissions(&desc)
+		if !permissionsEqual(p, test.perms) {
+			t.Errorf("%v: got %v, expected %v",
+				test.role, p, test.perms)
+		}
+	}
+
+	p := desc.ExpandRoles([]string{"recorder"})
+	if !permissionsEqual(p, tests[1].perms) {
+		t.Errorf("ExpandRoles: got %v", p)
+	}
+}
+
+func TestBadRoles(t *testing.T) {
+	bad := []string{
+		`{"roles": {"op": {"permissions": ["present"]}}}`,
+		`{"roles": {"record": {"permissions": ["present"]}}}`,
+		`{"roles": {"": {"permissions": ["present"]}}}`,
+		`{"users": {"jch": {"permissions": "moderator"}}}`,
+		`{"roles": {"moderator": {"permissions": ["op", "moderate"]}}}`,
+		`{"roles": {"speaker": {"permissions": ["moderator"]}},
+                  "users": {"jch": {"permissions": "speaker"}}}`,
+	}
+	for _, j := range bad {
+		var d Description
+		err := json.Unmarshal([]byte(j), &d)
+		if err == nil {
+			err = d.checkRoles()
+		}
+		if err == nil {
+			t.Errorf("%v: no error", j)
+		}
+	}
+
+	var d Description
+	err := json.Unmarshal(
+		[]byte(`{"users": {"jch": {"permissions": "token"}}}`), &d,
+	)
+	if !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("Unmarshal: got %v, expected ErrUnknownPermission",
+			err)
+	}
+}
@@ -0,0 +1,204 @@
+package group
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// audio levels, in -dBov, above which we consider a client silent
+	speakerSilence = 60
+	// how long a client must be the loudest before becoming the
+	// dominant speaker
+	speakerSwitchDelay = 500 * time.Millisecond
+	// how long we wait before reconsidering our choice
+	speakerInterval = 100 * time.Millisecond
+	// how long before a client that hasn't sent any levels is
+	// considered silent.  This accounts for DTX.
+	speakerTimeout = time.Second
+	// the smoothed activity below which a client is considered silent
+	speakerMinActivity = 3 << 8
+)
+
+type speakerLevel struct {
+	// smoothed activity in dB above silence, in units of 1/256 dB
+	activity int
+	time     time.Time
+}
+
+// A speakerDetector maintains a smoothed estimate of the dominant speaker
+// from the audio levels carried in the RFC 6464 header extension.
+type speakerDetector struct {
+	mu        sync.Mutex
+	levels    map[string]*speakerLevel
+	recent    []string
+	current   string
+	candidate string
+	since     time.Time
+	decided   time.Time
+}
+
+// accumulate records an audio level, in -dBov, for client id.  It returns
+// true if the dominant speaker has changed.
+func (d *speakerDetector) accumulate(id string, level uint8, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.levels == nil {
+		d.levels = make(map[string]*speakerLevel)
+	}
+	l := d.levels[id]
+	if l == nil {
+		l = &speakerLevel{}
+		d.levels[id] = l
+	}
+
+	activity := 0
+	if level < speakerSilence {
+		activity = (speakerSilence - int(level)) << 8
+	}
+	if now.Sub(l.time) > speakerTimeout {
+		l.activity = activity
+	} else {
+		// exponential smoothing with a factor of 1/8, about
+		// 160ms with 20ms frames
+		l.activity += (activity - l.activity) / 8
+	}
+	l.time = now
+
+	if now.Sub(d.decided) < speakerInterval {
+		return false
+	}
+	return d.decide(now)
+}
+
+// remove forgets about client id.  It returns true if the dominant speaker
+// has changed.
+func (d *speakerDetector) remove(id string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.levels, id)
+	for i, r := range d.recent {
+		if r == id {
+			d.recent = append(d.recent[:i], d.recent[i+1:]...)
+			break
+		}
+	}
+	if d.candidate == id {
+		d.candidate = ""
+	}
+	if d.current != id {
+		return false
+	}
+	d.current = ""
+	d.decide(now)
+	return true
+}
+
+// called locked
+func (d *speakerDetector) decide(now time.Time) bool {
+	d.decided = now
+
+	loudest := ""
+	max := speakerMinActivity - 1
+	for id, l := range d.levels {
+		if now.Sub(l.time) > speakerTimeout {
+			l.activity = 0
+		}
+		if l.activity > max {
+			loudest = id
+			max = l.activity
+		}
+	}
+
+	// if everyone is silent, keep the last speaker
+	if loudest == "" || loudest == d.current {
+		d.candidate = ""
+		return false
+	}
+
+	if d.current != "" {
+		cur := d.levels[d.current]
+		if cur != nil && cur.activity >= speakerMinActivity {
+			// hysteresis: only switch away from an active speaker
+			// if the new one is louder by 6dB
+			if max < cur.activity+(6<<8) {
+				d.candidate = ""
+				return false
+			}
+		}
+	}
+
+	if d.candidate != loudest {
+		d.candidate = loudest
+		d.since = now
+	}
+
+	if now.Sub(d.since) < speakerSwitchDelay {
+		return false
+	}
+
+	d.current = loudest
+	d.candidate = ""
+	for i, r := range d.recent {
+		if r == loudest {
+			d.recent = append(d.recent[:i], d.recent[i+1:]...)
+			break
+		}
+	}
+	d.recent = append([]string{loudest}, d.recent...)
+	return true
+}
+
+func (d *speakerDetector) get() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.current
+}
+
+func (d *speakerDetector) getRecent() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.recent...)
+}
+
+type speakerNotifier interface {
+	ActiveSpeaker(group, id string) error
+}
+
+// ActiveSpeaker returns the id of the client that was most recently the
+// dominant speaker, or the empty string if nobody has spoken yet.
+func (g *Group) ActiveSpeaker() string {
+	return g.speakers.get()
+}
+
+// RecentSpeakers returns the ids of the clients that have been the
+// dominant speaker, most recent first.
+func (g *Group) RecentSpeakers() []string {
+	return g.speakers.getRecent()
+}
+
+// GotAudioLevel records an audio level, in -dBov, as carried by the
+// ssrc-audio-level header extension of a track published by client id.
+// We ignore the voice activity flag, which is not set by all senders.
+func (g *Group) GotAudioLevel(id string, level uint8) {
+	if g.speakers.accumulate(id, level, time.Now()) {
+		g.notifySpeaker()
+	}
+}
+
+func (g *Group) notifySpeaker() {
+	id := g.speakers.get()
+	clients := g.GetClients(nil)
+	for _, c := range clients {
+		n, ok := c.(speakerNotifier)
+		if !ok {
+			continue
+		}
+		err := n.ActiveSpeaker(g.Name(), id)
+		if err != nil {
+			log.Printf("ActiveSpeaker: %v", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package group
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpeakerDetector(t *testing.T) {
+	var d speakerDetector
+	now := time.Now()
+
+	run := func(levels map[string]uint8, duration time.Duration) bool {
+		changed := false
+		end := now.Add(duration)
+		for now.Before(end) {
+			for id, l := range levels {
+				if d.accumulate(id, l, now) {
+					changed = true
+				}
+			}
+			now = now.Add(20 * time.Millisecond)
+		}
+		return changed
+	}
+
+	if run(map[string]uint8{"a": 127, "b": 127}, time.Second) {
+		t.Errorf("Silence changed speaker")
+	}
+	if d.get() != "" {
+		t.Errorf("Expected no speaker, got %v", d.get())
+	}
+
+	if !run(map[string]uint8{"a": 20, "b": 127}, time.Second) {
+		t.Errorf("Speaker didn't change")
+	}
+	if d.get() != "a" {
+		t.Errorf("Expected a, got %v", d.get())
+	}
+
+	// a short interjection should not switch
+	if run(map[string]uint8{"a": 127, "b": 20}, 200*time.Millisecond) {
+		t.Errorf("Short interjection changed speaker")
+	}
+
+	// b takes over
+	run(map[string]uint8{"a": 127, "b": 20}, time.Second)
+	if d.get() != "b" {
+		t.Errorf("Expected b, got %v", d.get())
+	}
+
+	// silence keeps the last speaker
+	if run(map[string]uint8{"a": 127, "b": 127}, 2*time.Second) {
+		t.Errorf("Silence changed speaker")
+	}
+	if d.get() != "b" {
+		t.Errorf("Expected b, got %v", d.get())
+	}
+
+	// a speaker only slightly louder doesn't interrupt
+	run(map[string]uint8{"a": 20, "b": 22}, 2*time.Second)
+	if d.get() != "b" {
+		t.Errorf("Expected b, got %v", d.get())
+	}
+
+	recent := d.getRecent()
+	if len(recent) != 2 || recent[0] != "b" || recent[1] != "a" {
+		t.Errorf("Expected [b a], got %v", recent)
+	}
+
+	if !d.remove("b", now) {
+		t.Errorf("Removing speaker didn't change speaker")
+	}
+	if d.get() != "" {
+		t.Errorf("Expected no speaker, got %v", d.get())
+	}
+	if d.remove("a", now) {
+		t.Errorf("Removing non-speaker changed speaker")
+	}
+	if len(d.getRecent()) != 0 {
+		t.Errorf("Expected no recent speakers, got %v", d.getRecent())
+	}
+}
@@ -0,0 +1,207 @@
+package ice
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/stats"
+)
+
+// ProbeInterval is the interval between two health checks of the TURN
+// servers in the configuration file.
+var ProbeInterval = 5 * time.Minute
+
+const (
+	// the timeout of a single health check
+	probeTimeout = 20 * time.Second
+	// the number of consecutive failures after which a server is
+	// considered unhealthy
+	maxFailures = 3
+	// the number of health checks remembered for each server
+	historySize = 16
+)
+
+// HealthCheck is the result of a single health check.
+type HealthCheck struct {
+	Time    time.Time      `json:"time"`
+	Latency stats.Duration `json:"latency,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// ServerHealth is the health of a TURN server.
+type ServerHealth struct {
+	URLs                []string       `json:"urls"`
+	Healthy             bool           `json:"healthy"`
+	Successes           uint64         `json:"successes"`
+	Failures            uint64         `json:"failures"`
+	ConsecutiveFailures int            `json:"consecutiveFailures"`
+	Latency             stats.Duration `json:"latency,omitempty"`
+	History             []HealthCheck  `json:"history,omitempty"`
+}
+
+var health struct {
+	mu      sync.Mutex
+	servers map[string]*ServerHealth
+}
+
+func serverKey(s webrtc.ICEServer) string {
+	return strings.Join(s.URLs, " ")
+}
+
+// isRelay returns true if s is a TURN server.
+func isRelay(s webrtc.ICEServer) bool {
+	for _, u := range s.URLs {
+		if strings.HasPrefix(u, "turn:") ||
+			strings.HasPrefix(u, "turns:") {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCheck records the result of a health check of s.  It returns
+// true if the server's health changed.
+func recordCheck(s webrtc.ICEServer, latency time.Duration, err error, now time.Time) bool {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	if health.servers == nil {
+		health.servers = make(map[string]*ServerHealth)
+	}
+	key := serverKey(s)
+	h := health.servers[key]
+	if h == nil {
+		h = &ServerHealth{URLs: s.URLs, Healthy: true}
+		health.servers[key] = h
+	}
+
+	check := HealthCheck{Time: now}
+	if err != nil {
+		check.Error = err.Error()
+		h.Failures++
+		h.ConsecutiveFailures++
+	} else {
+		check.Latency = stats.Duration(latency)
+		h.Latency = check.Latency
+		h.Successes++
+		h.ConsecutiveFailures = 0
+	}
+	h.History = append(h.History, check)
+	if len(h.History) > historySize {
+		h.History = h.History[len(h.History)-historySize:]
+	}
+
+	healthy := h.ConsecutiveFailures < maxFailures
+	changed := healthy != h.Healthy
+	h.Healthy = healthy
+	return changed
+}
+
+// pruneHealth discards the health of servers that are no longer
+// configured.
+func pruneHealth(servers []webrtc.ICEServer) {
+	keys := make(map[string]bool)
+	for _, s := range servers {
+		keys[serverKey(s)] = true
+	}
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	for k := range health.servers {
+		if !keys[k] {
+			delete(health.servers, k)
+		}
+	}
+}
+
+// healthyServers returns the servers that are not known to be failing.
+// If all TURN servers are failing, it returns all servers.
+func healthyServers(servers []webrtc.ICEServer) []webrtc.ICEServer {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	var result []webrtc.ICEServer
+	relays := false
+	for _, s := range servers {
+		if !isRelay(s) {
+			result = append(result, s)
+			continue
+		}
+		h := health.servers[serverKey(s)]
+		if h == nil || h.Healthy {
+			result = append(result, s)
+			relays = true
+		}
+	}
+	if !relays {
+		return servers
+	}
+	return result
+}
+
+// Health returns the health of the TURN servers in the configuration
+// file, in the order in which they are configured.
+func Health() []ServerHealth {
+	servers := getConfiguration().servers
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	result := make([]ServerHealth, 0, len(servers))
+	for _, s := range servers {
+		if !isRelay(s) {
+			continue
+		}
+		h := health.servers[serverKey(s)]
+		if h == nil {
+			result = append(result, ServerHealth{
+				URLs: s.URLs, Healthy: true,
+			})
+			continue
+		}
+		hh := *h
+		hh.History = append([]HealthCheck(nil), h.History...)
+		result = append(result, hh)
+	}
+	return result
+}
+
+// probe checks all TURN servers in the configuration file, and updates
+// the configuration if the health of any of them changed.
+func probe() {
+	servers := getConfiguration().servers
+	changed := false
+	for _, s := range servers {
+		if !isRelay(s) {
+			continue
+		}
+		conf := webrtc.Configuration{ICEServers: []webrtc.ICEServer{s}}
+		latency, err := relayTest(&conf, probeTimeout)
+		if recordCheck(s, latency, err, time.Now()) {
+			changed = true
+			if err != nil {
+				log.Printf("TURN server %v is failing: %v",
+					s.URLs, err)
+			} else {
+				log.Printf("TURN server %v is working again",
+					s.URLs)
+			}
+		}
+	}
+	pruneHealth(servers)
+	if changed {
+		Update()
+	}
+}
+
+// Prober periodically checks the health of the TURN servers in the
+// configuration file.  It never returns.
+func Prober() {
+	for {
+		probe()
+		time.Sleep(ProbeInterval)
+	}
+}
@@ -0,0 +1,71 @@
+package ice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestHealth(t *testing.T) {
+	stun := webrtc.ICEServer{URLs: []string{"stun:stun.example.org"}}
+	turn1 := webrtc.ICEServer{URLs: []string{"turn:turn1.example.org"}}
+	turn2 := webrtc.ICEServer{URLs: []string{"turns:turn2.example.org"}}
+	servers := []webrtc.ICEServer{stun, turn1, turn2}
+	defer pruneHealth(nil)
+
+	now := time.Now()
+	if recordCheck(turn1, 10*time.Millisecond, nil, now) {
+		t.Errorf("Health changed after success")
+	}
+	failure := errors.New("failed")
+	for i := 0; i < maxFailures; i++ {
+		changed := recordCheck(turn2, 0, failure, now)
+		if changed != (i == maxFailures-1) {
+			t.Errorf("Failure %v: changed is %v", i, changed)
+		}
+	}
+
+	healthy := healthyServers(servers)
+	if len(healthy) != 2 ||
+		serverKey(healthy[0]) != serverKey(stun) ||
+		serverKey(healthy[1]) != serverKey(turn1) {
+		t.Errorf("Expected stun and turn1, got %v", healthy)
+	}
+
+	for i := 0; i < maxFailures; i++ {
+		recordCheck(turn1, 0, failure, now)
+	}
+	healthy = healthyServers(servers)
+	if len(healthy) != len(servers) {
+		t.Errorf("All relays failing, got %v", healthy)
+	}
+
+	if !recordCheck(turn2, 20*time.Millisecond, nil, now) {
+		t.Errorf("Health didn't change after recovery")
+	}
+	healthy = healthyServers(servers)
+	if len(healthy) != 2 || serverKey(healthy[1]) != serverKey(turn2) {
+		t.Errorf("Expected stun and turn2, got %v", healthy)
+	}
+
+	for i := 0; i < 2*historySize; i++ {
+		recordCheck(turn2, time.Millisecond, nil, now)
+	}
+	health.mu.Lock()
+	h := health.servers[serverKey(turn2)]
+	if len(h.History) != historySize ||
+		h.Successes != 2*historySize+1 ||
+		h.Failures != maxFailures {
+		t.Errorf("Bad history: %v", h)
+	}
+	health.mu.Unlock()
+
+	pruneHealth([]webrtc.ICEServer{turn1})
+	health.mu.Lock()
+	if len(health.servers) != 1 {
+		t.Errorf("Expected 1 server, got %v", len(health.servers))
+	}
+	health.mu.Unlock()
+}
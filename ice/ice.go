@@ -82,6 +82,10 @@ var ICERelayOnly bool
 type configuration struct {
 	conf      webrtc.Configuration
 	timestamp time.Time
+	// the number of servers that don't belong to the built-in server
+	external int
+	// the servers in the configuration file, including unhealthy ones
+	servers []webrtc.ICEServer
 }
 
 var conf atomic.Value
@@ -124,6 +128,9 @@ func Update() *configuration {
 		log.Printf("TURN: %v", err)
 	}
 
+	servers := cf.ICEServers
+	cf.ICEServers = healthyServers(servers)
+	external := len(cf.ICEServers)
 	cf.ICEServers = append(cf.ICEServers, turnserver.ICEServers()...)
 
 	if ICERelayOnly {
@@ -133,25 +140,50 @@ func Update() *configuration {
 	iceConf := configuration{
 		conf:      cf,
 		timestamp: now,
+		external:  external,
+		servers:   servers,
 	}
 	conf.Store(&iceConf)
 	return &iceConf
 }
 
-func ICEConfiguration() *webrtc.Configuration {
+func getConfiguration() *configuration {
 	conf, ok := conf.Load().(*configuration)
 	if !ok || time.Since(conf.timestamp) > 5*time.Minute {
 		conf = Update()
 	} else if time.Since(conf.timestamp) > 2*time.Minute {
 		go Update()
 	}
+	return conf
+}
 
-	return &conf.conf
+func ICEConfiguration() *webrtc.Configuration {
+	return &getConfiguration().conf
+}
+
+// ClientConfiguration returns the ICE configuration to be sent to a
+// client, with credentials for the built-in TURN server that are specific
+// to the client with the given id.
+func ClientConfiguration(id string) *webrtc.Configuration {
+	conf := getConfiguration()
+	if len(conf.conf.ICEServers) == conf.external {
+		return &conf.conf
+	}
+	cf := conf.conf
+	cf.ICEServers = append(
+		cf.ICEServers[:conf.external:conf.external],
+		turnserver.ClientICEServers(id)...,
+	)
+	return &cf
 }
 
 func RelayTest(timeout time.Duration) (time.Duration, error) {
+	return relayTest(ICEConfiguration(), timeout)
+}
 
-	conf := ICEConfiguration()
+// relayTest checks that a data channel can be established through one of
+// the TURN servers in conf, and returns the round-trip time.
+func relayTest(conf *webrtc.Configuration, timeout time.Duration) (time.Duration, error) {
 	conf2 := *conf
 	conf2.ICETransportPolicy = webrtc.ICETransportPolicyRelay
 
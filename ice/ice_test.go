@@ -94,3 +94,14 @@ func TestRelayTest(t *testing.T) {
 		t.Errorf("Relay test returned %v", err)
 	}
 }
+
+func TestClientConfiguration(t *testing.T) {
+	ICEFilename = "/tmp/no/such/file"
+	turnserver.Address = ""
+
+	conf := ICEConfiguration()
+	conf2 := ClientConfiguration("client")
+	if conf2 != conf {
+		t.Errorf("conf2 != conf")
+	}
+}
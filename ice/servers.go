@@ -0,0 +1,185 @@
+package ice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/jech/galene/atomicfile"
+)
+
+var ErrTagMismatch = errors.New("tag mismatch")
+
+// serialises updates to the ICE servers file
+var serversMu sync.Mutex
+
+func makeETag(fi os.FileInfo) string {
+	return fmt.Sprintf("\"%v-%v\"", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// CheckServers returns an error if any of the given servers is not valid.
+func CheckServers(servers []Server) error {
+	for _, s := range servers {
+		if len(s.URLs) == 0 {
+			return errors.New("ICE server has no URLs")
+		}
+		_, err := getServer(s)
+		if err != nil {
+			return fmt.Errorf("ICE server %v: %w", s.URLs, err)
+		}
+	}
+	return nil
+}
+
+// GetServers returns the contents of the ICE servers file together with
+// a suitable ETag.  If the file doesn't exist, it returns os.ErrNotExist.
+func GetServers() ([]Server, string, error) {
+	if ICEFilename == "" {
+		return nil, "", os.ErrNotExist
+	}
+	f, err := os.Open(ICEFilename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	var servers []Server
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	err = d.Decode(&servers)
+	if err != nil {
+		return nil, "", err
+	}
+	return servers, makeETag(fi), nil
+}
+
+// SanitiseServers returns a copy of servers without any credentials.
+func SanitiseServers(servers []Server) []Server {
+	if servers == nil {
+		return nil
+	}
+	ss := make([]Server, len(servers))
+	for i, s := range servers {
+		s.Credential = nil
+		ss[i] = s
+	}
+	return ss
+}
+
+func sameURLs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepCredentials returns a copy of servers where servers that don't
+// specify a credential keep the credential of the server in old with the
+// same URLs and username.
+func KeepCredentials(old, servers []Server) []Server {
+	if servers == nil {
+		return nil
+	}
+	ss := make([]Server, len(servers))
+	for i, s := range servers {
+		if s.Credential == nil {
+			for _, o := range old {
+				if sameURLs(o.URLs, s.URLs) &&
+					o.Username == s.Username {
+					s.Credential = o.Credential
+					if s.CredentialType == "" {
+						s.CredentialType = o.CredentialType
+					}
+					break
+				}
+			}
+		}
+		ss[i] = s
+	}
+	return ss
+}
+
+// GetServersTag returns an ETag for the ICE servers file, or the empty
+// string if it doesn't exist.
+func GetServersTag() (string, error) {
+	if ICEFilename == "" {
+		return "", nil
+	}
+	fi, err := os.Stat(ICEFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return makeETag(fi), nil
+}
+
+// UpdateServers overwrites the ICE servers file if it matches a given
+// ETag, and updates the ICE configuration.  In order to create the file,
+// pass an empty ETag.
+func UpdateServers(etag string, servers []Server) error {
+	if ICEFilename == "" {
+		return errors.New("no ICE servers file")
+	}
+	err := CheckServers(servers)
+	if err != nil {
+		return err
+	}
+	if servers == nil {
+		servers = []Server{}
+	}
+
+	serversMu.Lock()
+	defer serversMu.Unlock()
+
+	oldetag, err := GetServersTag()
+	if err != nil {
+		return err
+	}
+	if oldetag != etag {
+		return ErrTagMismatch
+	}
+
+	err = atomicfile.WriteJSON(ICEFilename, servers, "    ")
+	if err != nil {
+		return err
+	}
+
+	Update()
+	return nil
+}
+
+// DeleteServers deletes the ICE servers file if it matches a given ETag,
+// which causes the built-in TURN server to be used.
+func DeleteServers(etag string) error {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+
+	oldetag, err := GetServersTag()
+	if err != nil {
+		return err
+	}
+	if oldetag == "" {
+		return os.ErrNotExist
+	}
+	if oldetag != etag {
+		return ErrTagMismatch
+	}
+	err = os.Remove(ICEFilename)
+	if err != nil {
+		return err
+	}
+
+	Update()
+	return nil
+}
@@ -0,0 +1,98 @@
+package ice
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestServers(t *testing.T) {
+	ICEFilename = filepath.Join(t.TempDir(), "ice-servers.json")
+	defer func() {
+		ICEFilename = ""
+	}()
+
+	_, _, err := GetServers()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetServers: got %v, expected ErrNotExist", err)
+	}
+
+	servers := []Server{{
+		URLs:       []string{"turn:turn.example.org:3478"},
+		Username:   "galene",
+		Credential: "secret",
+	}}
+
+	err = UpdateServers("\"etag\"", servers)
+	if !errors.Is(err, ErrTagMismatch) {
+		t.Errorf("UpdateServers: got %v, expected ErrTagMismatch", err)
+	}
+
+	err = UpdateServers("", []Server{{URLs: []string{"turn:x"},
+		CredentialType: "bogus",
+	}})
+	if err == nil {
+		t.Errorf("UpdateServers succeeded with bad server")
+	}
+
+	err = UpdateServers("", servers)
+	if err != nil {
+		t.Fatalf("UpdateServers: %v", err)
+	}
+
+	s, etag, err := GetServers()
+	if err != nil || etag == "" || !reflect.DeepEqual(s, servers) {
+		t.Errorf("GetServers: got %v %v %v", s, etag, err)
+	}
+	if len(ICEConfiguration().ICEServers) != 1 {
+		t.Errorf("ICE configuration was not updated")
+	}
+
+	err = DeleteServers("\"etag\"")
+	if !errors.Is(err, ErrTagMismatch) {
+		t.Errorf("DeleteServers: got %v, expected ErrTagMismatch", err)
+	}
+	err = DeleteServers(etag)
+	if err != nil {
+		t.Errorf("DeleteServers: %v", err)
+	}
+	err = DeleteServers(etag)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DeleteServers: got %v, expected ErrNotExist", err)
+	}
+}
+
+func TestKeepCredentials(t *testing.T) {
+	old := []Server{{
+		URLs:           []string{"turn:turn.example.org:3478"},
+		Username:       "galene",
+		Credential:     "secret",
+		CredentialType: "hmac-sha1",
+	}, {
+		URLs:       []string{"turn:turn2.example.org:3478"},
+		Username:   "galene",
+		Credential: "secret2",
+	}}
+
+	s := SanitiseServers(old)
+	if s[0].Credential != nil || s[1].Credential != nil ||
+		s[0].CredentialType != "hmac-sha1" {
+		t.Errorf("SanitiseServers: got %v", s)
+	}
+	if old[0].Credential != "secret" {
+		t.Errorf("SanitiseServers modified its argument")
+	}
+
+	servers := []Server{
+		s[0],
+		{URLs: s[1].URLs, Username: "other"},
+		{URLs: s[1].URLs, Username: "galene", Credential: "new"},
+	}
+	k := KeepCredentials(old, servers)
+	expected := []Server{old[0], servers[1], servers[2]}
+	if !reflect.DeepEqual(k, expected) {
+		t.Errorf("KeepCredentials: got %v, expected %v", k, expected)
+	}
+}
@@ -0,0 +1,154 @@
+// Package mixer implements mixing of decoded audio from multiple sources,
+// restricted to the loudest speakers.
+
+package mixer
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// SampleRate is the sample rate of mixed audio, in Hz.
+	SampleRate = 48000
+	// FrameSize is the number of samples in a 20ms frame.
+	FrameSize = SampleRate / 50
+	// the maximum number of buffered samples per source
+	maxBuffered = 6 * FrameSize
+	// the number of silent frames after which a source is discarded
+	maxIdle = 250
+)
+
+type source struct {
+	owner    string
+	buffered []int16
+	idle     int
+}
+
+// A Mixer buffers decoded mono audio from a number of sources.
+type Mixer struct {
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+// New creates a new mixer.
+func New() *Mixer {
+	return &Mixer{sources: make(map[string]*source)}
+}
+
+// Push appends decoded samples to the source with the given id.  Owner
+// is the id of the client that sends the source, and is used to exclude
+// a client's own voice from its mix.
+func (m *Mixer) Push(id, owner string, pcm []int16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sources[id]
+	if s == nil {
+		s = &source{owner: owner}
+		m.sources[id] = s
+	}
+	s.buffered = append(s.buffered, pcm...)
+	if len(s.buffered) > maxBuffered {
+		// we're late, drop the oldest samples
+		drop := len(s.buffered) - maxBuffered
+		s.buffered = append(s.buffered[:0], s.buffered[drop:]...)
+	}
+}
+
+// Remove discards the source with the given id.
+func (m *Mixer) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sources, id)
+}
+
+// A Frame is one frame of audio from the loudest sources.
+type Frame struct {
+	owners []string
+	pcm    [][]int16
+}
+
+// Len returns the number of sources in the frame.
+func (f *Frame) Len() int {
+	return len(f.pcm)
+}
+
+func energy(pcm []int16) uint64 {
+	var e uint64
+	for _, v := range pcm {
+		e += uint64(int64(v) * int64(v))
+	}
+	return e
+}
+
+// Next consumes one frame from every source, and returns the frames of
+// the k loudest ones.  Silent sources are never included.
+func (m *Mixer) Next(k int) *Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type candidate struct {
+		owner  string
+		pcm    []int16
+		energy uint64
+	}
+	var candidates []candidate
+	for id, s := range m.sources {
+		if len(s.buffered) == 0 {
+			s.idle++
+			if s.idle > maxIdle {
+				delete(m.sources, id)
+			}
+			continue
+		}
+		s.idle = 0
+		pcm := make([]int16, FrameSize)
+		n := copy(pcm, s.buffered)
+		s.buffered = append(s.buffered[:0], s.buffered[n:]...)
+		e := energy(pcm)
+		if e == 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{s.owner, pcm, e})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].energy > candidates[j].energy
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	f := &Frame{}
+	for _, c := range candidates {
+		f.owners = append(f.owners, c.owner)
+		f.pcm = append(f.pcm, c.pcm)
+	}
+	return f
+}
+
+// Mix mixes the sources of the frame that are not owned by exclude into
+// out, which must have length FrameSize.  It returns false if the result
+// is silent.
+func (f *Frame) Mix(exclude string, out []int16) bool {
+	sum := make([]int32, len(out))
+	found := false
+	for i, pcm := range f.pcm {
+		if f.owners[i] == exclude {
+			continue
+		}
+		found = true
+		for j := range sum {
+			sum[j] += int32(pcm[j])
+		}
+	}
+	for j, v := range sum {
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		out[j] = int16(v)
+	}
+	return found
+}
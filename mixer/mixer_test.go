@@ -0,0 +1,89 @@
+package mixer
+
+import (
+	"testing"
+)
+
+func constant(v int16, n int) []int16 {
+	pcm := make([]int16, n)
+	for i := range pcm {
+		pcm[i] = v
+	}
+	return pcm
+}
+
+func TestNext(t *testing.T) {
+	m := New()
+	m.Push("a", "alice", constant(100, FrameSize))
+	m.Push("b", "bob", constant(300, FrameSize))
+	m.Push("c", "carol", constant(200, FrameSize))
+	m.Push("d", "dave", constant(0, FrameSize))
+
+	f := m.Next(2)
+	if f.Len() != 2 {
+		t.Fatalf("Expected 2 sources, got %v", f.Len())
+	}
+	if f.owners[0] != "bob" || f.owners[1] != "carol" {
+		t.Errorf("Expected bob and carol, got %v", f.owners)
+	}
+
+	f = m.Next(2)
+	if f.Len() != 0 {
+		t.Errorf("Expected empty frame, got %v", f.Len())
+	}
+}
+
+func TestPartialFrame(t *testing.T) {
+	m := New()
+	m.Push("a", "alice", constant(100, FrameSize/2))
+	f := m.Next(1)
+	if f.Len() != 1 {
+		t.Fatalf("Expected 1 source, got %v", f.Len())
+	}
+	if f.pcm[0][FrameSize/2-1] != 100 || f.pcm[0][FrameSize/2] != 0 {
+		t.Errorf("Partial frame was not padded")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	m := New()
+	for i := 0; i < 10; i++ {
+		m.Push("a", "alice", constant(int16(i+1), FrameSize))
+	}
+	f := m.Next(1)
+	if f.pcm[0][0] != 5 {
+		t.Errorf("Expected oldest frames to be dropped, got %v",
+			f.pcm[0][0])
+	}
+}
+
+func TestMix(t *testing.T) {
+	m := New()
+	m.Push("a", "alice", constant(30000, FrameSize))
+	m.Push("b", "bob", constant(20000, FrameSize))
+	f := m.Next(2)
+
+	out := make([]int16, FrameSize)
+	if !f.Mix("", out) {
+		t.Errorf("Mix is silent")
+	}
+	if out[0] != 32767 {
+		t.Errorf("Expected clipping, got %v", out[0])
+	}
+
+	if !f.Mix("alice", out) {
+		t.Errorf("Mix is silent")
+	}
+	if out[0] != 20000 {
+		t.Errorf("Expected 20000, got %v", out[0])
+	}
+
+	m.Push("a", "alice", constant(30000, FrameSize))
+	f = m.Next(2)
+	if f.Mix("alice", out) {
+		t.Errorf("Own voice was mixed")
+	}
+	if out[0] != 0 {
+		t.Errorf("Expected silence, got %v", out[0])
+	}
+}
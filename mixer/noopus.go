@@ -0,0 +1,35 @@
+//go:build !cgo || !opus
+
+package mixer
+
+import (
+	"errors"
+)
+
+// Available is true if Opus support has been compiled in.  Build with
+// the "opus" tag and libopus installed to enable audio mixing.
+const Available = false
+
+var ErrNoOpus = errors.New("opus support not compiled in")
+
+// A Decoder decodes mono Opus at 48kHz.
+type Decoder struct{}
+
+func NewDecoder() (*Decoder, error) {
+	return nil, ErrNoOpus
+}
+
+func (d *Decoder) Decode(data []byte, pcm []int16) (int, error) {
+	return 0, ErrNoOpus
+}
+
+// An Encoder encodes mono Opus at 48kHz.
+type Encoder struct{}
+
+func NewEncoder(bitrate int) (*Encoder, error) {
+	return nil, ErrNoOpus
+}
+
+func (e *Encoder) Encode(pcm []int16, data []byte) (int, error) {
+	return 0, ErrNoOpus
+}
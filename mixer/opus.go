@@ -0,0 +1,112 @@
+//go:build cgo && opus
+
+package mixer
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+
+static int
+encoder_set_bitrate(OpusEncoder *enc, opus_int32 bitrate)
+{
+    return opus_encoder_ctl(enc, OPUS_SET_BITRATE(bitrate));
+}
+
+static int
+encoder_set_fec(OpusEncoder *enc, opus_int32 fec)
+{
+    return opus_encoder_ctl(enc, OPUS_SET_INBAND_FEC(fec));
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// Available is true if Opus support has been compiled in.
+const Available = true
+
+func opusError(code C.int) error {
+	return errors.New("opus: " + C.GoString(C.opus_strerror(code)))
+}
+
+// A Decoder decodes mono Opus at 48kHz.
+type Decoder struct {
+	dec *C.OpusDecoder
+}
+
+func NewDecoder() (*Decoder, error) {
+	var err C.int
+	dec := C.opus_decoder_create(SampleRate, 1, &err)
+	if err != C.OPUS_OK {
+		return nil, opusError(err)
+	}
+	d := &Decoder{dec: dec}
+	runtime.SetFinalizer(d, func(d *Decoder) {
+		C.opus_decoder_destroy(d.dec)
+	})
+	return d, nil
+}
+
+// Decode decodes a packet into pcm, and returns the number of samples.
+// If data is nil, it performs packet loss concealment.
+func (d *Decoder) Decode(data []byte, pcm []int16) (int, error) {
+	if len(pcm) == 0 {
+		return 0, errors.New("empty buffer")
+	}
+	var p *C.uchar
+	if len(data) > 0 {
+		p = (*C.uchar)(unsafe.Pointer(&data[0]))
+	}
+	n := C.opus_decode(d.dec, p, C.opus_int32(len(data)),
+		(*C.opus_int16)(unsafe.Pointer(&pcm[0])), C.int(len(pcm)), 0)
+	runtime.KeepAlive(data)
+	if n < 0 {
+		return 0, opusError(n)
+	}
+	return int(n), nil
+}
+
+// An Encoder encodes mono Opus at 48kHz.
+type Encoder struct {
+	enc *C.OpusEncoder
+}
+
+func NewEncoder(bitrate int) (*Encoder, error) {
+	var err C.int
+	enc := C.opus_encoder_create(
+		SampleRate, 1, C.OPUS_APPLICATION_VOIP, &err,
+	)
+	if err != C.OPUS_OK {
+		return nil, opusError(err)
+	}
+	e := &Encoder{enc: enc}
+	runtime.SetFinalizer(e, func(e *Encoder) {
+		C.opus_encoder_destroy(e.enc)
+	})
+	if rc := C.encoder_set_bitrate(enc, C.opus_int32(bitrate)); rc != C.OPUS_OK {
+		return nil, opusError(rc)
+	}
+	if rc := C.encoder_set_fec(enc, 1); rc != C.OPUS_OK {
+		return nil, opusError(rc)
+	}
+	return e, nil
+}
+
+// Encode encodes a frame of pcm into data, and returns the length of
+// the packet.
+func (e *Encoder) Encode(pcm []int16, data []byte) (int, error) {
+	if len(pcm) == 0 || len(data) == 0 {
+		return 0, errors.New("empty buffer")
+	}
+	n := C.opus_encode(e.enc,
+		(*C.opus_int16)(unsafe.Pointer(&pcm[0])), C.int(len(pcm)),
+		(*C.uchar)(unsafe.Pointer(&data[0])), C.opus_int32(len(data)))
+	if n < 0 {
+		return 0, opusError(n)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,148 @@
+package packetcache
+
+import (
+	"sort"
+	"sync"
+)
+
+// EntrySize is the amount of memory used by a single cache entry.
+const EntrySize = BufSize + 8
+
+// A Budget shares a memory limit between a set of caches.  When the
+// caches request more memory than the limit, the least useful caches,
+// those whose packets are least often retrieved, are granted less than
+// they requested.
+type Budget struct {
+	mu     sync.Mutex
+	limit  int64
+	caches map[*Cache]*budgetEntry
+}
+
+type budgetEntry struct {
+	min, wanted int
+	granted     int
+	// decaying count of recent hits
+	score    float64
+	lastHits uint32
+}
+
+// NewBudget creates a budget with a limit of the given number of bytes.
+// A limit of 0 means that the memory used is not limited.
+func NewBudget(limit int64) *Budget {
+	return &Budget{
+		limit:  limit,
+		caches: make(map[*Cache]*budgetEntry),
+	}
+}
+
+// SetLimit changes the limit of the budget.  It takes effect the next
+// time the caches perform a request.
+func (b *Budget) SetLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit = limit
+}
+
+// Limit returns the limit of the budget.
+func (b *Budget) Limit() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// Request records that cache wants the given capacity, and must not be
+// shrunk below min.  It returns the capacity granted to the cache, which
+// is always between min and wanted.
+func (b *Budget) Request(cache *Cache, min, wanted int) int {
+	if wanted < min {
+		wanted = min
+	}
+
+	cache.mu.Lock()
+	hits := cache.hits
+	cache.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.caches[cache]
+	if e == nil {
+		e = &budgetEntry{lastHits: hits}
+		b.caches[cache] = e
+	}
+	e.min = min
+	e.wanted = wanted
+	e.score = e.score/2 + float64(hits-e.lastHits)
+	e.lastHits = hits
+
+	b.allocate()
+	return e.granted
+}
+
+// allocate computes the capacity granted to each cache.  Called locked.
+func (b *Budget) allocate() {
+	var total int64
+	for _, e := range b.caches {
+		e.granted = e.wanted
+		total += int64(e.wanted) * EntrySize
+	}
+	if b.limit <= 0 || total <= b.limit {
+		return
+	}
+
+	entries := make([]*budgetEntry, 0, len(b.caches))
+	for _, e := range b.caches {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].score != entries[j].score {
+			return entries[i].score < entries[j].score
+		}
+		return entries[i].wanted-entries[i].min >
+			entries[j].wanted-entries[j].min
+	})
+
+	excess := (total - b.limit + EntrySize - 1) / EntrySize
+	for _, e := range entries {
+		if excess <= 0 {
+			break
+		}
+		cut := int64(e.wanted - e.min)
+		if cut > excess {
+			cut = excess
+		}
+		e.granted = e.wanted - int(cut)
+		excess -= cut
+	}
+}
+
+// Release removes cache from the budget.
+func (b *Budget) Release(cache *Cache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.caches, cache)
+}
+
+// Used returns the amount of memory currently used by the caches in the
+// budget.
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	caches := make([]*Cache, 0, len(b.caches))
+	for c := range b.caches {
+		caches = append(caches, c)
+	}
+	b.mu.Unlock()
+
+	var used int64
+	for _, c := range caches {
+		used += c.Memory()
+	}
+	return used
+}
+
+// Memory returns the amount of memory used by the entries of the cache.
+func (cache *Cache) Memory() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return int64(len(cache.entries)) * EntrySize
+}
@@ -0,0 +1,71 @@
+package packetcache
+
+import (
+	"testing"
+)
+
+func TestBudgetUnlimited(t *testing.T) {
+	b := NewBudget(0)
+	c := New(16)
+	if g := b.Request(c, 16, 1024); g != 1024 {
+		t.Errorf("Expected 1024, got %v", g)
+	}
+	if g := b.Request(c, 16, 8); g != 16 {
+		t.Errorf("Expected 16, got %v", g)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(300 * EntrySize)
+	useful := New(100)
+	useless := New(100)
+
+	if g := b.Request(useful, 10, 100); g != 100 {
+		t.Errorf("Expected 100, got %v", g)
+	}
+	if g := b.Request(useless, 10, 100); g != 100 {
+		t.Errorf("Expected 100, got %v", g)
+	}
+
+	for i := 0; i < 10; i++ {
+		useful.Store(uint16(i), 0, false, false, []byte{uint8(i)})
+	}
+	buf := make([]byte, BufSize)
+	for i := 0; i < 10; i++ {
+		useful.Get(uint16(i), buf)
+	}
+
+	if g := b.Request(useful, 10, 200); g != 200 {
+		t.Errorf("Expected 200, got %v", g)
+	}
+	if g := b.Request(useless, 10, 100); g != 100 {
+		t.Errorf("Expected 100, got %v", g)
+	}
+	b.mu.Lock()
+	g := b.caches[useful].granted
+	b.mu.Unlock()
+	if g != 200 {
+		t.Errorf("Expected 200, got %v", g)
+	}
+
+	if g := b.Request(useless, 10, 200); g != 100 {
+		t.Errorf("Expected 100, got %v", g)
+	}
+
+	b.SetLimit(100 * EntrySize)
+	if g := b.Request(useless, 10, 200); g != 10 {
+		t.Errorf("Expected 10, got %v", g)
+	}
+	if g := b.Request(useful, 10, 200); g != 200-110 {
+		t.Errorf("Expected 90, got %v", g)
+	}
+
+	if used := b.Used(); used != 200*EntrySize {
+		t.Errorf("Expected %v, got %v", 200*EntrySize, used)
+	}
+
+	b.Release(useless)
+	if g := b.Request(useful, 10, 200); g != 100 {
+		t.Errorf("Expected 100, got %v", g)
+	}
+}
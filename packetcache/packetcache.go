@@ -50,6 +50,8 @@ type Cache struct {
 	keyframeValid bool
 	// bitmap
 	bitmap bitmap
+	// lookups by Get
+	hits, misses uint32
 	// the actual cache
 	tail    uint16
 	entries []entry
@@ -240,9 +242,11 @@ func (cache *Cache) Get(seqno uint16, result []byte) uint16 {
 
 	n, _, _ := get(seqno, cache.entries, result)
 	if n > 0 {
+		cache.hits++
 		return n
 	}
 
+	cache.misses++
 	return 0
 }
 
@@ -344,6 +348,10 @@ type Stats struct {
 	Received, TotalReceived uint32
 	Expected, TotalExpected uint32
 	ESeqno                  uint32
+	// the number of entries, and the number of successful and failed
+	// lookups since the cache was created
+	Capacity     int
+	Hits, Misses uint32
 }
 
 // GetStats returns statistics about received packets.  If reset is true,
@@ -358,6 +366,9 @@ func (cache *Cache) GetStats(reset bool) Stats {
 		Expected:      cache.expected,
 		TotalExpected: cache.totalExpected + cache.expected,
 		ESeqno:        uint32(cache.cycle)<<16 | uint32(cache.last),
+		Capacity:      len(cache.entries),
+		Hits:          cache.hits,
+		Misses:        cache.misses,
 	}
 
 	if reset {
@@ -485,3 +485,22 @@ func TestCacheStatsNack(t *testing.T) {
 		t.Errorf("Expected 32, 32, 34, 34, 31, got %v", stats)
 	}
 }
+
+func TestCacheStatsHits(t *testing.T) {
+	cache := New(16)
+	for i := 0; i < 32; i++ {
+		cache.Store(uint16(i), 0, false, false, []byte{uint8(i)})
+	}
+	buf := make([]byte, BufSize)
+	cache.Get(30, buf)
+	cache.Get(31, buf)
+	cache.Get(3, buf)
+	stats := cache.GetStats(true)
+	if stats.Capacity != 16 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 16, 2, 1, got %v", stats)
+	}
+	stats = cache.GetStats(false)
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2, 1 after reset, got %v", stats)
+	}
+}
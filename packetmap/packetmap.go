@@ -209,6 +209,30 @@ func (m *Map) Drop(seqno uint16, pid uint16) bool {
 	return true
 }
 
+// Rebase forgets all mappings, and arranges for seqno and pid to be
+// mapped to the values following the last ones mapped.  It is used when
+// the source of the packets changes.
+func (m *Map) Rebase(seqno uint16, pid uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target := m.next + m.delta
+	targetPid := m.nextPid + m.pidDelta + 1
+	m.reset()
+	m.next = seqno
+	m.nextPid = pid
+	m.delta = target - seqno
+	m.pidDelta = targetPid - pid
+	m.entries = []entry{
+		{
+			first:    seqno,
+			count:    0,
+			delta:    m.delta,
+			pidDelta: m.pidDelta,
+		},
+	}
+}
+
 // compare performs comparison modulo 2^16.
 func compare(s1, s2 uint16) int {
 	if s1 == s2 {
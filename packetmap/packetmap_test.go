@@ -258,3 +258,34 @@ func TestReset(t *testing.T) {
 		t.Errorf("Expected 32001, 0, got %v, %v, %v", ok, s, p)
 	}
 }
+
+func TestRebase(t *testing.T) {
+	m := Map{}
+
+	ok, s, p := m.Map(42, 1001)
+	if !ok || s != 42 || p != 0 {
+		t.Errorf("Expected 42, 0, got %v, %v, %v", ok, s, p)
+	}
+
+	m.Rebase(30000, 7)
+
+	ok, s, p = m.Map(30000, 7)
+	if !ok || s != 43 || p+7 != 1002 {
+		t.Errorf("Expected 43, 1002, got %v, %v, %v", ok, s, p+7)
+	}
+
+	ok, s, p = m.Map(30001, 8)
+	if !ok || s != 44 || p+8 != 1003 {
+		t.Errorf("Expected 44, 1003, got %v, %v, %v", ok, s, p+8)
+	}
+
+	ok, s, _ = m.Reverse(44)
+	if !ok || s != 30001 {
+		t.Errorf("Expected 30001, got %v %v", ok, s)
+	}
+
+	ok, _, _ = m.Reverse(42)
+	if ok {
+		t.Errorf("Expected not ok")
+	}
+}
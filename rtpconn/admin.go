@@ -0,0 +1,144 @@
+package rtpconn
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/jech/galene/diskwriter"
+	"github.com/jech/galene/group"
+)
+
+// ClientInfo describes a client connected to a group, as exposed by the
+// administrative API.
+type ClientInfo struct {
+	Id          string       `json:"id"`
+	Username    string       `json:"username,omitempty"`
+	Permissions []string     `json:"permissions"`
+	Address     string       `json:"address,omitempty"`
+	Streams     []StreamInfo `json:"streams,omitempty"`
+}
+
+// StreamInfo describes a stream sent by a client.
+type StreamInfo struct {
+	Id     string   `json:"id"`
+	Label  string   `json:"label,omitempty"`
+	Tracks []string `json:"tracks,omitempty"`
+}
+
+// GetClientInfo returns a description of client c.
+func GetClientInfo(c group.Client) ClientInfo {
+	info := ClientInfo{
+		Id:       c.Id(),
+		Username: c.Username(),
+	}
+	if addr := c.Addr(); addr != nil {
+		info.Address = addr.String()
+	}
+	wc, ok := c.(*webClient)
+	if !ok {
+		info.Permissions = append([]string{}, c.Permissions()...)
+		return info
+	}
+	// the client's goroutine may be changing its permissions
+	info.Permissions = wc.permissionsSnapshot()
+	for _, up := range getUpConns(wc) {
+		s := StreamInfo{Id: up.id, Label: up.label}
+		for _, t := range up.getTracks() {
+			s.Tracks = append(s.Tracks, t.Kind().String())
+		}
+		info.Streams = append(info.Streams, s)
+	}
+	sort.Slice(info.Streams, func(i, j int) bool {
+		return info.Streams[i].Id < info.Streams[j].Id
+	})
+	return info
+}
+
+// GetClientsInfo returns a description of all the clients of group g.
+func GetClientsInfo(g *group.Group) []ClientInfo {
+	clients := g.GetClients(nil)
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, c := range clients {
+		infos = append(infos, GetClientInfo(c))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id < infos[j].Id
+	})
+	return infos
+}
+
+// SetClientPermissions replaces the permissions of the client with the
+// given id.
+func SetClientPermissions(g *group.Group, id string, perms []string) error {
+	c := g.GetClient(id)
+	if c == nil {
+		return os.ErrNotExist
+	}
+	wc, ok := c.(*webClient)
+	if !ok {
+		return group.UserError("this is not a real user")
+	}
+	wc.action(setPermissionsAction{append([]string{}, perms...)})
+	return nil
+}
+
+// IsRecording returns true if group g is being recorded.
+func IsRecording(g *group.Group) bool {
+	for _, c := range g.GetClients(nil) {
+		if _, ok := c.(*diskwriter.Client); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingMu serialises starting and stopping recordings, so that
+// concurrent requests don't attach multiple disk writers to a group.
+var recordingMu sync.Mutex
+
+// StartRecording starts recording group g.
+func StartRecording(g *group.Group) error {
+	if g.Description().E2EE {
+		return group.UserError(
+			"cannot record an end-to-end encrypted group",
+		)
+	}
+
+	recordingMu.Lock()
+	defer recordingMu.Unlock()
+
+	if IsRecording(g) {
+		return group.UserError("already recording")
+	}
+	disk := diskwriter.New(g)
+	_, err := group.AddClient(g.Name(), disk,
+		group.ClientCredentials{
+			System: true,
+		},
+	)
+	if err != nil {
+		disk.Close()
+		return err
+	}
+	requestConns(disk, g, "")
+	return nil
+}
+
+// StopRecording stops recording group g.  It returns false if the group
+// was not being recorded.
+func StopRecording(g *group.Group) bool {
+	recordingMu.Lock()
+	defer recordingMu.Unlock()
+
+	found := false
+	for _, c := range g.GetClients(nil) {
+		disk, ok := c.(*diskwriter.Client)
+		if ok {
+			disk.Close()
+			group.DelClient(disk)
+			found = true
+		}
+	}
+	return found
+}
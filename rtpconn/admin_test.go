@@ -0,0 +1,148 @@
+package rtpconn
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jech/galene/diskwriter"
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/unbounded"
+)
+
+func TestClientInfo(t *testing.T) {
+	c := &webClient{
+		addr: &net.TCPAddr{
+			IP:   net.IP{192, 0, 2, 1},
+			Port: 1234,
+		},
+		id:          "id",
+		username:    "user",
+		permissions: []string{"present"},
+		up: map[string]*rtpUpConnection{
+			"b": {id: "b", label: "camera"},
+			"a": {id: "a", label: "screenshare"},
+		},
+	}
+	info := GetClientInfo(c)
+	expected := ClientInfo{
+		Id:          "id",
+		Username:    "user",
+		Permissions: []string{"present"},
+		Address:     "192.0.2.1:1234",
+		Streams: []StreamInfo{
+			{Id: "a", Label: "screenshare"},
+			{Id: "b", Label: "camera"},
+		},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Got %v, expected %v", info, expected)
+	}
+
+	info.Permissions[0] = "op"
+	if c.permissions[0] != "present" {
+		t.Errorf("Permissions were not copied")
+	}
+}
+
+func TestSetPermissionsAction(t *testing.T) {
+	c := &webClient{
+		permissions: []string{"present"},
+		actions:     unbounded.New[any](),
+	}
+	err := handleAction(c, setPermissionsAction{[]string{"op"}})
+	if err != nil {
+		t.Fatalf("handleAction: %v", err)
+	}
+	if !reflect.DeepEqual(c.permissions, []string{"op"}) {
+		t.Errorf("Got %v", c.permissions)
+	}
+	actions := c.actions.Get()
+	if len(actions) != 1 {
+		t.Fatalf("Expected one action, got %v", actions)
+	}
+	if _, ok := actions[0].(permissionsChangedAction); !ok {
+		t.Errorf("Expected permissionsChangedAction, got %T", actions[0])
+	}
+}
+
+func TestClientInfoConcurrent(t *testing.T) {
+	c := &webClient{
+		id:          "id",
+		permissions: []string{"present", "message"},
+		actions:     unbounded.New[any](),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			kind := "unpresent"
+			if i%2 == 1 {
+				kind = "present"
+			}
+			err := handleAction(c, changePermissionsAction{kind: kind})
+			if err != nil {
+				t.Errorf("handleAction: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		info := GetClientInfo(c)
+		if !member("message", info.Permissions) {
+			t.Errorf("Got %v", info.Permissions)
+		}
+	}
+	<-done
+}
+
+func TestStartRecordingConcurrent(t *testing.T) {
+	group.Directory = t.TempDir()
+	diskwriter.Directory = t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(group.Directory, "recording-test.json"),
+		[]byte(`{"allow-recording": true}`), 0600,
+	)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	g, err := group.Add("recording-test", nil)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("recording-test")
+	defer StopRecording(g)
+
+	var wg sync.WaitGroup
+	var started atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if StartRecording(g) == nil {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	for _, c := range g.GetClients(nil) {
+		if _, ok := c.(*diskwriter.Client); ok {
+			count++
+		}
+	}
+	if started.Load() != 1 || count != 1 {
+		t.Errorf("Started %v, got %v disk writers",
+			started.Load(), count)
+	}
+
+	if !StopRecording(g) || IsRecording(g) {
+		t.Errorf("Couldn't stop recording")
+	}
+}
@@ -0,0 +1,374 @@
+package rtpconn
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/conn"
+)
+
+// videoConstraints are the constraints requested by a subscriber for
+// the video track of a stream.  Zero values mean no constraint.
+type videoConstraints struct {
+	width, height uint32
+	framerate     float64
+	// the relative share of bandwidth, defaults to 1
+	priority float64
+}
+
+func (v videoConstraints) getPriority() float64 {
+	if v.priority <= 0 {
+		return 1
+	}
+	return v.priority
+}
+
+// A streamRequest is the value of an entry in a request message: a list
+// of requested track kinds, and optional video constraints.
+type streamRequest struct {
+	tracks      []string
+	constraints videoConstraints
+}
+
+func toNumber(v interface{}) (float64, error) {
+	if v == nil {
+		return 0, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errBadType
+	}
+	return f, nil
+}
+
+func parseConstraints(m map[string]interface{}) (videoConstraints, error) {
+	var v videoConstraints
+	var err error
+	get := func(key string) float64 {
+		if err != nil {
+			return 0
+		}
+		var f float64
+		f, err = toNumber(m[key])
+		return f
+	}
+	width := get("width")
+	height := get("height")
+	v.framerate = get("framerate")
+	v.priority = get("priority")
+	if err != nil {
+		return videoConstraints{}, err
+	}
+	if width > 0xFFFF || height > 0xFFFF {
+		return videoConstraints{}, errBadType
+	}
+	v.width = uint32(width)
+	v.height = uint32(height)
+	return v, nil
+}
+
+// parseStreamRequest parses a list of strings, optionally containing
+// a single dictionary of video constraints.
+func parseStreamRequest(r interface{}) (streamRequest, error) {
+	if r == nil {
+		return streamRequest{}, nil
+	}
+	rr, ok := r.([]interface{})
+	if !ok {
+		return streamRequest{}, errBadType
+	}
+	var req streamRequest
+	constraints := false
+	for _, v := range rr {
+		switch v := v.(type) {
+		case string:
+			req.tracks = append(req.tracks, v)
+		case map[string]interface{}:
+			if constraints {
+				return streamRequest{}, errBadType
+			}
+			c, err := parseConstraints(v)
+			if err != nil {
+				return streamRequest{}, err
+			}
+			req.constraints = c
+			constraints = true
+		default:
+			return streamRequest{}, errBadType
+		}
+	}
+	return req, nil
+}
+
+func (down *rtpDownTrack) getConstraints() videoConstraints {
+	c, _ := down.constraints.Load().(videoConstraints)
+	return c
+}
+
+func (down *rtpDownTrack) setConstraints(c videoConstraints) {
+	down.constraints.Store(c)
+}
+
+func (up *rtpUpTrack) getDimensions() (uint32, uint32) {
+	d := atomic.LoadUint32(&up.dimensions)
+	return d >> 16, d & 0xFFFF
+}
+
+// setDimensions records the dimensions of the largest layer of the
+// track.
+func (up *rtpUpTrack) setDimensions(width, height uint32) {
+	if width == 0 || height == 0 || width > 0xFFFF || height > 0xFFFF {
+		return
+	}
+	atomic.StoreUint32(&up.dimensions, width<<16|height)
+}
+
+// getFramerate returns the framerate of the track, or 0 if unknown.
+func (up *rtpUpTrack) getFramerate() float64 {
+	if up.frames == nil {
+		return 0
+	}
+	_, rate := up.frames.Estimate()
+	return float64(rate)
+}
+
+// getSource returns the track that packets are forwarded from, which
+// differs from remote after a switch to a different simulcast track.
+func (down *rtpDownTrack) getSource() conn.UpTrack {
+	if up := down.source.Load(); up != nil {
+		return up
+	}
+	return down.remote
+}
+
+// reselectTrack checks whether the simulcast track that best matches the
+// subscriber's constraints is the one being forwarded, which might not be
+// the case if the dimensions of the tracks were not known when the
+// connection was pushed, or if they have changed since.  If it isn't, it
+// subscribes down to the better track; the switch happens at the next
+// keyframe, without renegotiation.
+func (down *rtpDownTrack) reselectTrack() {
+	v := down.getConstraints()
+	if v.width == 0 && v.height == 0 {
+		return
+	}
+	remote, ok := down.remote.(*rtpUpTrack)
+	if !ok || remote.Kind() != webrtc.RTPCodecTypeVideo ||
+		remote.encrypted {
+		return
+	}
+	uptracks := remote.conn.getTracks()
+	tracks := make([]conn.UpTrack, len(uptracks))
+	for i, t := range uptracks {
+		tracks[i] = t
+	}
+	up, ok := selectVideoTrack(tracks, v).(*rtpUpTrack)
+	if !ok || !strings.EqualFold(
+		up.Codec().MimeType, remote.Codec().MimeType,
+	) {
+		return
+	}
+
+	down.sourceMu.Lock()
+	defer down.sourceMu.Unlock()
+
+	pending := down.pending.Load()
+	if up == pending {
+		return
+	}
+	if pending != nil {
+		down.pending.Store(nil)
+		pending.DelLocal(down)
+	}
+	if up == down.getSource() {
+		return
+	}
+	down.pending.Store(up)
+	down.switching.Store(true)
+	// this causes the writer to resend the last keyframe, or to
+	// request a new one
+	up.AddLocal(down)
+}
+
+// packetSource returns the track that buf was received from if it is
+// to be forwarded, and nil otherwise.  If buf starts a keyframe on the
+// track that we are switching to, it completes the switch.  Called with
+// sourceMu held.
+func (down *rtpDownTrack) packetSource(buf []byte) (conn.UpTrack, error) {
+	if len(buf) < 12 {
+		return nil, errTruncated
+	}
+	ssrc := webrtc.SSRC(binary.BigEndian.Uint32(buf[8:12]))
+
+	source, ok := down.getSource().(*rtpUpTrack)
+	if !ok {
+		return down.getSource(), nil
+	}
+	if source.track.SSRC() == ssrc {
+		return source, nil
+	}
+
+	pending := down.pending.Load()
+	if pending == nil || pending.track.SSRC() != ssrc {
+		return nil, nil
+	}
+	flags, err := down.packetFlags(pending, buf)
+	if err != nil || !flags.Start || !flags.Keyframe {
+		return nil, err
+	}
+
+	ts := binary.BigEndian.Uint32(buf[4:8])
+	atomic.StoreUint32(&down.atomics.tsDelta,
+		down.timestampDelta(source, pending, ts),
+	)
+	down.packetmap.Rebase(flags.Seqno, flags.Pid)
+	down.source.Store(pending)
+	down.pending.Store(nil)
+	source.DelLocal(down)
+
+	pending.mu.Lock()
+	ntp, rtp := pending.srNTPTime, pending.srRTPTime
+	pending.mu.Unlock()
+	down.SetTimeOffset(ntp, rtp)
+
+	return pending, nil
+}
+
+// timestampDelta returns the value to add to the timestamps of the
+// packets of new so that a frame with timestamp ts follows the last
+// packet forwarded from old.
+func (down *rtpDownTrack) timestampDelta(old, new *rtpUpTrack, ts uint32) uint32 {
+	delta := atomic.LoadUint32(&down.atomics.tsDelta)
+	seqno, ok := old.cache.Last()
+	if !ok {
+		return delta
+	}
+	ibuf := packetBufPool.Get()
+	defer packetBufPool.Put(ibuf)
+	buf := ibuf.([]byte)
+	n := old.cache.Get(seqno, buf)
+	if n < 12 {
+		return delta
+	}
+	last := binary.BigEndian.Uint32(buf[4:8]) + delta
+
+	clockrate := float64(down.track.Codec().ClockRate)
+	framerate := new.getFramerate()
+	if framerate < 1 {
+		framerate = 30
+	}
+	return last + uint32(clockrate/framerate) - ts
+}
+
+// detach unsubscribes down from the tracks that it receives packets
+// from.
+func (down *rtpDownTrack) detach() {
+	down.sourceMu.Lock()
+	defer down.sourceMu.Unlock()
+	if pending := down.pending.Load(); pending != nil {
+		down.pending.Store(nil)
+		pending.DelLocal(down)
+	}
+	down.getSource().DelLocal(down)
+}
+
+// covers returns true if a picture of the given dimensions is at least
+// as large as requested.
+func (v videoConstraints) covers(width, height uint32) bool {
+	return width >= v.width && height >= v.height
+}
+
+// selectVideoTrack picks the smallest simulcast track that covers the
+// requested resolution, or the largest one if none does.  It returns nil
+// if there are no constraints, or if the dimensions of some tracks are
+// not known yet.
+func selectVideoTrack(tracks []conn.UpTrack, v videoConstraints) conn.UpTrack {
+	if v.width == 0 && v.height == 0 {
+		return nil
+	}
+	var best, largest conn.UpTrack
+	var bestSize, largestSize uint32
+	for _, t := range tracks {
+		if t.Kind() != webrtc.RTPCodecTypeVideo {
+			continue
+		}
+		up, ok := t.(*rtpUpTrack)
+		if !ok {
+			return nil
+		}
+		w, h := up.getDimensions()
+		if w == 0 || h == 0 {
+			return nil
+		}
+		size := w * h
+		if largest == nil || size > largestSize {
+			largest = t
+			largestSize = size
+		}
+		if v.covers(w, h) && (best == nil || size < bestSize) {
+			best = t
+			bestSize = size
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return largest
+}
+
+// spatialLimit returns the lowest of the spatial layers up to maxSid
+// that covers the requested resolution, given the dimensions of the
+// layer topSid.  It assumes that each layer doubles the resolution.
+func spatialLimit(width, height uint32, topSid, maxSid uint8, v videoConstraints) uint8 {
+	if width == 0 || height == 0 || (v.width == 0 && v.height == 0) {
+		return maxSid
+	}
+	for s := uint8(0); s < maxSid; s++ {
+		shift := topSid - s
+		if v.covers(width>>shift, height>>shift) {
+			return s
+		}
+	}
+	return maxSid
+}
+
+// temporalLimit returns the lowest of the temporal layers up to maxTid
+// that achieves the requested framerate, given the framerate of the
+// layer topTid.  It assumes that each layer doubles the framerate.
+func temporalLimit(framerate float64, topTid, maxTid uint8, v videoConstraints) uint8 {
+	if framerate <= 0 || v.framerate <= 0 {
+		return maxTid
+	}
+	for t := uint8(0); t < maxTid; t++ {
+		shift := topTid - t
+		if framerate/float64(uint32(1)<<shift) >= v.framerate*0.9 {
+			return t
+		}
+	}
+	return maxTid
+}
+
+// layerLimits returns the highest spatial and temporal layers that are
+// worth sending given the constraints requested by the subscriber.
+func (down *rtpDownTrack) layerLimits(layer layerInfo) (uint8, uint8) {
+	maxSid, maxTid := layer.maxSid, layer.maxTid
+	if layer.limitSid {
+		maxSid = 0
+	}
+	up, ok := down.remote.(*rtpUpTrack)
+	if !ok {
+		return maxSid, maxTid
+	}
+	v := down.getConstraints()
+	if source, ok := down.getSource().(*rtpUpTrack); ok {
+		up = source
+	}
+	w, h := up.getDimensions()
+	maxSid = spatialLimit(w, h, layer.maxSid, maxSid, v)
+	maxTid = temporalLimit(up.getFramerate(), layer.maxTid, maxTid, v)
+	return maxSid, maxTid
+}
@@ -0,0 +1,179 @@
+package rtpconn
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/packetcache"
+)
+
+func TestParseStreamRequest(t *testing.T) {
+	tests := []struct {
+		value string
+		req   streamRequest
+		ok    bool
+	}{
+		{`null`, streamRequest{}, true},
+		{`["audio", "video"]`,
+			streamRequest{tracks: []string{"audio", "video"}}, true},
+		{`["video", {"width": 320, "height": 180, "framerate": 15, "priority": 2}]`,
+			streamRequest{
+				tracks: []string{"video"},
+				constraints: videoConstraints{
+					width: 320, height: 180,
+					framerate: 15, priority: 2,
+				},
+			}, true},
+		{`["video", {"width": -1}]`, streamRequest{}, false},
+		{`["video", {"width": "big"}]`, streamRequest{}, false},
+		{`["video", {}, {}]`, streamRequest{}, false},
+		{`["video", 42]`, streamRequest{}, false},
+		{`"video"`, streamRequest{}, false},
+	}
+
+	for _, test := range tests {
+		var v interface{}
+		err := json.Unmarshal([]byte(test.value), &v)
+		if err != nil {
+			t.Fatalf("Unmarshal %v: %v", test.value, err)
+		}
+		req, err := parseStreamRequest(v)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got error %v", test.value, err)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(req, test.req) {
+			t.Errorf("%v: expected %v, got %v",
+				test.value, test.req, req)
+		}
+	}
+}
+
+func TestPriority(t *testing.T) {
+	if p := (videoConstraints{}).getPriority(); p != 1 {
+		t.Errorf("Expected default priority 1, got %v", p)
+	}
+	if p := (videoConstraints{priority: 3}).getPriority(); p != 3 {
+		t.Errorf("Expected priority 3, got %v", p)
+	}
+}
+
+func TestSpatialLimit(t *testing.T) {
+	tests := []struct {
+		width, height uint32
+		maxSid        uint8
+		v             videoConstraints
+		sid           uint8
+	}{
+		{1280, 720, 2, videoConstraints{}, 2},
+		{0, 0, 2, videoConstraints{width: 320}, 2},
+		{1280, 720, 2, videoConstraints{width: 320, height: 180}, 0},
+		{1280, 720, 2, videoConstraints{width: 321}, 1},
+		{1280, 720, 2, videoConstraints{height: 400}, 2},
+		{1280, 720, 2, videoConstraints{width: 4000}, 2},
+		{1280, 720, 1, videoConstraints{width: 640}, 1},
+	}
+	for _, test := range tests {
+		sid := spatialLimit(
+			test.width, test.height, 2, test.maxSid, test.v,
+		)
+		if sid != test.sid {
+			t.Errorf("%vx%v, %v: expected %v, got %v",
+				test.width, test.height, test.v, test.sid, sid)
+		}
+	}
+}
+
+func TestTemporalLimit(t *testing.T) {
+	tests := []struct {
+		framerate float64
+		v         videoConstraints
+		tid       uint8
+	}{
+		{30, videoConstraints{}, 2},
+		{0, videoConstraints{framerate: 15}, 2},
+		{30, videoConstraints{framerate: 7}, 0},
+		{30, videoConstraints{framerate: 15}, 1},
+		{28, videoConstraints{framerate: 15}, 1},
+		{30, videoConstraints{framerate: 20}, 2},
+		{30, videoConstraints{framerate: 60}, 2},
+	}
+	for _, test := range tests {
+		tid := temporalLimit(test.framerate, 2, 2, test.v)
+		if tid != test.tid {
+			t.Errorf("%v, %v: expected %v, got %v",
+				test.framerate, test.v, test.tid, tid)
+		}
+	}
+}
+
+func TestLayerLimits(t *testing.T) {
+	up := &rtpUpTrack{}
+	up.setDimensions(1280, 720)
+	down := &rtpDownTrack{remote: up}
+	layer := layerInfo{maxSid: 2, maxTid: 2}
+
+	sid, tid := down.layerLimits(layer)
+	if sid != 2 || tid != 2 {
+		t.Errorf("Expected 2, 2, got %v, %v", sid, tid)
+	}
+
+	down.setConstraints(videoConstraints{width: 640, height: 360})
+	sid, tid = down.layerLimits(layer)
+	if sid != 1 || tid != 2 {
+		t.Errorf("Expected 1, 2, got %v, %v", sid, tid)
+	}
+
+	layer.limitSid = true
+	sid, _ = down.layerLimits(layer)
+	if sid != 0 {
+		t.Errorf("Expected 0, got %v", sid)
+	}
+}
+
+func TestTimestampDelta(t *testing.T) {
+	local, err := newLocalTrack(
+		webrtc.RTPCodecCapability{
+			MimeType:  "video/VP8",
+			ClockRate: 90000,
+		},
+		"video", "stream",
+	)
+	if err != nil {
+		t.Fatalf("newLocalTrack: %v", err)
+	}
+	down := &rtpDownTrack{
+		track:   local,
+		atomics: &downTrackAtomics{tsDelta: 10},
+	}
+	old := &rtpUpTrack{cache: packetcache.New(16)}
+	new := &rtpUpTrack{}
+
+	if d := down.timestampDelta(old, new, 5000); d != 10 {
+		t.Errorf("Expected 10 with an empty cache, got %v", d)
+	}
+
+	packet := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: 42,
+			Timestamp:      1000,
+		},
+		Payload: []byte{0},
+	}
+	buf, err := packet.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	old.cache.Store(42, 1000, false, false, buf)
+
+	// the frame follows the last one sent, one frame later at 30fps
+	d := down.timestampDelta(old, new, 5000)
+	if 5000+d != 1000+10+3000 {
+		t.Errorf("Expected %v, got %v", 1000+10+3000, 5000+d)
+	}
+}
@@ -0,0 +1,242 @@
+package rtpconn
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/group"
+)
+
+// the default value of the data-channel-rate group option
+const defaultDataChannelRate = 256 * 1024
+
+// An upDataChannel is a data channel opened by the sender of a stream,
+// which is forwarded to the stream's receivers.
+type upDataChannel struct {
+	dc *webrtc.DataChannel
+	// the label seen by the receivers
+	label string
+	// if not empty, the id of the only client that receives the channel
+	dest string
+}
+
+// splitDataChannelLabel splits the label of a data channel opened by a
+// sender, of the form "label" or "label@dest", into the label seen by the
+// receivers and the id of the only client that receives the channel.
+func splitDataChannelLabel(label string) (string, string) {
+	i := strings.LastIndexByte(label, '@')
+	if i < 0 || i == len(label)-1 {
+		return label, ""
+	}
+	return label[:i], label[i+1:]
+}
+
+// A rateLimiter is a token bucket that allows bursts of one second.
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// allow returns true if n bytes may be sent at the given rate.  A single
+// message larger than the bucket is allowed if the bucket is full.
+func (l *rateLimiter) allow(rate float64, n int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last.IsZero() {
+		l.tokens = rate
+	} else {
+		l.tokens += rate * now.Sub(l.last).Seconds()
+		if l.tokens > rate {
+			l.tokens = rate
+		}
+	}
+	l.last = now
+	if l.tokens < 0 {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+func dataChannelRate(g *group.Group) float64 {
+	if g == nil {
+		return -1
+	}
+	rate := g.Description().DataChannelRate
+	if rate == 0 {
+		return defaultDataChannelRate
+	}
+	return float64(rate)
+}
+
+// allowData returns true if client c may send n bytes of data.
+func allowData(c group.Client, n int) bool {
+	rate := dataChannelRate(c.Group())
+	if rate < 0 {
+		return false
+	}
+	wc, ok := c.(*webClient)
+	if !ok {
+		return true
+	}
+	return wc.dataLimiter.allow(rate, n, time.Now())
+}
+
+func sendData(dc *webrtc.DataChannel, msg webrtc.DataChannelMessage) error {
+	if msg.IsString {
+		return dc.SendText(string(msg.Data))
+	}
+	return dc.Send(msg.Data)
+}
+
+// gotDataChannel is called when the sender opens a data channel.
+func (up *rtpUpConnection) gotDataChannel(dc *webrtc.DataChannel) {
+	g := up.client.Group()
+	if dataChannelRate(g) < 0 {
+		log.Printf("Data channels are disabled, ignoring %v",
+			dc.Label())
+		dc.Close()
+		return
+	}
+
+	label, dest := splitDataChannelLabel(dc.Label())
+	ch := &upDataChannel{dc: dc, label: label, dest: dest}
+
+	dc.OnOpen(func() {
+		up.mu.Lock()
+		if up.closed {
+			up.mu.Unlock()
+			return
+		}
+		up.channels = append(up.channels, ch)
+		up.mu.Unlock()
+		pushConn(up, g, g.GetClients(up.client))
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !allowData(up.client, len(msg.Data)) {
+			return
+		}
+		for _, l := range up.getLocal() {
+			down, ok := l.(*rtpDownConnection)
+			if !ok {
+				continue
+			}
+			d := down.getDataChannel(ch)
+			if d != nil {
+				sendData(d, msg)
+			}
+		}
+	})
+
+	dc.OnClose(func() {
+		up.mu.Lock()
+		for i, c := range up.channels {
+			if c == ch {
+				up.channels = append(
+					up.channels[:i], up.channels[i+1:]...,
+				)
+				break
+			}
+		}
+		up.mu.Unlock()
+		for _, l := range up.getLocal() {
+			down, ok := l.(*rtpDownConnection)
+			if ok {
+				down.delDataChannel(ch)
+			}
+		}
+	})
+}
+
+func (up *rtpUpConnection) getDataChannels() []*upDataChannel {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	channels := make([]*upDataChannel, len(up.channels))
+	copy(channels, up.channels)
+	return channels
+}
+
+// hasDataChannels returns true if any data channel forwarded by up
+// should be sent to client c.
+func (up *rtpUpConnection) hasDataChannels(c group.Client) bool {
+	for _, ch := range up.getDataChannels() {
+		if ch.dest == "" || ch.dest == c.Id() {
+			return true
+		}
+	}
+	return false
+}
+
+func (down *rtpDownConnection) getDataChannel(ch *upDataChannel) *webrtc.DataChannel {
+	down.mu.Lock()
+	defer down.mu.Unlock()
+	return down.channels[ch]
+}
+
+func (down *rtpDownConnection) delDataChannel(ch *upDataChannel) {
+	down.mu.Lock()
+	d := down.channels[ch]
+	delete(down.channels, ch)
+	down.mu.Unlock()
+	if d != nil {
+		d.Close()
+	}
+}
+
+// replaceDataChannels creates the data channels forwarded by the sender
+// that are not yet present on down.  It returns true if renegotiation is
+// needed, which is the case when the first data channel is added.
+func replaceDataChannels(down *rtpDownConnection) (bool, error) {
+	up, ok := down.remote.(*rtpUpConnection)
+	if !ok {
+		return false, nil
+	}
+	channels := up.getDataChannels()
+
+	down.mu.Lock()
+	defer down.mu.Unlock()
+
+	first := len(down.channels) == 0
+	added := false
+	for _, ch := range channels {
+		if ch.dest != "" && ch.dest != down.client.Id() {
+			continue
+		}
+		if down.channels[ch] != nil {
+			continue
+		}
+		ordered := ch.dc.Ordered()
+		protocol := ch.dc.Protocol()
+		d, err := down.pc.CreateDataChannel(ch.label,
+			&webrtc.DataChannelInit{
+				Ordered:           &ordered,
+				MaxPacketLifeTime: ch.dc.MaxPacketLifeTime(),
+				MaxRetransmits:    ch.dc.MaxRetransmits(),
+				Protocol:          &protocol,
+			},
+		)
+		if err != nil {
+			return false, err
+		}
+		// messages sent by the receiver are forwarded to the sender
+		d.OnMessage(func(msg webrtc.DataChannelMessage) {
+			if !allowData(down.client, len(msg.Data)) {
+				return
+			}
+			sendData(ch.dc, msg)
+		})
+		if down.channels == nil {
+			down.channels =
+				make(map[*upDataChannel]*webrtc.DataChannel)
+		}
+		down.channels[ch] = d
+		added = true
+	}
+	return first && added, nil
+}
@@ -0,0 +1,57 @@
+package rtpconn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var l rateLimiter
+	now := time.Now()
+
+	if !l.allow(1000, 600, now) {
+		t.Errorf("First message not allowed")
+	}
+	if !l.allow(1000, 600, now) {
+		t.Errorf("Burst not allowed")
+	}
+	if l.allow(1000, 1, now) {
+		t.Errorf("Exhausted bucket allowed message")
+	}
+
+	// the debt of 200 bytes must be repaid first
+	now = now.Add(300 * time.Millisecond)
+	if !l.allow(1000, 150, now) {
+		t.Errorf("Refilled bucket didn't allow message")
+	}
+	if l.allow(1000, 1, now) {
+		t.Errorf("Exhausted bucket allowed message")
+	}
+
+	// the bucket never holds more than one second's worth
+	now = now.Add(time.Hour)
+	if !l.allow(1000, 2000, now) {
+		t.Errorf("Large message not allowed")
+	}
+	if l.allow(1000, 1, now.Add(500*time.Millisecond)) {
+		t.Errorf("Bucket overflowed")
+	}
+}
+
+func TestSplitDataChannelLabel(t *testing.T) {
+	tests := []struct{ in, label, dest string }{
+		{"cursor", "cursor", ""},
+		{"cursor@abcd", "cursor", "abcd"},
+		{"a@b@abcd", "a@b", "abcd"},
+		{"cursor@", "cursor@", ""},
+		{"@abcd", "", "abcd"},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		label, dest := splitDataChannelLabel(test.in)
+		if label != test.label || dest != test.dest {
+			t.Errorf("%q: got %q %q, expected %q %q",
+				test.in, label, dest, test.label, test.dest)
+		}
+	}
+}
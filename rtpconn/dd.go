@@ -0,0 +1,149 @@
+package rtpconn
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/jech/galene/codecs"
+	"github.com/jech/galene/conn"
+)
+
+// the number of packets for which we remember layer information
+const layerTableSize = 512
+
+type layerEntry struct {
+	valid           bool
+	seqno           uint16
+	start, end      bool
+	sid, tid        uint8
+	keyframe        bool
+	tidUpSync       bool
+	sidUpSync       bool
+	sidNonReference bool
+	discardable     bool
+}
+
+// A layerTable remembers the layer information extracted from the
+// dependency descriptors of recently received packets, since header
+// extensions are stripped before packets are stored in the cache.
+type layerTable struct {
+	mu      sync.Mutex
+	known   bool
+	entries [layerTableSize]layerEntry
+}
+
+func (t *layerTable) store(seqno uint16, flags *codecs.Flags) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.known = true
+	t.entries[seqno%layerTableSize] = layerEntry{
+		valid:           true,
+		seqno:           seqno,
+		start:           flags.Start,
+		end:             flags.End,
+		sid:             flags.Sid,
+		tid:             flags.Tid,
+		keyframe:        flags.Keyframe,
+		tidUpSync:       flags.TidUpSync,
+		sidUpSync:       flags.SidUpSync,
+		sidNonReference: flags.SidNonReference,
+		discardable:     flags.Discardable,
+	}
+}
+
+// get updates flags with the layer information stored for the packet
+// with the given seqno.  It returns false if no information is known.
+func (t *layerTable) get(seqno uint16, flags *codecs.Flags) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := &t.entries[seqno%layerTableSize]
+	if !e.valid || e.seqno != seqno {
+		return false
+	}
+	flags.Keyframe = flags.Keyframe || e.keyframe
+	flags.Start = e.start
+	flags.End = e.end
+	flags.Sid = e.sid
+	flags.Tid = e.tid
+	flags.TidUpSync = flags.Keyframe || e.tidUpSync
+	flags.SidUpSync = flags.Keyframe || e.sidUpSync
+	flags.SidNonReference = e.sidNonReference
+	flags.Discardable = e.discardable
+	return true
+}
+
+// hasEntries returns true if any layer information has been stored.
+func (t *layerTable) hasEntries() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.known
+}
+
+// gotDependencyDescriptor parses the dependency descriptor carried by a
+// packet and records the resulting layer information.  It returns the
+// dependency structure in effect after the packet, and whether the
+// packet is the start of a keyframe.  If the track is end-to-end
+// encrypted, the latter is determined from the dependency descriptor,
+// otherwise kf is returned unchanged.
+func (up *rtpUpTrack) gotDependencyDescriptor(seqno uint16, kf bool, data []byte, structure *codecs.DependencyStructure) (*codecs.DependencyStructure, bool, bool) {
+	dd, err := codecs.ParseDependencyDescriptor(data, structure)
+	if err != nil {
+		return structure, kf, false
+	}
+	if dd.Structure != nil {
+		structure = dd.Structure
+	}
+	if up.encrypted {
+		// the structure is attached to keyframes
+		kf = dd.Structure != nil && dd.Start
+	}
+	flags := codecs.Flags{Seqno: seqno, Keyframe: kf}
+	dd.SetFlags(&flags, structure)
+	up.layers.store(seqno, &flags)
+	return structure, kf, true
+}
+
+// layerFlags updates flags with the layer information carried in the
+// dependency descriptor of the corresponding packet, if any.
+func (up *rtpUpTrack) layerFlags(flags *codecs.Flags) bool {
+	if up.layers == nil {
+		return false
+	}
+	return up.layers.get(flags.Seqno, flags)
+}
+
+// packetFlags returns the flags of a packet received from source and
+// about to be written to down.  If the payload is end-to-end encrypted,
+// we only use the RTP header and the information extracted from the
+// dependency descriptor.
+func (down *rtpDownTrack) packetFlags(source conn.UpTrack, buf []byte) (codecs.Flags, error) {
+	codec := down.remote.Codec().MimeType
+	up, _ := source.(*rtpUpTrack)
+
+	if up != nil && up.encrypted {
+		flags, err := codecs.HeaderFlags(buf)
+		if err != nil {
+			return flags, err
+		}
+		up.layerFlags(&flags)
+		return flags, nil
+	}
+
+	flags, err := codecs.PacketFlags(codec, buf)
+	if err != nil {
+		return flags, err
+	}
+	// AV1 carries layer information in the dependency descriptor
+	if up != nil && strings.EqualFold(codec, "video/av1") {
+		up.layerFlags(&flags)
+	}
+	return flags, nil
+}
+
+// keyframesKnown returns false if keyframes cannot be detected on the
+// track feeding down, which happens with end-to-end encryption when the
+// sender doesn't send a dependency descriptor.
+func (down *rtpDownTrack) keyframesKnown() bool {
+	up, ok := down.getSource().(*rtpUpTrack)
+	return !ok || !up.encrypted || up.layers.hasEntries()
+}
@@ -0,0 +1,66 @@
+package rtpconn
+
+import (
+	"testing"
+
+	"github.com/jech/galene/codecs"
+)
+
+func TestLayerTable(t *testing.T) {
+	var table layerTable
+	table.store(42, &codecs.Flags{
+		Start: true, Sid: 1, Tid: 2, SidNonReference: true,
+	})
+
+	flags := codecs.Flags{Seqno: 42, Keyframe: true}
+	if !table.get(42, &flags) {
+		t.Fatalf("Couldn't find entry")
+	}
+	if !flags.Start || flags.End || flags.Sid != 1 || flags.Tid != 2 ||
+		!flags.TidUpSync || !flags.SidNonReference {
+		t.Errorf("Unexpected flags %#v", flags)
+	}
+
+	if table.get(42+layerTableSize, &flags) {
+		t.Errorf("Found stale entry")
+	}
+	if table.get(43, &flags) {
+		t.Errorf("Found missing entry")
+	}
+}
+
+func TestEncryptedDependencyDescriptor(t *testing.T) {
+	up := &rtpUpTrack{layers: &layerTable{}, encrypted: true}
+	down := &rtpDownTrack{remote: up}
+
+	if down.keyframesKnown() {
+		t.Errorf("Keyframes known before any descriptor")
+	}
+
+	// a structure with a single template and decode target
+	dd := []byte{0xC0, 0x00, 0x01, 0x80, 0x00, 0xE0}
+	s, kf, ok := up.gotDependencyDescriptor(1, false, dd, nil)
+	if s == nil || !kf || !ok {
+		t.Fatalf("Got %v %v %v", s, kf, ok)
+	}
+
+	s2, kf, ok := up.gotDependencyDescriptor(
+		2, true, []byte{0xC0, 0x00, 0x02}, s,
+	)
+	if s2 != s || kf || !ok {
+		t.Errorf("Got %v %v %v", s2, kf, ok)
+	}
+
+	if !down.keyframesKnown() {
+		t.Errorf("Keyframes unknown after descriptor")
+	}
+
+	flags := codecs.Flags{Seqno: 1}
+	if !up.layerFlags(&flags) || !flags.Keyframe || !flags.Start {
+		t.Errorf("Unexpected flags %#v", flags)
+	}
+	flags = codecs.Flags{Seqno: 2}
+	if !up.layerFlags(&flags) || flags.Keyframe || !flags.End {
+		t.Errorf("Unexpected flags %#v", flags)
+	}
+}
@@ -0,0 +1,86 @@
+package rtpconn
+
+import (
+	"sort"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// lastN returns the set of at most n clients whose video should be
+// forwarded to client self.  These are the most recent speakers, completed
+// by the remaining publishers in a deterministic order.  Publishers is
+// the list of clients publishing video; it is sorted in place.
+func lastN(self string, n int, speakers []string, publishers []string) map[string]bool {
+	result := make(map[string]bool, n)
+	if n <= 0 {
+		return result
+	}
+
+	isPublisher := make(map[string]bool, len(publishers))
+	for _, p := range publishers {
+		isPublisher[p] = true
+	}
+
+	for _, s := range speakers {
+		if len(result) >= n {
+			return result
+		}
+		if s != self && isPublisher[s] {
+			result[s] = true
+		}
+	}
+
+	sort.Strings(publishers)
+	for _, p := range publishers {
+		if len(result) >= n {
+			break
+		}
+		if p != self {
+			result[p] = true
+		}
+	}
+	return result
+}
+
+// updateLastN pauses or resumes the video tracks of the down connections
+// of client c according to the group's last-n setting.  Audio tracks and
+// pinned connections are never paused.
+func updateLastN(c *webClient) {
+	g := c.group
+	if g == nil {
+		return
+	}
+	n := g.Description().LastN
+
+	c.mu.Lock()
+	down := make([]*rtpDownConnection, 0, len(c.down))
+	for _, d := range c.down {
+		down = append(down, d)
+	}
+	c.mu.Unlock()
+
+	var forward map[string]bool
+	if n > 0 {
+		var publishers []string
+		for _, d := range down {
+			for _, t := range d.getTracks() {
+				if t.remote.Kind() == webrtc.RTPCodecTypeVideo {
+					id, _ := d.remote.User()
+					publishers = append(publishers, id)
+					break
+				}
+			}
+		}
+		forward = lastN(c.id, n, g.RecentSpeakers(), publishers)
+	}
+
+	for _, d := range down {
+		id, _ := d.remote.User()
+		pause := n > 0 && !d.pinned && !forward[id]
+		for _, t := range d.getTracks() {
+			if t.remote.Kind() == webrtc.RTPCodecTypeVideo {
+				t.setPaused(pauseLastN, pause)
+			}
+		}
+	}
+}
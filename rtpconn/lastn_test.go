@@ -0,0 +1,39 @@
+package rtpconn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLastN(t *testing.T) {
+	tests := []struct {
+		n          int
+		speakers   []string
+		publishers []string
+		result     []string
+	}{
+		{0, []string{"a"}, []string{"a", "b"}, nil},
+		{2, nil, []string{"c", "b", "a"}, []string{"a", "b"}},
+		{2, []string{"c"}, []string{"c", "b", "a"}, []string{"a", "c"}},
+		{2, []string{"c", "self", "a"}, []string{"a", "b", "c", "self"},
+			[]string{"a", "c"}},
+		{2, []string{"d", "c"}, []string{"a", "b", "c"},
+			[]string{"a", "c"}},
+		{3, []string{"b"}, []string{"self", "b", "b"},
+			[]string{"b"}},
+	}
+
+	for _, test := range tests {
+		result := lastN("self", test.n, test.speakers, test.publishers)
+		expected := make(map[string]bool)
+		for _, r := range test.result {
+			expected[r] = true
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("lastN(%v, %v, %v): expected %v, got %v",
+				test.n, test.speakers, test.publishers,
+				expected, result,
+			)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package rtpconn
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/group"
+)
+
+type localBinding struct {
+	id       string
+	ssrc     webrtc.SSRC
+	ptype    webrtc.PayloadType
+	rtxSSRC  webrtc.SSRC
+	rtxPtype webrtc.PayloadType
+	rtxSeqno uint16
+	redPtype webrtc.PayloadType
+	writer   webrtc.TrackLocalWriter
+}
+
+// localTrack is a local track that is able to send retransmissions in
+// RTX format (RFC 4588) and redundant audio (RFC 2198) when these have
+// been negotiated.
+type localTrack struct {
+	*webrtc.TrackLocalStaticRTP
+
+	mu       sync.Mutex
+	bindings []localBinding
+}
+
+func newLocalTrack(c webrtc.RTPCodecCapability, id, streamID string) (*localTrack, error) {
+	t, err := webrtc.NewTrackLocalStaticRTP(c, id, streamID)
+	if err != nil {
+		return nil, err
+	}
+	return &localTrack{TrackLocalStaticRTP: t}, nil
+}
+
+// rtxPayloadType returns the payload type of the RTX codec associated
+// with ptype, or 0 if none was negotiated.
+func rtxPayloadType(ptype webrtc.PayloadType, codecs []webrtc.RTPCodecParameters) webrtc.PayloadType {
+	for _, c := range codecs {
+		if !strings.EqualFold(c.MimeType, webrtc.MimeTypeRTX) {
+			continue
+		}
+		apt := group.FmtpValue(c.SDPFmtpLine, "apt")
+		if apt == "" {
+			continue
+		}
+		v, err := strconv.Atoi(apt)
+		if err == nil && webrtc.PayloadType(v) == ptype {
+			return c.PayloadType
+		}
+	}
+	return 0
+}
+
+// redPayloadType returns the payload type of the RED codec that
+// encapsulates ptype, or 0 if none was negotiated.
+func redPayloadType(ptype webrtc.PayloadType, codecs []webrtc.RTPCodecParameters) webrtc.PayloadType {
+	for _, c := range codecs {
+		if !strings.EqualFold(c.MimeType, "audio/red") {
+			continue
+		}
+		ok := true
+		for _, f := range strings.Split(c.SDPFmtpLine, "/") {
+			v, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || webrtc.PayloadType(v) != ptype {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return c.PayloadType
+		}
+	}
+	return 0
+}
+
+// Bind implements the webrtc.TrackLocal interface.
+func (t *localTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+
+	b := localBinding{
+		id:     ctx.ID(),
+		ssrc:   ctx.SSRC(),
+		ptype:  codec.PayloadType,
+		writer: ctx.WriteStream(),
+	}
+	ptype := rtxPayloadType(codec.PayloadType, ctx.CodecParameters())
+	if ssrc := ctx.SSRCRetransmission(); ssrc != 0 && ptype != 0 {
+		b.rtxSSRC = ssrc
+		b.rtxPtype = ptype
+		b.rtxSeqno = uint16(rand.Uint32())
+	}
+	b.redPtype = redPayloadType(codec.PayloadType, ctx.CodecParameters())
+
+	t.mu.Lock()
+	t.bindings = append(t.bindings, b)
+	t.mu.Unlock()
+	return codec, nil
+}
+
+// Unbind implements the webrtc.TrackLocal interface.
+func (t *localTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	for i := range t.bindings {
+		if t.bindings[i].id == ctx.ID() {
+			t.bindings = append(t.bindings[:i], t.bindings[i+1:]...)
+			break
+		}
+	}
+	t.mu.Unlock()
+	return t.TrackLocalStaticRTP.Unbind(ctx)
+}
+
+// hasRED returns true if RED has been negotiated.
+func (t *localTrack) hasRED() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range t.bindings {
+		if b.redPtype != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteRTX sends a retransmission of the packet buf.  If RTX has not
+// been negotiated, the packet is sent on the media stream.
+func (t *localTrack) WriteRTX(buf []byte) (int, error) {
+	var packet rtp.Packet
+	err := packet.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	ibuf := packetBufPool.Get()
+	defer packetBufPool.Put(ibuf)
+	payload := ibuf.([]byte)
+	if len(packet.Payload)+2 > len(payload) {
+		return 0, errTruncated
+	}
+	binary.BigEndian.PutUint16(payload, packet.SequenceNumber)
+	n := 2 + copy(payload[2:], packet.Payload)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.bindings {
+		b := &t.bindings[i]
+		header := packet.Header
+		var err error
+		if b.rtxSSRC == 0 {
+			header.SSRC = uint32(b.ssrc)
+			header.PayloadType = uint8(b.ptype)
+			_, err = b.writer.WriteRTP(&header, packet.Payload)
+		} else {
+			header.Padding = false
+			header.PaddingSize = 0
+			header.SSRC = uint32(b.rtxSSRC)
+			header.PayloadType = uint8(b.rtxPtype)
+			header.SequenceNumber = b.rtxSeqno
+			b.rtxSeqno++
+			_, err = b.writer.WriteRTP(&header, payload[:n])
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
+
+// WriteRED sends the packet buf, together with the redundant blocks, in
+// RED format.  If RED has not been negotiated, the packet is sent as is.
+func (t *localTrack) WriteRED(buf []byte, blocks []redBlock) (int, error) {
+	var packet rtp.Packet
+	err := packet.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	ibuf := packetBufPool.Get()
+	defer packetBufPool.Put(ibuf)
+	payload := ibuf.([]byte)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.bindings {
+		b := &t.bindings[i]
+		header := packet.Header
+		header.SSRC = uint32(b.ssrc)
+		var err error
+		if b.redPtype == 0 {
+			header.PayloadType = uint8(b.ptype)
+			_, err = b.writer.WriteRTP(&header, packet.Payload)
+		} else {
+			var n int
+			n, err = redPayload(
+				payload, uint8(b.ptype), packet.Timestamp,
+				packet.Payload, blocks,
+			)
+			if err != nil {
+				return 0, err
+			}
+			header.Padding = false
+			header.PaddingSize = 0
+			header.PayloadType = uint8(b.redPtype)
+			_, err = b.writer.WriteRTP(&header, payload[:n])
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(buf), nil
+}
@@ -0,0 +1,100 @@
+package rtpconn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/group"
+)
+
+func TestRTXPayloadType(t *testing.T) {
+	codecs := []webrtc.RTPCodecParameters{
+		{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType: "video/VP8", ClockRate: 90000,
+			},
+			PayloadType: 96,
+		},
+		group.RTXCodec(96),
+		group.RTXCodec(98),
+	}
+	if pt := rtxPayloadType(96, codecs); pt != 97 {
+		t.Errorf("Expected 97, got %v", pt)
+	}
+	if pt := rtxPayloadType(98, codecs); pt != 99 {
+		t.Errorf("Expected 99, got %v", pt)
+	}
+	if pt := rtxPayloadType(102, codecs); pt != 0 {
+		t.Errorf("Expected 0, got %v", pt)
+	}
+}
+
+type testWriter struct {
+	header  rtp.Header
+	payload []byte
+}
+
+func (w *testWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	w.header = *header
+	w.payload = append([]byte(nil), payload...)
+	return header.MarshalSize() + len(payload), nil
+}
+
+func (w *testWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func TestWriteRTX(t *testing.T) {
+	track, err := newLocalTrack(
+		webrtc.RTPCodecCapability{MimeType: "video/VP8", ClockRate: 90000},
+		"video", "stream",
+	)
+	if err != nil {
+		t.Fatalf("newLocalTrack: %v", err)
+	}
+	w := &testWriter{}
+	track.bindings = []localBinding{
+		{
+			id: "id", ssrc: 17, ptype: 96,
+			rtxSSRC: 42, rtxPtype: 97, rtxSeqno: 1000,
+			writer: w,
+		},
+	}
+
+	packet := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 0x1234,
+			Timestamp:      4242,
+			SSRC:           17,
+			Marker:         true,
+		},
+		Payload: []byte{1, 2, 3},
+	}
+	buf, err := packet.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	_, err = track.WriteRTX(buf)
+	if err != nil {
+		t.Fatalf("WriteRTX: %v", err)
+	}
+	if w.header.SSRC != 42 || w.header.PayloadType != 97 ||
+		w.header.SequenceNumber != 1000 ||
+		w.header.Timestamp != 4242 || !w.header.Marker {
+		t.Errorf("Unexpected header %v", w.header)
+	}
+	if !bytes.Equal(w.payload, []byte{0x12, 0x34, 1, 2, 3}) {
+		t.Errorf("Unexpected payload %v", w.payload)
+	}
+
+	track.WriteRTX(buf)
+	if w.header.SequenceNumber != 1001 {
+		t.Errorf("Expected 1001, got %v", w.header.SequenceNumber)
+	}
+}
@@ -0,0 +1,447 @@
+package rtpconn
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/conn"
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/mixer"
+	"github.com/jech/galene/rtptime"
+)
+
+// the id and label of the stream carrying mixed audio
+const mixerConnId = "audio-mixer"
+
+// the bitrate of mixed audio
+const mixerBitrate = 32000
+
+var mixerCodec = webrtc.RTPCodecCapability{
+	MimeType:     "audio/opus",
+	ClockRate:    48000,
+	Channels:     2,
+	SDPFmtpLine:  "minptime=10;useinbandfec=1",
+	RTCPFeedback: group.AudioRTCPFeedback,
+}
+
+var warnedNoOpus sync.Once
+
+// audioMixing returns the number of speakers that are mixed in group g,
+// or 0 if audio is forwarded normally.  Encrypted audio is never mixed.
+func audioMixing(g *group.Group) int {
+	if g == nil {
+		return 0
+	}
+	desc := g.Description()
+	n := desc.AudioMixing
+	if n <= 0 || desc.E2EE {
+		return 0
+	}
+	if !mixer.Available {
+		warnedNoOpus.Do(func() {
+			log.Printf("Audio mixing requested, " +
+				"but Opus support is not compiled in")
+		})
+		return 0
+	}
+	return n
+}
+
+// isMixed returns true if t is an up track that is replaced by the
+// mixer in group g.
+func isMixed(g *group.Group, t conn.UpTrack) bool {
+	_, ok := t.(*rtpUpTrack)
+	return ok && t.Kind() == webrtc.RTPCodecTypeAudio &&
+		strings.EqualFold(t.Codec().MimeType, "audio/opus") &&
+		audioMixing(g) > 0
+}
+
+// A groupMixer mixes the audio of a group, and sends a personalised mix
+// to each client.
+type groupMixer struct {
+	group *group.Group
+	mixer *mixer.Mixer
+	done  chan struct{}
+
+	mu      sync.Mutex
+	outputs map[*webClient]*mixerConn
+}
+
+var mixers struct {
+	mu sync.Mutex
+	m  map[*group.Group]*groupMixer
+}
+
+func getMixer(g *group.Group) *groupMixer {
+	mixers.mu.Lock()
+	defer mixers.mu.Unlock()
+	return mixers.m[g]
+}
+
+func (m *groupMixer) getOutputs() []*mixerTrack {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outputs := make([]*mixerTrack, 0, len(m.outputs))
+	for _, up := range m.outputs {
+		outputs = append(outputs, up.track)
+	}
+	return outputs
+}
+
+func (m *groupMixer) run() {
+	ticker := time.NewTicker(time.Second / 50)
+	defer ticker.Stop()
+
+	pcm := make([]int16, mixer.FrameSize)
+	data := make([]byte, 1200)
+	buf := make([]byte, 1500)
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		k := audioMixing(m.group)
+		if k <= 0 {
+			k = 1
+		}
+		f := m.mixer.Next(k)
+		for _, t := range m.getOutputs() {
+			err := t.writeFrame(f, pcm, data, buf)
+			if err != nil {
+				log.Printf("Mixer: %v", err)
+			}
+		}
+	}
+}
+
+// A mixerInput is a down track that decodes audio and feeds it to the
+// group's mixer.
+type mixerInput struct {
+	group     *group.Group
+	id, owner string
+
+	mu      sync.Mutex
+	decoder *mixer.Decoder
+	started bool
+	seqno   uint16
+	pcm     []int16
+}
+
+// addMixerInput arranges for the audio of track to be fed to the mixer,
+// until the track's reader terminates.
+func addMixerInput(track *rtpUpTrack) error {
+	decoder, err := mixer.NewDecoder()
+	if err != nil {
+		return err
+	}
+	client := track.conn.client
+	in := &mixerInput{
+		group:   client.Group(),
+		id:      track.conn.id + "/" + track.track.ID(),
+		owner:   client.Id(),
+		decoder: decoder,
+		// the longest Opus packet is 120ms
+		pcm: make([]int16, 6*mixer.FrameSize),
+	}
+	err = track.AddLocal(in)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-track.readerDone
+		track.DelLocal(in)
+		in.close()
+	}()
+	return nil
+}
+
+// close removes the input's source from the mixer.
+func (in *mixerInput) close() {
+	m := getMixer(in.group)
+	if m != nil {
+		m.mixer.Remove(in.id)
+	}
+}
+
+func (in *mixerInput) Write(buf []byte) (int, error) {
+	m := getMixer(in.group)
+	if m == nil {
+		return len(buf), nil
+	}
+
+	var p rtp.Packet
+	err := p.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.started {
+		delta := p.SequenceNumber - in.seqno
+		if delta == 0 || (delta&0x8000) != 0 {
+			// duplicate or late
+			return len(buf), nil
+		}
+		// conceal short losses
+		for i := uint16(1); i < delta && i <= 2; i++ {
+			n, err := in.decoder.Decode(nil, in.pcm[:mixer.FrameSize])
+			if err == nil {
+				m.mixer.Push(in.id, in.owner, in.pcm[:n])
+			}
+		}
+	}
+	in.started = true
+	in.seqno = p.SequenceNumber
+
+	n, err := in.decoder.Decode(p.Payload, in.pcm)
+	if err != nil {
+		return 0, err
+	}
+	m.mixer.Push(in.id, in.owner, in.pcm[:n])
+	return len(buf), nil
+}
+
+func (in *mixerInput) SetTimeOffset(ntp uint64, rtp uint32) {
+}
+
+func (in *mixerInput) SetCname(string) {
+}
+
+func (in *mixerInput) GetMaxBitrate() (uint64, int, int) {
+	return ^uint64(0), -1, -1
+}
+
+// A mixerTrack is an up track carrying the mix sent to a single client.
+type mixerTrack struct {
+	client  *webClient
+	encoder *mixer.Encoder
+	ssrc    uint32
+
+	mu        sync.Mutex
+	seqno     uint16
+	timestamp uint32
+	local     []conn.DownTrack
+}
+
+func (t *mixerTrack) AddLocal(local conn.DownTrack) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, l := range t.local {
+		if l == local {
+			return nil
+		}
+	}
+	local.SetTimeOffset(rtptime.TimeToNTP(time.Now()), t.timestamp)
+	local.SetCname(mixerConnId)
+	t.local = append(t.local, local)
+	return nil
+}
+
+func (t *mixerTrack) DelLocal(local conn.DownTrack) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, l := range t.local {
+		if l == local {
+			t.local = append(t.local[:i], t.local[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *mixerTrack) Kind() webrtc.RTPCodecType {
+	return webrtc.RTPCodecTypeAudio
+}
+
+func (t *mixerTrack) Label() string {
+	return mixerConnId
+}
+
+func (t *mixerTrack) Codec() webrtc.RTPCodecCapability {
+	return mixerCodec
+}
+
+func (t *mixerTrack) GetPacket(seqno uint16, result []byte, nack bool) uint16 {
+	return 0
+}
+
+func (t *mixerTrack) RequestKeyframe() error {
+	return nil
+}
+
+// writeFrame encodes the mix of f for the track's client, and writes it
+// to the track's down tracks.
+func (t *mixerTrack) writeFrame(f *mixer.Frame, pcm []int16, data []byte, buf []byte) error {
+	f.Mix(t.client.Id(), pcm)
+	n, err := t.encoder.Encode(pcm, data)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	p := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    111, // rewritten by the down track
+			SequenceNumber: t.seqno,
+			Timestamp:      t.timestamp,
+			SSRC:           t.ssrc,
+		},
+		Payload: data[:n],
+	}
+	t.seqno++
+	t.timestamp += mixer.FrameSize
+	local := append([]conn.DownTrack(nil), t.local...)
+	t.mu.Unlock()
+
+	l, err := p.MarshalTo(buf)
+	if err != nil {
+		return err
+	}
+	for _, d := range local {
+		d.Write(buf[:l])
+	}
+	return nil
+}
+
+// A mixerConn is the up connection that carries a client's mix.
+type mixerConn struct {
+	track *mixerTrack
+
+	mu    sync.Mutex
+	local []conn.Down
+}
+
+func (up *mixerConn) AddLocal(local conn.Down) error {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	for _, l := range up.local {
+		if l == local {
+			return nil
+		}
+	}
+	up.local = append(up.local, local)
+	return nil
+}
+
+func (up *mixerConn) DelLocal(local conn.Down) bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	for i, l := range up.local {
+		if l == local {
+			up.local = append(up.local[:i], up.local[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (up *mixerConn) Id() string {
+	return mixerConnId
+}
+
+func (up *mixerConn) Label() string {
+	return mixerConnId
+}
+
+func (up *mixerConn) User() (string, string) {
+	return "", ""
+}
+
+// addMixerOutput starts sending mixed audio to c, if audio mixing is
+// enabled in its group.
+func addMixerOutput(c *webClient) error {
+	g := c.group
+	if audioMixing(g) <= 0 {
+		return nil
+	}
+
+	// hold mixers.mu until c is registered, so that delMixerOutput
+	// doesn't stop the mixer under our feet
+	mixers.mu.Lock()
+	m := mixers.m[g]
+	if m == nil {
+		if mixers.m == nil {
+			mixers.m = make(map[*group.Group]*groupMixer)
+		}
+		m = &groupMixer{
+			group:   g,
+			mixer:   mixer.New(),
+			done:    make(chan struct{}),
+			outputs: make(map[*webClient]*mixerConn),
+		}
+		mixers.m[g] = m
+		go m.run()
+	}
+
+	m.mu.Lock()
+	up := m.outputs[c]
+	isnew := up == nil
+	if isnew {
+		encoder, err := mixer.NewEncoder(mixerBitrate)
+		if err != nil {
+			m.mu.Unlock()
+			if len(m.outputs) == 0 {
+				close(m.done)
+				delete(mixers.m, g)
+			}
+			mixers.mu.Unlock()
+			return err
+		}
+		up = &mixerConn{
+			track: &mixerTrack{
+				client:    c,
+				encoder:   encoder,
+				ssrc:      rand.Uint32(),
+				seqno:     uint16(rand.Uint32()),
+				timestamp: rand.Uint32(),
+			},
+		}
+		m.outputs[c] = up
+	}
+	m.mu.Unlock()
+	mixers.mu.Unlock()
+
+	if !isnew && mixerRequested(c) == (getDownConn(c, up.Id()) != nil) {
+		// nothing changed, avoid a renegotiation
+		return nil
+	}
+	return c.PushConn(g, up.Id(), up, []conn.UpTrack{up.track}, "")
+}
+
+// mixerRequested returns true if c wants to receive mixed audio.
+func mixerRequested(c *webClient) bool {
+	req, ok := c.requested[mixerConnId]
+	if !ok {
+		req = c.requested[""]
+	}
+	return member("audio", req.tracks)
+}
+
+// delMixerOutput stops sending mixed audio to c, and stops the mixer if
+// c was its last client.
+func delMixerOutput(c *webClient) {
+	mixers.mu.Lock()
+	defer mixers.mu.Unlock()
+	m := mixers.m[c.group]
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.outputs, c)
+	empty := len(m.outputs) == 0
+	m.mu.Unlock()
+	if empty {
+		close(m.done)
+		delete(mixers.m, c.group)
+	}
+}
@@ -0,0 +1,76 @@
+package rtpconn
+
+import (
+	"testing"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/mixer"
+)
+
+func TestAudioMixingE2EE(t *testing.T) {
+	g, err := group.Add("mixer-test", &group.Description{
+		AudioMixing: 3,
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("mixer-test")
+
+	expected := 0
+	if mixer.Available {
+		expected = 3
+	}
+	if n := audioMixing(g); n != expected {
+		t.Errorf("Got %v, expected %v", n, expected)
+	}
+
+	ge, err := group.Add("mixer-test-e2ee", &group.Description{
+		AudioMixing: 3,
+		E2EE:        true,
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("mixer-test-e2ee")
+
+	if n := audioMixing(ge); n != 0 {
+		t.Errorf("E2EE: got %v, expected 0", n)
+	}
+}
+
+func TestMixerInputClose(t *testing.T) {
+	g, err := group.Add("mixer-close-test", &group.Description{})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("mixer-close-test")
+
+	m := &groupMixer{group: g, mixer: mixer.New()}
+	mixers.mu.Lock()
+	if mixers.m == nil {
+		mixers.m = make(map[*group.Group]*groupMixer)
+	}
+	mixers.m[g] = m
+	mixers.mu.Unlock()
+	defer func() {
+		mixers.mu.Lock()
+		delete(mixers.m, g)
+		mixers.mu.Unlock()
+	}()
+
+	pcm := make([]int16, mixer.FrameSize)
+	for i := range pcm {
+		pcm[i] = 1000
+	}
+	in := &mixerInput{group: g, id: "up/audio", owner: "client"}
+	m.mixer.Push(in.id, in.owner, pcm)
+	m.mixer.Push(in.id, in.owner, pcm)
+	if f := m.mixer.Next(1); f.Len() != 1 {
+		t.Fatalf("Expected one source, got %v", f.Len())
+	}
+
+	in.close()
+	if f := m.mixer.Next(1); f.Len() != 0 {
+		t.Errorf("Expected no sources after close, got %v", f.Len())
+	}
+}
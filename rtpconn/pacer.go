@@ -0,0 +1,154 @@
+package rtpconn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/packetcache"
+)
+
+const (
+	// the minimum pacing rate, in bits per second
+	minPacingRate = 256 * 1024
+	// the maximum number of packets in the queue
+	maxPacerQueue = 512
+	// the largest burst sent at once
+	pacerBurst = 5 * time.Millisecond
+	// how often the pacing rate is recomputed
+	pacerRateInterval = 100 * time.Millisecond
+)
+
+type pacedPacket struct {
+	track *rtpDownTrack
+	buf   []byte
+	time  time.Time
+}
+
+// A pacer is a leaky bucket that spreads the video packets sent on a down
+// connection over time, in order to avoid overflowing router buffers
+// when a keyframe is sent.  Audio and retransmissions bypass the pacer.
+type pacer struct {
+	conn *rtpDownConnection
+
+	mu       sync.Mutex
+	running  bool
+	queue    []pacedPacket
+	budget   float64
+	last     time.Time
+	rate     float64
+	rateTime time.Time
+	// the time spent in the queue by the last packet sent
+	delay time.Duration
+}
+
+func newPacer(conn *rtpDownConnection) *pacer {
+	return &pacer{conn: conn}
+}
+
+// getRate returns the pacing rate in bytes per second.  Called locked.
+func (p *pacer) getRate(now time.Time) float64 {
+	if !p.rateTime.IsZero() && now.Sub(p.rateTime) < pacerRateInterval {
+		return p.rate
+	}
+	rate := uint64(0)
+	for _, t := range p.conn.getTracks() {
+		if t.remote.Kind() != webrtc.RTPCodecTypeVideo || t.isPaused() {
+			continue
+		}
+		r, _, _ := t.GetMaxBitrate()
+		rate = sadd(rate, r)
+	}
+	if rate < minPacingRate {
+		rate = minPacingRate
+	}
+	// allow the queue to drain faster than the estimated rate
+	p.rate = float64(rate) * 2.5 / 8
+	p.rateTime = now
+	return p.rate
+}
+
+// enqueue schedules a packet to be sent on track.
+func (p *pacer) enqueue(track *rtpDownTrack, buf []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.queue) >= maxPacerQueue {
+		atomic.AddUint64(&track.atomics.pacerDropped, 1)
+		return 0, nil
+	}
+
+	b := packetBufPool.Get().([]byte)
+	n := copy(b, buf)
+	p.queue = append(p.queue, pacedPacket{track, b[:n], time.Now()})
+	atomic.AddInt32(&track.atomics.pacerQueued, 1)
+
+	if !p.running {
+		p.running = true
+		go p.run()
+	}
+	return n, nil
+}
+
+// run sends the queued packets, and terminates when the queue is empty.
+func (p *pacer) run() {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+
+		now := time.Now()
+		rate := p.getRate(now)
+		if p.last.IsZero() {
+			p.budget = 0
+		} else {
+			p.budget += rate * now.Sub(p.last).Seconds()
+			burst := rate * pacerBurst.Seconds()
+			if burst < 2*packetcache.BufSize {
+				burst = 2 * packetcache.BufSize
+			}
+			if p.budget > burst {
+				p.budget = burst
+			}
+		}
+		p.last = now
+
+		if p.budget < 0 {
+			wait := time.Duration(
+				-p.budget / rate * float64(time.Second),
+			)
+			p.mu.Unlock()
+			if wait < time.Millisecond {
+				wait = time.Millisecond
+			}
+			time.Sleep(wait)
+			continue
+		}
+
+		pkt := p.queue[0]
+		p.queue[0] = pacedPacket{}
+		p.queue = p.queue[1:]
+		p.budget -= float64(len(pkt.buf))
+		p.delay = now.Sub(pkt.time)
+		p.mu.Unlock()
+
+		atomic.AddInt32(&pkt.track.atomics.pacerQueued, -1)
+		pkt.track.writeNow(pkt.buf, false)
+		packetBufPool.Put(pkt.buf[:cap(pkt.buf)])
+	}
+}
+
+// getDelay returns the queueing delay of the last packet sent.
+func (p *pacer) getDelay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 && !p.running {
+		return 0
+	}
+	return p.delay
+}
@@ -0,0 +1,64 @@
+package rtpconn
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/estimator"
+	"github.com/jech/galene/rtptime"
+)
+
+func TestPacer(t *testing.T) {
+	down := &rtpDownConnection{}
+	down.pacer = newPacer(down)
+	local, err := newLocalTrack(
+		webrtc.RTPCodecCapability{MimeType: "video/VP8"},
+		"video", "stream",
+	)
+	if err != nil {
+		t.Fatalf("newLocalTrack: %v", err)
+	}
+	track := &rtpDownTrack{
+		track:          local,
+		conn:           down,
+		remote:         &fakeUpTrack{kind: webrtc.RTPCodecTypeVideo},
+		maxBitrate:     new(bitrate),
+		maxREMBBitrate: new(bitrate),
+		rate:           estimator.New(time.Second),
+		atomics:        &downTrackAtomics{},
+	}
+	down.tracks = append(down.tracks, track)
+	// 100kB/s once the pacing factor is applied
+	track.maxBitrate.Set(320000, rtptime.Jiffies())
+
+	buf := make([]byte, 1000)
+	buf[0] = 0x80
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		n, err := track.write(buf, false)
+		if n != len(buf) || err != nil {
+			t.Fatalf("write: %v %v", n, err)
+		}
+	}
+	if atomic.LoadInt32(&track.atomics.pacerQueued) == 0 {
+		t.Errorf("Packets were not queued")
+	}
+
+	for atomic.LoadInt32(&track.atomics.pacerQueued) > 0 {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Pacer didn't drain")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("Pacer drained too fast (%v)", elapsed)
+	}
+	packets, _ := track.rate.Totals()
+	if packets != 20 {
+		t.Errorf("Expected 20 packets, got %v", packets)
+	}
+}
@@ -0,0 +1,92 @@
+package rtpconn
+
+import (
+	"github.com/pion/sdp/v3"
+
+	"github.com/jech/galene/group"
+)
+
+// presentPermissions are the permissions that allow publishing some
+// streams.  The permission "present" allows publishing arbitrary streams,
+// the others are restricted by media type and label.
+var presentPermissions = []string{
+	"present", "present-audio", "present-camera", "present-screenshare",
+}
+
+// CanPresent returns true if perms allow publishing at least some
+// streams.
+func CanPresent(perms []string) bool {
+	for _, p := range presentPermissions {
+		if member(p, perms) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPresent returns a user error if perms don't allow publishing a
+// stream with the given label and media sections.  Audio requires
+// "present-audio", video in a stream labelled "screenshare" requires
+// "present-screenshare", and any other video requires "present-camera".
+func checkPresent(perms []string, label string, o *sdp.SessionDescription) error {
+	if member("present", perms) {
+		return nil
+	}
+	if !CanPresent(perms) {
+		return group.UserError("not authorised")
+	}
+	if o == nil {
+		return nil
+	}
+	for _, m := range o.MediaDescriptions {
+		switch m.MediaName.Media {
+		case "audio":
+			if !member("present-audio", perms) {
+				return group.UserError(
+					"not authorised to send audio",
+				)
+			}
+		case "video":
+			if label == "screenshare" {
+				if !member("present-screenshare", perms) {
+					return group.UserError(
+						"not authorised to share screen",
+					)
+				}
+			} else if !member("present-camera", perms) {
+				return group.UserError(
+					"not authorised to send video",
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// checkStreamLimit returns a user error if a client that already
+// publishes n streams may not publish another one in group g.
+func checkStreamLimit(g *group.Group, n int) error {
+	if g == nil {
+		return nil
+	}
+	limit := g.Description().MaxClientStreams
+	if limit > 0 && n >= limit {
+		return group.UserError("too many streams")
+	}
+	return nil
+}
+
+// checkUpConn is like checkPresent, but applies to an existing
+// connection.
+func checkUpConn(perms []string, up *rtpUpConnection) error {
+	var o *sdp.SessionDescription
+	desc := up.pc.RemoteDescription()
+	if desc != nil {
+		var err error
+		o, err = desc.Unmarshal()
+		if err != nil {
+			return err
+		}
+	}
+	return checkPresent(perms, up.label, o)
+}
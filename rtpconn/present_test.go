@@ -0,0 +1,146 @@
+package rtpconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+
+	"github.com/jech/galene/group"
+)
+
+func makeOffer(media ...string) string {
+	offer := "v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n"
+	for _, m := range media {
+		offer += "m=" + m + " 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+			"c=IN IP4 0.0.0.0\r\n"
+	}
+	return offer
+}
+
+func parseOffer(t *testing.T, offer string) *sdp.SessionDescription {
+	var o sdp.SessionDescription
+	err := o.Unmarshal([]byte(offer))
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return &o
+}
+
+func TestCheckPresent(t *testing.T) {
+	tests := []struct {
+		perms []string
+		label string
+		media []string
+		ok    bool
+	}{
+		{[]string{"present"}, "camera", []string{"audio", "video"}, true},
+		{[]string{"present"}, "video", []string{"audio", "video"}, true},
+		{[]string{"message"}, "camera", []string{"audio"}, false},
+		{[]string{}, "camera", nil, false},
+		{[]string{"present-audio"}, "camera", []string{"audio"}, true},
+		{[]string{"present-audio"}, "camera", []string{"video"}, false},
+		{[]string{"present-audio"}, "screenshare", []string{"audio"}, true},
+		{[]string{"present-camera"}, "camera", []string{"video"}, true},
+		{[]string{"present-camera"}, "camera",
+			[]string{"audio", "video"}, false},
+		{[]string{"present-audio", "present-camera"}, "camera",
+			[]string{"audio", "video"}, true},
+		{[]string{"present-camera"}, "screenshare",
+			[]string{"video"}, false},
+		{[]string{"present-screenshare"}, "screenshare",
+			[]string{"video"}, true},
+		{[]string{"present-screenshare"}, "screenshare",
+			[]string{"video", "application"}, true},
+		{[]string{"present-camera"}, "video", []string{"video"}, true},
+		{[]string{"present-screenshare"}, "video",
+			[]string{"video"}, false},
+		{[]string{"present-audio"}, "", []string{"audio"}, true},
+		{[]string{"present-audio"}, "", []string{"video"}, false},
+	}
+
+	for _, test := range tests {
+		o := parseOffer(t, makeOffer(test.media...))
+		err := checkPresent(test.perms, test.label, o)
+		if test.ok && err != nil {
+			t.Errorf("%v %v %v: %v",
+				test.perms, test.label, test.media, err)
+		} else if !test.ok {
+			var uerr group.UserError
+			if !errors.As(err, &uerr) {
+				t.Errorf("%v %v %v: got %v, expected user error",
+					test.perms, test.label, test.media, err)
+			}
+		}
+	}
+}
+
+func TestAddUpConnLimits(t *testing.T) {
+	g, err := group.Add("present-test", &group.Description{
+		MaxClientStreams: 1,
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("present-test")
+
+	c := &webClient{
+		group:       g,
+		permissions: []string{"present-audio"},
+		up: map[string]*rtpUpConnection{
+			"a": {id: "a", label: "camera"},
+		},
+	}
+
+	_, _, err = addUpConn(c, "b", "camera", makeOffer("video"), "")
+	if err == nil || err.Error() != "not authorised to send video" {
+		t.Errorf("Video: got %v", err)
+	}
+
+	_, _, err = addUpConn(c, "b", "camera", makeOffer("audio"), "")
+	if err == nil || err.Error() != "too many streams" {
+		t.Errorf("Limit: got %v", err)
+	}
+
+	up, isnew, err := addUpConn(c, "b", "camera", makeOffer("audio"), "a")
+	if err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	defer up.pc.Close()
+	if !isnew || c.up["b"] != up {
+		t.Errorf("Replace: got %v %v", isnew, c.up)
+	}
+}
+
+func TestWhipCheckOffer(t *testing.T) {
+	g, err := group.Add("present-whip-test", &group.Description{
+		MaxClientStreams: 1,
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("present-whip-test")
+
+	c := NewWhipClient(g, "id", "", nil)
+	c.SetPermissions([]string{"present-audio"})
+
+	_, err = c.NewConnection(context.Background(), []byte(makeOffer("video")))
+	if err == nil || err.Error() != "not authorised to send video" {
+		t.Errorf("Video: got %v", err)
+	}
+
+	_, err = c.GotOffer(context.Background(), []byte(makeOffer("video")))
+	if err == nil || err.Error() != "not authorised to send video" {
+		t.Errorf("Renegotiation: got %v", err)
+	}
+
+	c.connection = &rtpUpConnection{id: "id"}
+	_, err = c.NewConnection(context.Background(), []byte(makeOffer("audio")))
+	if err == nil || err.Error() != "too many streams" {
+		t.Errorf("Limit: got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package rtpconn
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/pion/rtp"
+
+	"github.com/jech/galene/rtptime"
+)
+
+const (
+	// the loss rate, out of 256, above which we start sending
+	// redundant audio
+	redLossThreshold = 5
+	// the loss rate above which we send two redundant blocks
+	redLossThreshold2 = 25
+)
+
+// A redBlock is a redundant block of a RED packet.
+type redBlock struct {
+	timestamp uint32
+	payload   []byte
+}
+
+var errREDBlock = errors.New("couldn't encode RED block")
+
+// redPayload encodes a RED payload (RFC 2198) into dst.  Ptype is the
+// payload type of the encapsulated codec, timestamp and primary are the
+// timestamp and payload of the primary encoding, and blocks are the
+// redundant blocks, oldest first.  It returns the length of the payload.
+func redPayload(dst []byte, ptype uint8, timestamp uint32, primary []byte, blocks []redBlock) (int, error) {
+	n := 0
+	for _, b := range blocks {
+		offset := timestamp - b.timestamp
+		if offset >= 1<<14 || len(b.payload) >= 1<<10 {
+			return 0, errREDBlock
+		}
+		if n+4 > len(dst) {
+			return 0, errTruncated
+		}
+		dst[n] = 0x80 | (ptype & 0x7F)
+		dst[n+1] = byte(offset >> 6)
+		dst[n+2] = byte(offset<<2) | byte(len(b.payload)>>8)
+		dst[n+3] = byte(len(b.payload))
+		n += 4
+	}
+	if n+1 > len(dst) {
+		return 0, errTruncated
+	}
+	dst[n] = ptype & 0x7F
+	n++
+
+	for _, b := range blocks {
+		if n+len(b.payload) > len(dst) {
+			return 0, errTruncated
+		}
+		n += copy(dst[n:], b.payload)
+	}
+	if n+len(primary) > len(dst) {
+		return 0, errTruncated
+	}
+	n += copy(dst[n:], primary)
+	return n, nil
+}
+
+// redundancy returns the number of redundant blocks that should be sent
+// on down track, or 0 if RED should not be used.  We only use RED for
+// Opus, and only when the receiver reports loss.
+func (down *rtpDownTrack) redundancy() int {
+	if !strings.EqualFold(down.remote.Codec().MimeType, "audio/opus") {
+		return 0
+	}
+	// the receiver's decryption would not expect RED
+	if up, ok := down.remote.(*rtpUpTrack); ok && up.encrypted {
+		return 0
+	}
+	loss, _ := down.stats.Get(rtptime.Jiffies())
+	if loss < redLossThreshold || !down.track.hasRED() {
+		return 0
+	}
+	if loss < redLossThreshold2 {
+		return 1
+	}
+	return 2
+}
+
+// writeRED writes the packet buf together with count previous packets
+// from the cache in RED format.
+func (down *rtpDownTrack) writeRED(buf []byte, count int) (int, error) {
+	var packet rtp.Packet
+	err := packet.Unmarshal(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	blocks := make([]redBlock, 0, count)
+	for i := count; i >= 1; i-- {
+		ok, seqno, _ := down.packetmap.Reverse(
+			packet.SequenceNumber - uint16(i),
+		)
+		if !ok {
+			continue
+		}
+		ibuf := packetBufPool.Get()
+		defer packetBufPool.Put(ibuf)
+		rbuf := ibuf.([]byte)
+		l := down.remote.GetPacket(seqno, rbuf, false)
+		if l == 0 {
+			continue
+		}
+		var p rtp.Packet
+		err := p.Unmarshal(rbuf[:l])
+		if err != nil {
+			continue
+		}
+		offset := packet.Timestamp - p.Timestamp
+		if offset == 0 || offset >= 1<<14 || len(p.Payload) >= 1<<10 {
+			continue
+		}
+		blocks = append(blocks, redBlock{p.Timestamp, p.Payload})
+	}
+
+	return down.track.WriteRED(buf, blocks)
+}
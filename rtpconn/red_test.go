@@ -0,0 +1,56 @@
+package rtpconn
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/group"
+)
+
+func TestREDPayload(t *testing.T) {
+	buf := make([]byte, 1500)
+	n, err := redPayload(buf, 111, 1960, []byte{1, 2, 3},
+		[]redBlock{
+			{1000, []byte{4, 5}},
+			{1960 - 960, []byte{6}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("redPayload: %v", err)
+	}
+	expected := []byte{
+		0x80 | 111, 960 >> 6, (960<<2)&0xFF | 0, 2,
+		0x80 | 111, 960 >> 6, (960<<2)&0xFF | 0, 1,
+		111,
+		4, 5, 6, 1, 2, 3,
+	}
+	if !bytes.Equal(buf[:n], expected) {
+		t.Errorf("Expected %v, got %v", expected, buf[:n])
+	}
+
+	n, err = redPayload(buf, 111, 1000, []byte{1}, nil)
+	if err != nil || !bytes.Equal(buf[:n], []byte{111, 1}) {
+		t.Errorf("Expected [111 1], got %v (%v)", buf[:n], err)
+	}
+
+	_, err = redPayload(buf, 111, 1<<15, []byte{1},
+		[]redBlock{{0, []byte{2}}},
+	)
+	if err == nil {
+		t.Errorf("Expected error for large offset")
+	}
+}
+
+func TestREDPayloadType(t *testing.T) {
+	codecs := []webrtc.RTPCodecParameters{
+		group.REDCodec(111),
+	}
+	if pt := redPayloadType(111, codecs); pt != 63 {
+		t.Errorf("Expected 63, got %v", pt)
+	}
+	if pt := redPayloadType(9, codecs); pt != 0 {
+		t.Errorf("Expected 0, got %v", pt)
+	}
+}
@@ -1,6 +1,7 @@
 package rtpconn
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"log"
@@ -72,16 +73,21 @@ type iceConnection interface {
 }
 
 type downTrackAtomics struct {
-	rtt       uint64
-	sr        uint64
-	srNTP     uint64
-	remoteNTP uint64
-	remoteRTP uint32
-	layerInfo uint32
+	rtt          uint64
+	sr           uint64
+	srNTP        uint64
+	remoteNTP    uint64
+	pacerDropped uint64
+	remoteRTP    uint32
+	tsDelta      uint32
+	layerInfo    uint32
+	paused       uint32
+	twccId       uint32
+	pacerQueued  int32
 }
 
 type rtpDownTrack struct {
-	track          *webrtc.TrackLocalStaticRTP
+	track          *localTrack
 	sender         *webrtc.RTPSender
 	conn           *rtpDownConnection
 	remote         conn.UpTrack
@@ -93,9 +99,23 @@ type rtpDownTrack struct {
 	stats          *receiverStats
 	atomics        *downTrackAtomics
 	cname          atomic.Value
+	constraints    atomic.Value
+
+	// the simulcast track being forwarded, if it differs from remote,
+	// and the one that we are switching to, see reselectTrack.
+	// Switches are serialised by sourceMu, which is also held when
+	// writing once switching has been set.
+	source    atomic.Pointer[rtpUpTrack]
+	pending   atomic.Pointer[rtpUpTrack]
+	switching atomic.Bool
+	sourceMu  sync.Mutex
 }
 
 func (down *rtpDownTrack) SetTimeOffset(ntp uint64, rtp uint32) {
+	if down.pending.Load() != nil {
+		// we cannot tell which track this comes from
+		return
+	}
 	atomic.StoreUint64(&down.atomics.remoteNTP, ntp)
 	atomic.StoreUint32(&down.atomics.remoteRTP, rtp)
 }
@@ -167,6 +187,73 @@ func (down *rtpDownTrack) setLayerInfo(info layerInfo) {
 	)
 }
 
+// Reasons why forwarding to a down track may be paused.
+const (
+	// the track's source is not among the last-n speakers
+	pauseLastN uint32 = 1 << iota
+
+	// the client asked us to stop forwarding
+	pauseClient
+
+	// forwarding has been resumed, but we're waiting for a keyframe
+	pauseKeyframe uint32 = 1 << 31
+)
+
+// setPaused pauses or resumes forwarding to a down track.  Forwarding is
+// only resumed when all reasons for pausing have been cleared and
+// a keyframe has been received.
+func (down *rtpDownTrack) setPaused(reason uint32, paused bool) {
+	for {
+		old := atomic.LoadUint32(&down.atomics.paused)
+		var new uint32
+		resumed := false
+		if paused {
+			new = (old | reason) &^ pauseKeyframe
+		} else {
+			new = old &^ reason
+			if new == 0 && old != 0 &&
+				down.remote.Kind() == webrtc.RTPCodecTypeVideo {
+				if down.keyframesKnown() {
+					new = pauseKeyframe
+				} else {
+					// we cannot wait for a keyframe
+					resumed = true
+				}
+			}
+		}
+		if new == old {
+			return
+		}
+		if atomic.CompareAndSwapUint32(
+			&down.atomics.paused, old, new,
+		) {
+			if new == pauseKeyframe || resumed {
+				down.getSource().RequestKeyframe()
+			}
+			return
+		}
+	}
+}
+
+func (down *rtpDownTrack) isPaused() bool {
+	return atomic.LoadUint32(&down.atomics.paused) != 0
+}
+
+// pauseTracks pauses or resumes forwarding on behalf of the client to
+// the tracks of down whose id is in ids, or to all tracks if ids is
+// empty.  It returns false if no track matched.
+func (down *rtpDownConnection) pauseTracks(ids []string, pause bool) bool {
+	found := false
+	for _, t := range down.getTracks() {
+		if len(ids) > 0 && !member(t.track.ID(), ids) {
+			continue
+		}
+		t.setPaused(pauseClient, pause)
+		found = true
+	}
+	return found
+}
+
 const (
 	negotiationUnneeded = iota
 	negotiationNeeded
@@ -175,14 +262,19 @@ const (
 
 type rtpDownConnection struct {
 	id                string
+	client            group.Client
 	pc                *webrtc.PeerConnection
 	remote            conn.Up
 	iceCandidates     []*webrtc.ICECandidateInit
 	negotiationNeeded int
-	requested         []string
+	requested         *streamRequest
+	pinned            bool
+	twcc              *twccState
+	pacer             *pacer
 
-	mu     sync.Mutex
-	tracks []*rtpDownTrack
+	mu       sync.Mutex
+	tracks   []*rtpDownTrack
+	channels map[*upDataChannel]*webrtc.DataChannel
 }
 
 func (down *rtpDownConnection) getTracks() []*rtpDownTrack {
@@ -194,7 +286,7 @@ func (down *rtpDownConnection) getTracks() []*rtpDownTrack {
 }
 
 func newDownConn(c group.Client, id string, remote conn.Up) (*rtpDownConnection, error) {
-	api, err := c.Group().API()
+	api, err := c.Group().DownAPI()
 	if err != nil {
 		return nil, err
 	}
@@ -209,9 +301,12 @@ func newDownConn(c group.Client, id string, remote conn.Up) (*rtpDownConnection,
 
 	conn := &rtpDownConnection{
 		id:     id,
+		client: c,
 		pc:     pc,
 		remote: remote,
+		twcc:   newTWCCState(),
 	}
+	conn.pacer = newPacer(conn)
 
 	return conn, nil
 }
@@ -223,16 +318,52 @@ var packetBufPool = sync.Pool{
 }
 
 func (down *rtpDownTrack) Write(buf []byte) (int, error) {
+	return down.writePacket(buf, false)
+}
+
+// writePacket writes a packet to the down track.  If rtx is true, the
+// packet is a retransmission, and is sent in RTX format if possible.
+func (down *rtpDownTrack) writePacket(buf []byte, rtx bool) (int, error) {
+	if !down.switching.Load() {
+		return down.forwardPacket(down.remote, buf, rtx)
+	}
+
+	down.sourceMu.Lock()
+	defer down.sourceMu.Unlock()
+	source, err := down.packetSource(buf)
+	if source == nil || err != nil {
+		return 0, err
+	}
+	return down.forwardPacket(source, buf, rtx)
+}
+
+// forwardPacket writes a packet received from source to the down track.
+func (down *rtpDownTrack) forwardPacket(source conn.UpTrack, buf []byte, rtx bool) (int, error) {
 	codec := down.remote.Codec().MimeType
 
-	flags, err := codecs.PacketFlags(codec, buf)
+	flags, err := down.packetFlags(source, buf)
 	if err != nil {
 		return 0, err
 	}
 
+	if paused := atomic.LoadUint32(&down.atomics.paused); paused != 0 {
+		if paused != pauseKeyframe || !flags.Keyframe {
+			// a reordered packet cannot be dropped without
+			// leaving a gap, forward it
+			if down.packetmap.Drop(flags.Seqno, flags.Pid) {
+				return 0, nil
+			}
+		} else {
+			atomic.CompareAndSwapUint32(
+				&down.atomics.paused, pauseKeyframe, 0,
+			)
+		}
+	}
+
 	layer := down.getLayerInfo()
 
 	if flags.Tid > layer.maxTid || flags.Sid > layer.maxSid {
+		oldSid, oldTid := layer.sid, layer.tid
 		if flags.Tid > layer.maxTid {
 			// increase eagerly if this is the first time we
 			// see a given layer
@@ -249,6 +380,20 @@ func (down *rtpDownTrack) Write(buf []byte) (int, error) {
 			}
 			layer.maxSid = flags.Sid
 		}
+		// don't increase beyond what the subscriber asked for
+		maxSid, maxTid := down.layerLimits(layer)
+		if layer.wantedTid > maxTid {
+			layer.wantedTid = maxTid
+		}
+		if layer.tid > oldTid && layer.tid > maxTid {
+			layer.tid = max(oldTid, maxTid)
+		}
+		if layer.wantedSid > maxSid {
+			layer.wantedSid = maxSid
+		}
+		if layer.sid > oldSid && layer.sid > maxSid {
+			layer.sid = max(oldSid, maxSid)
+		}
 		down.setLayerInfo(layer)
 		down.adjustLayer()
 		layer = down.getLayerInfo()
@@ -272,7 +417,7 @@ func (down *rtpDownTrack) Write(buf []byte) (int, error) {
 			layer.sid = layer.wantedSid
 			down.setLayerInfo(layer)
 		} else {
-			down.remote.RequestKeyframe()
+			source.RequestKeyframe()
 		}
 	}
 
@@ -290,9 +435,11 @@ func (down *rtpDownTrack) Write(buf []byte) (int, error) {
 	}
 
 	setMarker := flags.Sid == layer.sid && flags.End && !flags.Marker
+	tsDelta := atomic.LoadUint32(&down.atomics.tsDelta)
 
-	if !setMarker && newseqno == flags.Seqno && piddelta == 0 {
-		return down.write(buf)
+	if !setMarker && newseqno == flags.Seqno && piddelta == 0 &&
+		tsDelta == 0 {
+		return down.write(buf, rtx)
 	}
 
 	ibuf2 := packetBufPool.Get()
@@ -304,11 +451,50 @@ func (down *rtpDownTrack) Write(buf []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return down.write(buf2[:n])
+	if tsDelta != 0 {
+		ts := binary.BigEndian.Uint32(buf2[4:8])
+		binary.BigEndian.PutUint32(buf2[4:8], ts+tsDelta)
+	}
+	return down.write(buf2[:n], rtx)
 }
 
-func (down *rtpDownTrack) write(buf []byte) (int, error) {
-	n, err := down.track.Write(buf)
+// write sends a packet to the down track.  Video packets go through the
+// connection's pacer, unless they are retransmissions.
+func (down *rtpDownTrack) write(buf []byte, rtx bool) (int, error) {
+	if !rtx && down.conn != nil && down.conn.pacer != nil &&
+		down.remote.Kind() == webrtc.RTPCodecTypeVideo {
+		return down.conn.pacer.enqueue(down, buf)
+	}
+	return down.writeNow(buf, rtx)
+}
+
+// writeNow sends a packet to the down track immediately.
+func (down *rtpDownTrack) writeNow(buf []byte, rtx bool) (int, error) {
+	if id := down.getTWCCId(); id != 0 && down.conn.twcc != nil {
+		ibuf2 := packetBufPool.Get()
+		defer packetBufPool.Put(ibuf2)
+		buf2 := ibuf2.([]byte)
+
+		seqno := down.conn.twcc.nextSeqno()
+		n, err := addTransportSeqno(buf2, buf, id, seqno)
+		if err != nil {
+			return 0, err
+		}
+		down.conn.twcc.delay.Sent(
+			seqno, uint32(n), rtptime.Microseconds(),
+		)
+		buf = buf2[:n]
+	}
+
+	var n int
+	var err error
+	if rtx {
+		n, err = down.track.WriteRTX(buf)
+	} else if count := down.redundancy(); count > 0 {
+		n, err = down.writeRED(buf, count)
+	} else {
+		n, err = down.track.Write(buf)
+	}
 	if err == nil {
 		down.rate.Accumulate(uint32(n))
 	}
@@ -326,41 +512,46 @@ func (t *rtpDownTrack) GetMaxBitrate() (uint64, int, int) {
 	if rr != 0 && rr < r {
 		r = rr
 	}
+	rd := t.getDelayBitrate()
+	if rd < r {
+		r = rd
+	}
 	return r, int(layer.sid), int(layer.tid)
 }
 
 // adjustLayer checks the allowable bitrate reported for a down track and
 // adjusts the layer by one step.  It prefers temporal layers, and only
-// uses spatial layers as a last resort.
+// uses spatial layers as a last resort.  It never switches above the
+// layers requested by the subscriber.
 func (t *rtpDownTrack) adjustLayer() {
+	layer := t.getLayerInfo()
+	maxSid, maxTid := t.layerLimits(layer)
+	if layer.wantedSid > maxSid || layer.wantedTid > maxTid {
+		layer.wantedSid = min(layer.wantedSid, maxSid)
+		layer.wantedTid = min(layer.wantedTid, maxTid)
+		t.setLayerInfo(layer)
+		return
+	}
+
 	max, _, _ := t.GetMaxBitrate()
 	r, _ := t.rate.Estimate()
 	rate := uint64(r) * 8
 	if rate < max*7/8 {
 		// switch up
-		layer := t.getLayerInfo()
-		if layer.limitSid && layer.wantedSid != 0 {
-			layer.wantedSid = 0
-			t.setLayerInfo(layer)
-		} else if !layer.limitSid && layer.sid < layer.maxSid {
+		if layer.sid < maxSid {
 			layer.wantedSid = layer.sid + 1
 			t.setLayerInfo(layer)
-		} else if layer.tid < layer.maxTid {
+		} else if layer.tid < maxTid {
 			layer.wantedTid = layer.tid + 1
 			t.setLayerInfo(layer)
 		}
 	} else if rate > max*3/2 {
 		// switch down
-		layer := t.getLayerInfo()
 		if layer.tid > 0 {
 			layer.wantedTid = layer.tid - 1
 			t.setLayerInfo(layer)
 		} else if layer.sid > 0 {
-			if layer.limitSid {
-				layer.wantedSid = 0
-			} else {
-				layer.wantedSid = layer.sid - 1
-			}
+			layer.wantedSid = min(layer.sid-1, maxSid)
 			t.setLayerInfo(layer)
 		}
 	}
@@ -402,7 +593,14 @@ type rtpUpTrack struct {
 	rate     *estimator.Estimator
 	cache    *packetcache.Cache
 	jitter   *jitter.Estimator
-	cname    atomic.Value
+	layers   *layerTable
+	// estimates the framerate, only for video
+	frames *estimator.Estimator
+	// the dimensions of the largest layer, packed as width<<16|height
+	dimensions uint32
+	// the payload is end-to-end encrypted, and cannot be parsed
+	encrypted bool
+	cname     atomic.Value
 
 	actions    *unbounded.Channel[trackAction]
 	readerDone chan struct{}
@@ -502,6 +700,17 @@ func (up *rtpUpTrack) hasRtcpFb(tpe, parameter string) bool {
 	return false
 }
 
+// headerExtensionId returns the negotiated id of the header extension
+// with the given URI, or 0 if it has not been negotiated.
+func (up *rtpUpTrack) headerExtensionId(uri string) uint8 {
+	for _, e := range up.receiver.GetParameters().HeaderExtensions {
+		if e.URI == uri {
+			return uint8(e.ID)
+		}
+	}
+	return 0
+}
+
 type rtpUpConnection struct {
 	id            string
 	client        group.Client
@@ -509,12 +718,13 @@ type rtpUpConnection struct {
 	pc            *webrtc.PeerConnection
 	iceCandidates []*webrtc.ICECandidateInit
 
-	mu      sync.Mutex
-	closed  bool
-	pushed  bool
-	replace string
-	tracks  []*rtpUpTrack
-	local   []conn.Down
+	mu       sync.Mutex
+	closed   bool
+	pushed   bool
+	replace  string
+	tracks   []*rtpUpTrack
+	local    []conn.Down
+	channels []*upDataChannel
 }
 
 func (up *rtpUpConnection) getTracks() []*rtpUpTrack {
@@ -650,6 +860,10 @@ func newUpConn(c group.Client, id string, label string, offer string) (*rtpUpCon
 	}
 
 	for _, m := range o.MediaDescriptions {
+		if m.MediaName.Media == "application" {
+			// data channels are set up by OnDataChannel
+			continue
+		}
 		_, err = pc.AddTransceiverFromKind(
 			webrtc.NewRTPCodecType(m.MediaName.Media),
 			webrtc.RTPTransceiverInit{
@@ -663,6 +877,7 @@ func newUpConn(c group.Client, id string, label string, offer string) (*rtpUpCon
 	}
 
 	up := &rtpUpConnection{id: id, client: c, label: label, pc: pc}
+	encrypted := c.Group().Description().E2EE
 
 	pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 		up.mu.Lock()
@@ -673,7 +888,10 @@ func newUpConn(c group.Client, id string, label string, offer string) (*rtpUpCon
 			conn:       up,
 			cache:      packetcache.New(minPacketCache(remote)),
 			rate:       estimator.New(time.Second),
+			frames:     estimator.New(time.Second),
 			jitter:     jitter.New(remote.Codec().ClockRate),
+			layers:     &layerTable{},
+			encrypted:  encrypted,
 			actions:    unbounded.New[trackAction](),
 			readerDone: make(chan struct{}),
 		}
@@ -682,6 +900,13 @@ func newUpConn(c group.Client, id string, label string, offer string) (*rtpUpCon
 
 		go readLoop(track)
 
+		if isMixed(c.Group(), track) {
+			err := addMixerInput(track)
+			if err != nil {
+				log.Printf("Mixer: %v", err)
+			}
+		}
+
 		go rtcpUpListener(track)
 
 		up.mu.Unlock()
@@ -689,6 +914,10 @@ func newUpConn(c group.Client, id string, label string, offer string) (*rtpUpCon
 		pushConn(up, c.Group(), c.Group().GetClients(c))
 	})
 
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		up.gotDataChannel(dc)
+	})
+
 	pushConn(up, c.Group(), c.Group().GetClients(c))
 	go rtcpUpSender(up)
 
@@ -771,11 +1000,11 @@ func gotNACK(track *rtpDownTrack, p *rtcp.TransportLayerNack) {
 			if !ok {
 				return true
 			}
-			l := track.remote.GetPacket(seqno, buf, true)
+			l := track.getSource().GetPacket(seqno, buf, true)
 			if l == 0 {
 				return true
 			}
-			_, err := track.Write(buf[:l])
+			_, err := track.writePacket(buf[:l], true)
 			if err != nil {
 				log.Printf("Write: %v", err)
 				return false
@@ -1052,7 +1281,8 @@ func sendSR(conn *rtpDownConnection) error {
 				delay := rtptime.FromDuration(
 					d, clockrate,
 				)
-				nowRTP = remoteRTP + uint32(delay)
+				nowRTP = remoteRTP + uint32(delay) +
+					atomic.LoadUint32(&t.atomics.tsDelta)
 			}
 
 			p, b := t.rate.Totals()
@@ -1107,6 +1337,9 @@ func rtcpDownSender(conn *rtpDownConnection) {
 			}
 			log.Printf("sendSR: %v", err)
 		}
+		for _, t := range conn.getTracks() {
+			t.reselectTrack()
+		}
 	}
 }
 
@@ -1171,7 +1404,7 @@ func rtcpDownListener(track *rtpDownTrack) {
 		for _, p := range ps {
 			switch p := p.(type) {
 			case *rtcp.PictureLossIndication:
-				track.remote.RequestKeyframe()
+				track.getSource().RequestKeyframe()
 			case *rtcp.FullIntraRequest:
 				found := false
 				var seqno uint8
@@ -1188,7 +1421,7 @@ func rtcpDownListener(track *rtpDownTrack) {
 				}
 
 				if seqno != lastFirSeqno {
-					track.remote.RequestKeyframe()
+					track.getSource().RequestKeyframe()
 				}
 			case *rtcp.ReceiverEstimatedMaximumBitrate:
 				rate := uint64(p.Bitrate + 0.5)
@@ -1209,6 +1442,8 @@ func rtcpDownListener(track *rtpDownTrack) {
 				}
 			case *rtcp.TransportLayerNack:
 				gotNACK(track, p)
+			case *rtcp.TransportLayerCC:
+				gotTWCC(track.conn, p, jiffies)
 			}
 		}
 		if adjust {
@@ -1244,6 +1479,10 @@ func handleReport(track *rtpDownTrack, report rtcp.ReceptionReport, jiffies uint
 	}
 }
 
+// CacheBudget limits the total memory used by the packet caches of all
+// up tracks.
+var CacheBudget = packetcache.NewBudget(256 * 1024 * 1024)
+
 func minPacketCache(track *webrtc.TrackRemote) int {
 	if track.Kind() == webrtc.RTPCodecTypeVideo {
 		return 128
@@ -1279,5 +1518,14 @@ func updateUpTrack(track *rtpUpTrack) {
 	if packets > 1024 {
 		packets = 1024
 	}
+	granted := CacheBudget.Request(track.cache, min, packets)
+	if granted < packets {
+		// under memory pressure, shrink even if this invalidates
+		// the indices of recent packets
+		if track.cache.GetStats(false).Capacity > granted {
+			track.cache.Resize(granted)
+		}
+		return
+	}
 	track.cache.ResizeCond(packets)
 }
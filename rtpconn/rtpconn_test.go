@@ -1,8 +1,15 @@
 package rtpconn
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/conn"
+	"github.com/jech/galene/estimator"
 	"github.com/jech/galene/rtptime"
 )
 
@@ -54,3 +61,157 @@ func TestSadd(t *testing.T) {
 		}
 	}
 }
+
+type fakeUpTrack struct {
+	kind      webrtc.RTPCodecType
+	keyframes int
+}
+
+func (up *fakeUpTrack) AddLocal(conn.DownTrack) error {
+	return nil
+}
+
+func (up *fakeUpTrack) DelLocal(conn.DownTrack) bool {
+	return false
+}
+
+func (up *fakeUpTrack) Kind() webrtc.RTPCodecType {
+	return up.kind
+}
+
+func (up *fakeUpTrack) Label() string {
+	return ""
+}
+
+func (up *fakeUpTrack) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: "video/VP8"}
+}
+
+func (up *fakeUpTrack) GetPacket(uint16, []byte, bool) uint16 {
+	return 0
+}
+
+func (up *fakeUpTrack) RequestKeyframe() error {
+	up.keyframes++
+	return nil
+}
+
+func TestPauseTracks(t *testing.T) {
+	down := &rtpDownConnection{}
+	var remotes []*fakeUpTrack
+	for _, kind := range []webrtc.RTPCodecType{
+		webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo,
+	} {
+		local, err := newLocalTrack(
+			webrtc.RTPCodecCapability{MimeType: "video/VP8"},
+			kind.String(), "stream",
+		)
+		if err != nil {
+			t.Fatalf("newLocalTrack: %v", err)
+		}
+		remote := &fakeUpTrack{kind: kind}
+		remotes = append(remotes, remote)
+		down.tracks = append(down.tracks, &rtpDownTrack{
+			track:   local,
+			remote:  remote,
+			atomics: &downTrackAtomics{},
+		})
+	}
+	audio, video := down.tracks[0], down.tracks[1]
+
+	if down.pauseTracks([]string{"unknown"}, true) {
+		t.Errorf("Paused unknown track")
+	}
+
+	if !down.pauseTracks([]string{"video"}, true) {
+		t.Fatalf("Couldn't pause video")
+	}
+	if audio.isPaused() || !video.isPaused() {
+		t.Errorf("Expected only video to be paused")
+	}
+
+	// last-n and the client are independent reasons
+	video.setPaused(pauseLastN, true)
+	down.pauseTracks(nil, false)
+	if audio.isPaused() || !video.isPaused() {
+		t.Errorf("Expected video to remain paused")
+	}
+	if remotes[1].keyframes != 0 {
+		t.Errorf("Requested keyframe while paused")
+	}
+
+	video.setPaused(pauseLastN, false)
+	if atomic.LoadUint32(&video.atomics.paused) != pauseKeyframe {
+		t.Errorf("Expected to be waiting for a keyframe")
+	}
+	if remotes[1].keyframes != 1 || remotes[0].keyframes != 0 {
+		t.Errorf("Expected a single keyframe request, got %v %v",
+			remotes[0].keyframes, remotes[1].keyframes)
+	}
+}
+
+func TestPausedReordered(t *testing.T) {
+	local, err := newLocalTrack(
+		webrtc.RTPCodecCapability{MimeType: "video/VP8"},
+		"video", "stream",
+	)
+	if err != nil {
+		t.Fatalf("newLocalTrack: %v", err)
+	}
+	down := &rtpDownTrack{
+		track:          local,
+		remote:         &fakeUpTrack{kind: webrtc.RTPCodecTypeVideo},
+		maxBitrate:     new(bitrate),
+		maxREMBBitrate: new(bitrate),
+		rate:           estimator.New(time.Second),
+		atomics:        &downTrackAtomics{},
+	}
+
+	write := func(seqno uint16) {
+		packet := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: seqno,
+			},
+			// not a keyframe
+			Payload: []byte{0x10, 0x01, 0, 0},
+		}
+		buf, err := packet.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		_, err = down.writePacket(buf, false)
+		if err != nil {
+			t.Fatalf("writePacket: %v", err)
+		}
+	}
+	sent := func() uint64 {
+		packets, _ := down.rate.Totals()
+		return packets
+	}
+
+	write(1)
+	if sent() != 1 {
+		t.Fatalf("Expected 1 packet, got %v", sent())
+	}
+
+	down.setPaused(pauseClient, true)
+	write(2)
+	if sent() != 1 {
+		t.Errorf("Paused packet was sent")
+	}
+	// 3 is late, 4 cannot be dropped
+	write(4)
+	if sent() != 2 {
+		t.Errorf("Reordered packet was not sent")
+	}
+	write(3)
+	if sent() != 3 {
+		t.Errorf("Late packet was not sent")
+	}
+	write(5)
+	if sent() != 3 {
+		t.Errorf("Paused packet was sent")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 
 	"github.com/jech/galene/codecs"
@@ -17,6 +18,7 @@ func readLoop(track *rtpUpTrack) {
 	writers := rtpWriterPool{track: track}
 	defer func() {
 		writers.close()
+		CacheBudget.Release(track.cache)
 		close(track.readerDone)
 	}()
 
@@ -24,8 +26,14 @@ func readLoop(track *rtpUpTrack) {
 	codec := track.track.Codec()
 	sendNACK := track.hasRtcpFb("nack", "")
 	sendPLI := track.hasRtcpFb("nack", "pli")
+	audioLevelId := track.headerExtensionId(sdp.AudioLevelURI)
+	ddId := track.headerExtensionId(codecs.DependencyDescriptorURI)
+	var ddStructure *codecs.DependencyStructure
+	g := track.conn.client.Group()
 	var kfNeeded bool
 	var kfRequested time.Time
+	var lastTimestamp uint32
+	var framesKnown bool
 	buf := make([]byte, packetcache.BufSize)
 	var packet rtp.Packet
 	for {
@@ -55,7 +63,9 @@ func readLoop(track *rtpUpTrack) {
 		default:
 		}
 
-		bytes, _, err := track.track.Read(buf)
+		// the webrtc library unwraps RTX packets, and returns them
+		// as if they had been received on the media stream
+		bytes, attrs, err := track.track.Read(buf)
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("%v", err)
@@ -70,13 +80,56 @@ func readLoop(track *rtpUpTrack) {
 			continue
 		}
 
-		track.jitter.Accumulate(packet.Timestamp)
+		// retransmissions would skew the jitter estimate
+		if attrs == nil ||
+			attrs.Get(webrtc.AttributeRtxSequenceNumber) == nil {
+			track.jitter.Accumulate(packet.Timestamp)
+			if isvideo && (!framesKnown ||
+				int32(packet.Timestamp-lastTimestamp) > 0) {
+				track.frames.Accumulate(0)
+				lastTimestamp = packet.Timestamp
+				framesKnown = true
+			}
+		}
 
-		kf, kfKnown := codecs.Keyframe(codec.MimeType, &packet)
-		if kf || !kfKnown {
-			kfNeeded = false
+		// with end-to-end encryption, the payload is opaque, and
+		// we can only rely on the dependency descriptor
+		var kf, kfKnown bool
+		if !track.encrypted {
+			kf, kfKnown = codecs.Keyframe(codec.MimeType, &packet)
+			if kf {
+				// picked up by the down tracks on their
+				// next layer decision
+				track.setDimensions(codecs.KeyframeDimensions(
+					codec.MimeType, &packet,
+				))
+			}
 		}
 		if packet.Extension {
+			if audioLevelId > 0 && g != nil {
+				var level rtp.AudioLevelExtension
+				ext := packet.GetExtension(audioLevelId)
+				if ext != nil && level.Unmarshal(ext) == nil {
+					g.GotAudioLevel(
+						track.conn.client.Id(),
+						level.Level,
+					)
+				}
+			}
+			if ddId > 0 {
+				ext := packet.GetExtension(ddId)
+				if ext != nil {
+					var ok bool
+					ddStructure, kf, ok =
+						track.gotDependencyDescriptor(
+							packet.SequenceNumber,
+							kf, ext, ddStructure,
+						)
+					if ok && track.encrypted {
+						kfKnown = true
+					}
+				}
+			}
 			packet.Extension = false
 			packet.Extensions = nil
 			bytes, err = packet.MarshalTo(buf)
@@ -85,6 +138,9 @@ func readLoop(track *rtpUpTrack) {
 				continue
 			}
 		}
+		if kf || (!kfKnown && !track.encrypted) {
+			kfNeeded = false
+		}
 
 		first, index := track.cache.Store(
 			packet.SequenceNumber, packet.Timestamp,
@@ -145,6 +201,11 @@ func readLoop(track *rtpUpTrack) {
 				kfNeeded = false
 			}
 			kfRequested = now
+			if !kfKnown {
+				// we won't be able to tell when the
+				// keyframe arrives, only ask once
+				kfNeeded = false
+			}
 		}
 	}
 }
@@ -2,8 +2,11 @@ package rtpconn
 
 import (
 	"sort"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/webrtc/v4"
+
 	"github.com/jech/galene/rtptime"
 	"github.com/jech/galene/stats"
 )
@@ -32,10 +35,13 @@ func (c *webClient) GetStats() *stats.Client {
 				(time.Second / time.Duration(t.jitter.HZ()))
 			rate, _ := t.rate.Estimate()
 			conns.Tracks = append(conns.Tracks, stats.Track{
-				Bitrate:    uint64(rate) * 8,
-				MaxBitrate: maxUpBitrate(t),
-				Loss:       loss,
-				Jitter:     stats.Duration(jitter),
+				Bitrate:     uint64(rate) * 8,
+				MaxBitrate:  maxUpBitrate(t),
+				Loss:        loss,
+				Jitter:      stats.Duration(jitter),
+				CacheMemory: t.cache.Memory(),
+				CacheHits:   s.Hits,
+				CacheMisses: s.Misses,
 			})
 		}
 		cs.Up = append(cs.Up, conns)
@@ -62,16 +68,26 @@ func (c *webClient) GetStats() *stats.Client {
 			loss, jitter := t.stats.Get(jiffies)
 			j := time.Duration(jitter) * time.Second /
 				time.Duration(t.track.Codec().ClockRate)
+			var pacerDelay time.Duration
+			if t.remote.Kind() == webrtc.RTPCodecTypeVideo {
+				pacerDelay = down.pacer.getDelay()
+			}
+			queued := atomic.LoadInt32(&t.atomics.pacerQueued)
+			dropped := atomic.LoadUint64(&t.atomics.pacerDropped)
 			conns.Tracks = append(conns.Tracks, stats.Track{
-				Tid:        &tid,
-				MaxTid:     &maxTid,
-				Sid:        &sid,
-				MaxSid:     &maxSid,
-				Bitrate:    uint64(rate) * 8,
-				MaxBitrate: maxRate,
-				Loss:       float64(loss) / 256.0,
-				Rtt:        stats.Duration(rtt),
-				Jitter:     stats.Duration(j),
+				Tid:          &tid,
+				MaxTid:       &maxTid,
+				Sid:          &sid,
+				MaxSid:       &maxSid,
+				Bitrate:      uint64(rate) * 8,
+				MaxBitrate:   maxRate,
+				Loss:         float64(loss) / 256.0,
+				Rtt:          stats.Duration(rtt),
+				Jitter:       stats.Duration(j),
+				Paused:       t.isPaused(),
+				PacerQueue:   int(queued),
+				PacerDelay:   stats.Duration(pacerDelay),
+				PacerDropped: dropped,
 			})
 		}
 		cs.Down = append(cs.Down, conns)
@@ -0,0 +1,230 @@
+package rtpconn
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/estimator"
+	"github.com/jech/galene/rtptime"
+)
+
+// twccState is the state of transport-wide congestion control for a down
+// connection.
+type twccState struct {
+	adjusted uint64
+	seqno    uint32
+	delay    *estimator.Delay
+}
+
+func newTWCCState() *twccState {
+	return &twccState{
+		delay: estimator.NewDelay(),
+	}
+}
+
+// nextSeqno returns the next transport-wide sequence number.
+func (s *twccState) nextSeqno() uint16 {
+	return uint16(atomic.AddUint32(&s.seqno, 1) - 1)
+}
+
+// updateTWCCId records the id of the header extension negotiated for
+// transport-wide sequence numbers.  It must be called after negotiation
+// completes.
+func (down *rtpDownTrack) updateTWCCId() {
+	var id uint8
+	for _, e := range down.sender.GetParameters().HeaderExtensions {
+		if e.URI == sdp.TransportCCURI {
+			id = uint8(e.ID)
+			break
+		}
+	}
+	atomic.StoreUint32(&down.atomics.twccId, uint32(id))
+}
+
+func (down *rtpDownTrack) getTWCCId() uint8 {
+	return uint8(atomic.LoadUint32(&down.atomics.twccId))
+}
+
+var errTruncated = errors.New("truncated packet")
+
+// addTransportSeqno copies the packet src into dst, adding a
+// transport-wide sequence number with header extension id.  It returns
+// the length of the resulting packet.
+func addTransportSeqno(dst, src []byte, id uint8, seqno uint16) (int, error) {
+	if len(src) < 12 {
+		return 0, errTruncated
+	}
+
+	if (src[0]&0x10) != 0 || id < 1 || id > 14 {
+		// the general case, let the rtp library deal with it
+		var packet rtp.Packet
+		err := packet.Unmarshal(src)
+		if err != nil {
+			return 0, err
+		}
+		var ext [2]byte
+		binary.BigEndian.PutUint16(ext[:], seqno)
+		err = packet.SetExtension(id, ext[:])
+		if err != nil {
+			return 0, err
+		}
+		return packet.MarshalTo(dst)
+	}
+
+	// the fast case: no extensions yet, insert a one-byte header
+	// extension block right after the CSRCs.
+	hlen := 12 + 4*int(src[0]&0x0F)
+	if len(src) < hlen {
+		return 0, errTruncated
+	}
+	if len(dst) < len(src)+8 {
+		return 0, errors.New("buffer too small")
+	}
+	copy(dst, src[:hlen])
+	dst[0] |= 0x10
+	dst[hlen] = 0xBE
+	dst[hlen+1] = 0xDE
+	binary.BigEndian.PutUint16(dst[hlen+2:], 1)
+	dst[hlen+4] = (id << 4) | 1
+	binary.BigEndian.PutUint16(dst[hlen+5:], seqno)
+	dst[hlen+7] = 0
+	n := copy(dst[hlen+8:], src[hlen:])
+	return hlen + 8 + n, nil
+}
+
+// twccArrivals decodes a transport-wide congestion control feedback
+// packet.  Arrival times are in microseconds.
+func twccArrivals(p *rtcp.TransportLayerCC) []estimator.Arrival {
+	arrivals := make([]estimator.Arrival, 0, p.PacketStatusCount)
+	seqno := p.BaseSequenceNumber
+	tm := int64(p.ReferenceTime) * 64000
+	deltas := p.RecvDeltas
+
+	status := func(s uint16) bool {
+		if len(arrivals) >= int(p.PacketStatusCount) {
+			return false
+		}
+		a := estimator.Arrival{Seqno: seqno}
+		seqno++
+		if s == rtcp.TypeTCCPacketReceivedSmallDelta ||
+			s == rtcp.TypeTCCPacketReceivedLargeDelta {
+			if len(deltas) == 0 {
+				return false
+			}
+			tm += deltas[0].Delta
+			deltas = deltas[1:]
+			a.Received = true
+			a.Time = uint64(tm)
+		}
+		arrivals = append(arrivals, a)
+		return true
+	}
+
+	for _, chunk := range p.PacketChunks {
+		switch chunk := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			for i := 0; i < int(chunk.RunLength); i++ {
+				if !status(chunk.PacketStatusSymbol) {
+					return arrivals
+				}
+			}
+		case *rtcp.StatusVectorChunk:
+			for _, s := range chunk.SymbolList {
+				if !status(s) {
+					return arrivals
+				}
+			}
+		}
+	}
+	return arrivals
+}
+
+// gotTWCC processes transport-wide congestion control feedback for the
+// down connection conn.
+func gotTWCC(conn *rtpDownConnection, p *rtcp.TransportLayerCC, jiffies uint64) {
+	if conn.twcc == nil {
+		return
+	}
+	conn.twcc.delay.Feedback(twccArrivals(p), rtptime.Microseconds())
+
+	// feedback is frequent, don't adjust layers too often
+	adjusted := atomic.LoadUint64(&conn.twcc.adjusted)
+	if jiffies >= adjusted && jiffies-adjusted < rtptime.JiffiesPerSec/2 {
+		return
+	}
+	if !atomic.CompareAndSwapUint64(&conn.twcc.adjusted, adjusted, jiffies) {
+		return
+	}
+	for _, t := range conn.getTracks() {
+		if t.remote.Kind() == webrtc.RTPCodecTypeVideo {
+			t.adjustLayer()
+		}
+	}
+}
+
+// getDelayBitrate returns the share of the delay-based estimate that is
+// available to track t, or ^uint64(0) if there is no estimate.  Since
+// the down connections of a client share the client's bandwidth, their
+// estimates are added up, and the sum, after deducting the rate of audio
+// tracks, is shared between the unpaused video tracks of all the
+// connections in proportion to their requested priority.
+func (t *rtpDownTrack) getDelayBitrate() uint64 {
+	if t.conn == nil || t.conn.twcc == nil {
+		return ^uint64(0)
+	}
+	now := rtptime.Microseconds()
+	if t.conn.twcc.delay.Estimate(now) == ^uint64(0) {
+		return ^uint64(0)
+	}
+
+	conns := []*rtpDownConnection{t.conn}
+	if c, ok := t.conn.client.(*webClient); ok {
+		for _, down := range getDownConns(c) {
+			if down != t.conn {
+				conns = append(conns, down)
+			}
+		}
+	}
+
+	rate := uint64(0)
+	audio := uint64(0)
+	total := 0.0
+	for _, down := range conns {
+		if down.twcc == nil {
+			continue
+		}
+		r := down.twcc.delay.Estimate(now)
+		if r == ^uint64(0) {
+			continue
+		}
+		rate = sadd(rate, r)
+		for _, tt := range down.getTracks() {
+			if tt.remote.Kind() == webrtc.RTPCodecTypeVideo {
+				if tt == t || !tt.isPaused() {
+					total += tt.getConstraints().getPriority()
+				}
+			} else {
+				r, _ := tt.rate.Estimate()
+				audio += 8 * uint64(r)
+			}
+		}
+	}
+	if audio < rate {
+		rate -= audio
+	} else {
+		rate = 0
+	}
+	if p := t.getConstraints().getPriority(); total > p {
+		rate = uint64(float64(rate) * p / total)
+	}
+	if rate < minLossRate {
+		rate = minLossRate
+	}
+	return rate
+}
@@ -0,0 +1,165 @@
+package rtpconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"github.com/jech/galene/rtptime"
+)
+
+func TestAddTransportSeqno(t *testing.T) {
+	packets := []rtp.Packet{
+		{
+			Header: rtp.Header{
+				Version:        2,
+				SequenceNumber: 42,
+				Timestamp:      4242,
+				SSRC:           17,
+				CSRC:           []uint32{1, 2},
+			},
+			Payload: []byte{1, 2, 3, 4, 5},
+		},
+		{
+			Header: rtp.Header{
+				Version:        2,
+				SequenceNumber: 43,
+				SSRC:           17,
+			},
+			Payload: []byte{6, 7, 8},
+		},
+	}
+	err := packets[1].SetExtension(3, []byte{9, 9, 9})
+	if err != nil {
+		t.Fatalf("SetExtension: %v", err)
+	}
+
+	for _, p := range packets {
+		buf, err := p.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		buf2 := make([]byte, 1500)
+		n, err := addTransportSeqno(buf2, buf, 5, 0x1234)
+		if err != nil {
+			t.Fatalf("addTransportSeqno: %v", err)
+		}
+		var p2 rtp.Packet
+		err = p2.Unmarshal(buf2[:n])
+		if err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		ext := p2.GetExtension(5)
+		if len(ext) != 2 || binary.BigEndian.Uint16(ext) != 0x1234 {
+			t.Errorf("Expected 0x1234, got %v", ext)
+		}
+		if p2.SequenceNumber != p.SequenceNumber ||
+			p2.Timestamp != p.Timestamp || p2.SSRC != p.SSRC ||
+			len(p2.CSRC) != len(p.CSRC) ||
+			!bytes.Equal(p2.Payload, p.Payload) {
+			t.Errorf("Expected %v, got %v", p, p2)
+		}
+		if e := p.GetExtension(3); e != nil &&
+			!bytes.Equal(p2.GetExtension(3), e) {
+			t.Errorf("Lost extension %v", e)
+		}
+	}
+}
+
+func TestTWCCArrivals(t *testing.T) {
+	p := &rtcp.TransportLayerCC{
+		BaseSequenceNumber: 65534,
+		PacketStatusCount:  4,
+		ReferenceTime:      10,
+		PacketChunks: []rtcp.PacketStatusChunk{
+			&rtcp.RunLengthChunk{
+				PacketStatusSymbol: rtcp.TypeTCCPacketReceivedSmallDelta,
+				RunLength:          2,
+			},
+			&rtcp.StatusVectorChunk{
+				SymbolSize: rtcp.TypeTCCSymbolSizeTwoBit,
+				SymbolList: []uint16{
+					rtcp.TypeTCCPacketNotReceived,
+					rtcp.TypeTCCPacketReceivedLargeDelta,
+					rtcp.TypeTCCPacketNotReceived,
+				},
+			},
+		},
+		RecvDeltas: []*rtcp.RecvDelta{
+			{Type: rtcp.TypeTCCPacketReceivedSmallDelta, Delta: 1000},
+			{Type: rtcp.TypeTCCPacketReceivedSmallDelta, Delta: 2000},
+			{Type: rtcp.TypeTCCPacketReceivedLargeDelta, Delta: -500},
+		},
+	}
+
+	arrivals := twccArrivals(p)
+	if len(arrivals) != 4 {
+		t.Fatalf("Expected 4 arrivals, got %v", arrivals)
+	}
+	expected := []struct {
+		seqno    uint16
+		received bool
+		time     uint64
+	}{
+		{65534, true, 641000},
+		{65535, true, 643000},
+		{0, false, 0},
+		{1, true, 642500},
+	}
+	for i, e := range expected {
+		a := arrivals[i]
+		if a.Seqno != e.seqno || a.Received != e.received ||
+			a.Time != e.time {
+			t.Errorf("Expected %v, got %v", e, a)
+		}
+	}
+}
+
+func TestDelayBitratePriority(t *testing.T) {
+	c := &webClient{}
+	var tracks []*rtpDownTrack
+	for i, priority := range []float64{3, 1} {
+		down := &rtpDownConnection{
+			id:     fmt.Sprintf("d%v", i),
+			client: c,
+			twcc:   newTWCCState(),
+		}
+		down.twcc.delay.Feedback(nil, rtptime.Microseconds())
+		track := &rtpDownTrack{
+			conn:    down,
+			remote:  &fakeUpTrack{kind: webrtc.RTPCodecTypeVideo},
+			atomics: &downTrackAtomics{},
+		}
+		track.setConstraints(videoConstraints{priority: priority})
+		down.tracks = []*rtpDownTrack{track}
+		tracks = append(tracks, track)
+		c.mu.Lock()
+		if c.down == nil {
+			c.down = make(map[string]*rtpDownConnection)
+		}
+		c.down[down.id] = down
+		updateDownConns(c)
+		c.mu.Unlock()
+	}
+	rate := tracks[0].conn.twcc.delay.Estimate(rtptime.Microseconds())
+
+	// the estimates of both connections are shared in a 3:1 ratio
+	r0 := tracks[0].getDelayBitrate()
+	r1 := tracks[1].getDelayBitrate()
+	if r0 != rate*3/2 || r1 != rate/2 {
+		t.Errorf("Expected %v %v, got %v %v",
+			rate*3/2, rate/2, r0, r1,
+		)
+	}
+
+	// a paused track leaves its share to the others
+	tracks[1].setPaused(pauseClient, true)
+	if r := tracks[0].getDelayBitrate(); r != 2*rate {
+		t.Errorf("Expected %v, got %v", 2*rate, r)
+	}
+}
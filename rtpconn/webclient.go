@@ -12,17 +12,19 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 
 	"github.com/jech/galene/conn"
-	"github.com/jech/galene/diskwriter"
 	"github.com/jech/galene/estimator"
 	"github.com/jech/galene/group"
 	"github.com/jech/galene/ice"
 	"github.com/jech/galene/token"
+	"github.com/jech/galene/turnserver"
 	"github.com/jech/galene/unbounded"
 )
 
@@ -66,15 +68,20 @@ type webClient struct {
 	username    string
 	permissions []string
 	data        map[string]interface{}
-	requested   map[string][]string
+	requested   map[string]streamRequest
 	done        chan struct{}
 	writeCh     chan interface{}
 	writerDone  chan struct{}
 	actions     *unbounded.Channel[any]
+	dataLimiter rateLimiter
 
 	mu   sync.Mutex
 	down map[string]*rtpDownConnection
 	up   map[string]*rtpUpConnection
+
+	// a copy of the values of down, which can be read without
+	// holding mu
+	downConns atomic.Pointer[[]*rtpDownConnection]
 }
 
 func (c *webClient) Group() *group.Group {
@@ -106,9 +113,27 @@ func (c *webClient) Data() map[string]interface{} {
 }
 
 func (c *webClient) SetPermissions(perms []string) {
+	c.setPermissions(perms)
+}
+
+// setPermissions replaces the permissions of c.  It must only be called
+// from the client's goroutine, which may read c.permissions directly;
+// other goroutines must use permissionsSnapshot.  The slice is never
+// modified in place.
+func (c *webClient) setPermissions(perms []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.permissions = perms
 }
 
+// permissionsSnapshot returns a copy of the permissions of c.  It may be
+// called from any goroutine.
+func (c *webClient) permissionsSnapshot() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.permissions...)
+}
+
 func (c *webClient) PushClient(group, kind, id string, username string, perms []string, data map[string]interface{}) error {
 	c.action(pushClientAction{
 		group, kind, id, username, perms, data,
@@ -167,7 +192,17 @@ func getUpConns(c *webClient) []*rtpUpConnection {
 	return up
 }
 
-func addUpConn(c *webClient, id, label string, offer string) (*rtpUpConnection, bool, error) {
+// addUpConn creates an up connection, or returns the existing one if the
+// offer is a renegotiation.  It fails with a user error if the client is
+// not allowed to publish the offered media, or if it would exceed the
+// group's limit on streams per client once replace has been closed.
+func addUpConn(c *webClient, id, label string, offer string, replace string) (*rtpUpConnection, bool, error) {
+	var o sdp.SessionDescription
+	err := o.Unmarshal([]byte(offer))
+	if err != nil {
+		return nil, false, err
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -179,10 +214,26 @@ func addUpConn(c *webClient, id, label string, offer string) (*rtpUpConnection,
 	}
 
 	old := c.up[id]
+	if old != nil {
+		label = old.label
+	}
+	err = checkPresent(c.permissions, label, &o)
+	if err != nil {
+		return nil, false, err
+	}
 	if old != nil {
 		return old, false, nil
 	}
 
+	n := len(c.up)
+	if replace != "" && c.up[replace] != nil {
+		n--
+	}
+	err = checkStreamLimit(c.group, n)
+	if err != nil {
+		return nil, false, err
+	}
+
 	conn, err := newUpConn(c, id, label, offer)
 	if err != nil {
 		return nil, false, err
@@ -276,6 +327,27 @@ func getConn(c *webClient, id string) iceConnection {
 	return nil
 }
 
+// updateDownConns updates c.downConns after c.down has changed.  Called
+// locked.
+func updateDownConns(c *webClient) {
+	conns := make([]*rtpDownConnection, 0, len(c.down))
+	for _, down := range c.down {
+		conns = append(conns, down)
+	}
+	c.downConns.Store(&conns)
+}
+
+// getDownConns returns the down connections of c.  Unlike the other
+// accessors, it doesn't take c.mu, and may therefore be called by code
+// that runs with the lock of another client held.
+func getDownConns(c *webClient) []*rtpDownConnection {
+	conns := c.downConns.Load()
+	if conns == nil {
+		return nil
+	}
+	return *conns
+}
+
 func addDownConn(c *webClient, remote conn.Up) (*rtpDownConnection, bool, error) {
 	id := remote.Id()
 
@@ -316,6 +388,7 @@ func addDownConn(c *webClient, remote conn.Up) (*rtpDownConnection, bool, error)
 	}
 
 	c.down[down.id] = down
+	updateDownConns(c)
 
 	go rtcpDownSender(down)
 
@@ -347,53 +420,64 @@ func delDownConnHelper(c *webClient, id string) *rtpDownConnection {
 	for _, track := range conn.tracks {
 		// we only insert the track after we get an answer, so
 		// ignore errors here.
-		track.remote.DelLocal(track)
+		track.detach()
 	}
 	delete(c.down, id)
+	updateDownConns(c)
 	return conn
 }
 
 var errUnexpectedTrackType = errors.New("unexpected track type, this shouldn't happen")
 
-func addDownTrackUnlocked(conn *rtpDownConnection, remoteTrack *rtpUpTrack) error {
+// trackIds returns the track id and stream id used when forwarding t.
+func trackIds(t conn.UpTrack) (string, string, error) {
+	switch t := t.(type) {
+	case *rtpUpTrack:
+		id := t.track.ID()
+		if id == "" {
+			log.Println("Got track with empty id")
+			id = t.track.RID()
+		}
+		if id == "" {
+			id = t.track.Kind().String()
+		}
+		msid := t.track.StreamID()
+		if msid == "" || msid == "-" {
+			log.Println("Got track with empty msid")
+			msid = t.conn.Label()
+		}
+		if msid == "" {
+			msid = "dummy"
+		}
+		return id, msid, nil
+	case *mixerTrack:
+		return mixerConnId, mixerConnId, nil
+	default:
+		return "", "", errUnexpectedTrackType
+	}
+}
+
+func addDownTrackUnlocked(conn *rtpDownConnection, remoteTrack conn.UpTrack) error {
 	for _, t := range conn.tracks {
-		tt, ok := t.remote.(*rtpUpTrack)
-		if !ok {
-			return errUnexpectedTrackType
-		}
-		if tt == remoteTrack {
+		if t.getSource() == remoteTrack {
 			return os.ErrExist
 		}
 	}
 
-	id := remoteTrack.track.ID()
-	if id == "" {
-		log.Println("Got track with empty id")
-		id = remoteTrack.track.RID()
-	}
-	if id == "" {
-		id = remoteTrack.track.Kind().String()
-	}
-	msid := remoteTrack.track.StreamID()
-	if msid == "" || msid == "-" {
-		log.Println("Got track with empty msid")
-		msid = remoteTrack.conn.Label()
-	}
-	if msid == "" {
-		msid = "dummy"
+	id, msid, err := trackIds(remoteTrack)
+	if err != nil {
+		return err
 	}
 
 	// replace the RTCP feedback types with the ones we understand
 	remoteCodec := remoteTrack.Codec()
 	if strings.HasPrefix(strings.ToLower(remoteCodec.MimeType), "video/") {
-		remoteCodec.RTCPFeedback = group.VideoRTCPFeedback
+		remoteCodec.RTCPFeedback = group.VideoDownRTCPFeedback
 	} else {
 		remoteCodec.RTCPFeedback = group.AudioRTCPFeedback
 	}
 
-	local, err := webrtc.NewTrackLocalStaticRTP(
-		remoteCodec, id, msid,
-	)
+	local, err := newLocalTrack(remoteCodec, id, msid)
 	if err != nil {
 		return err
 	}
@@ -413,14 +497,18 @@ func addDownTrackUnlocked(conn *rtpDownConnection, remoteTrack *rtpUpTrack) erro
 		log.Printf("Couldn't determine ptype for codec %v: %v",
 			codec.MimeType, err)
 	} else {
-		err := transceiver.SetCodecPreferences(
-			[]webrtc.RTPCodecParameters{
-				{
-					RTPCodecCapability: codec,
-					PayloadType:        ptype,
-				},
+		prefs := []webrtc.RTPCodecParameters{
+			{
+				RTPCodecCapability: codec,
+				PayloadType:        ptype,
 			},
-		)
+		}
+		if local.Kind() == webrtc.RTPCodecTypeVideo {
+			prefs = append(prefs, group.RTXCodec(ptype))
+		} else if strings.EqualFold(codec.MimeType, "audio/opus") {
+			prefs = append(prefs, group.REDCodec(ptype))
+		}
+		err := transceiver.SetCodecPreferences(prefs)
 		if err != nil {
 			log.Printf("Couldn't set ptype for codec %v: %v",
 				codec.MimeType, err)
@@ -455,7 +543,7 @@ func addDownTrackUnlocked(conn *rtpDownConnection, remoteTrack *rtpUpTrack) erro
 func delDownTrackUnlocked(conn *rtpDownConnection, track *rtpDownTrack) error {
 	for i := range conn.tracks {
 		if conn.tracks[i] == track {
-			track.remote.DelLocal(track)
+			track.detach()
 			conn.tracks =
 				append(conn.tracks[:i], conn.tracks[i+1:]...)
 			return conn.pc.RemoveTrack(track.sender)
@@ -464,25 +552,17 @@ func delDownTrackUnlocked(conn *rtpDownConnection, track *rtpDownTrack) error {
 	return os.ErrNotExist
 }
 
-func replaceTracks(conn *rtpDownConnection, remote []conn.UpTrack, limitSid bool) (bool, error) {
-	conn.mu.Lock()
-	defer conn.mu.Unlock()
+func replaceTracks(down *rtpDownConnection, remote []conn.UpTrack, limitSid bool, constraints videoConstraints) (bool, error) {
+	down.mu.Lock()
+	defer down.mu.Unlock()
 
-	var add []*rtpUpTrack
+	var add []conn.UpTrack
 	var del []*rtpDownTrack
 
 outer:
-	for _, rtrack := range remote {
-		rt, ok := rtrack.(*rtpUpTrack)
-		if !ok {
-			return false, errUnexpectedTrackType
-		}
-		for _, track := range conn.tracks {
-			rt2, ok := track.remote.(*rtpUpTrack)
-			if !ok {
-				return false, errUnexpectedTrackType
-			}
-			if rt == rt2 {
+	for _, rt := range remote {
+		for _, track := range down.tracks {
+			if rt == track.getSource() {
 				continue outer
 			}
 		}
@@ -490,17 +570,9 @@ outer:
 	}
 
 outer2:
-	for _, track := range conn.tracks {
-		rt, ok := track.remote.(*rtpUpTrack)
-		if !ok {
-			return false, errUnexpectedTrackType
-		}
-		for _, rtrack := range remote {
-			rt2, ok := rtrack.(*rtpUpTrack)
-			if !ok {
-				return false, errUnexpectedTrackType
-			}
-			if rt == rt2 {
+	for _, track := range down.tracks {
+		for _, rt := range remote {
+			if rt == track.getSource() {
 				continue outer2
 			}
 		}
@@ -508,11 +580,16 @@ outer2:
 	}
 
 	defer func() {
-		for _, t := range conn.tracks {
+		for _, t := range down.tracks {
+			t.setConstraints(constraints)
 			layer := t.getLayerInfo()
 			layer.limitSid = limitSid
-			if limitSid {
-				layer.wantedSid = 0
+			maxSid, maxTid := t.layerLimits(layer)
+			if layer.wantedSid > maxSid {
+				layer.wantedSid = maxSid
+			}
+			if layer.wantedTid > maxTid {
+				layer.wantedTid = maxTid
 			}
 			t.setLayerInfo(layer)
 		}
@@ -523,14 +600,14 @@ outer2:
 	}
 
 	for _, t := range del {
-		err := delDownTrackUnlocked(conn, t)
+		err := delDownTrackUnlocked(down, t)
 		if err != nil {
 			return false, err
 		}
 	}
 
 	for _, rt := range add {
-		err := addDownTrackUnlocked(conn, rt)
+		err := addDownTrackUnlocked(down, rt)
 		if err != nil {
 			return false, err
 		}
@@ -589,7 +666,7 @@ func sendICE(c *webClient, id string, candidate *webrtc.ICECandidate) error {
 }
 
 func gotOffer(c *webClient, id, label string, sdp string, replace string) error {
-	up, _, err := addUpConn(c, id, label, sdp)
+	up, _, err := addUpConn(c, id, label, sdp, replace)
 	if err != nil {
 		return err
 	}
@@ -650,10 +727,14 @@ func gotAnswer(c *webClient, id string, sdp string) error {
 		log.Printf("ICE: %v", err)
 	}
 
+	for _, t := range down.getTracks() {
+		t.updateTWCCId()
+	}
+
 	add := func() {
 		down.pc.OnConnectionStateChange(nil)
 		for _, t := range down.tracks {
-			err := t.remote.AddLocal(t)
+			err := t.getSource().AddLocal(t)
 			if err != nil && err != os.ErrClosed {
 				log.Printf("Add track: %v", err)
 			}
@@ -703,7 +784,7 @@ func toStringArray(r interface{}) ([]string, error) {
 	return rrr, nil
 }
 
-func parseRequested(r interface{}) (map[string][]string, error) {
+func parseRequested(r interface{}) (map[string]streamRequest, error) {
 	if r == nil {
 		return nil, nil
 	}
@@ -714,9 +795,9 @@ func parseRequested(r interface{}) (map[string][]string, error) {
 	if rr == nil {
 		return nil, nil
 	}
-	rrr := make(map[string][]string)
+	rrr := make(map[string]streamRequest)
 	for k, v := range rr {
-		vv, err := toStringArray(v)
+		vv, err := parseStreamRequest(v)
 		if err != nil {
 			return nil, err
 		}
@@ -725,23 +806,24 @@ func parseRequested(r interface{}) (map[string][]string, error) {
 	return rrr, nil
 }
 
-func (c *webClient) setRequested(requested map[string][]string) error {
+func (c *webClient) setRequested(requested map[string]streamRequest) error {
 	if c.group == nil {
 		return errors.New("attempted to request with no group joined")
 	}
 	c.requested = requested
 
 	requestConns(c, c.group, "")
-	return nil
+	return addMixerOutput(c)
 }
 
-func (c *webClient) setRequestedStream(down *rtpDownConnection, requested []string) error {
+func (c *webClient) setRequestedStream(down *rtpDownConnection, requested streamRequest) error {
 	var remoteClient group.Client
 	remote, ok := down.remote.(*rtpUpConnection)
-	if ok {
-		remoteClient = remote.client
+	if !ok {
+		return errors.New("cannot request this stream")
 	}
-	down.requested = requested
+	remoteClient = remote.client
+	down.requested = &requested
 	return remoteClient.RequestConns(c, c.group, remote.id)
 }
 
@@ -757,12 +839,23 @@ func requestConns(target group.Client, g *group.Group, id string) {
 	}
 }
 
-func requestedTracks(c *webClient, requested []string, tracks []conn.UpTrack) ([]conn.UpTrack, bool) {
-	if len(requested) == 0 {
+func requestedTracks(c *webClient, requested streamRequest, tracks []conn.UpTrack) ([]conn.UpTrack, bool) {
+	if len(requested.tracks) == 0 {
 		return nil, false
 	}
+	if audioMixing(c.group) > 0 {
+		// the audio is sent by the mixer
+		var ts []conn.UpTrack
+		for _, t := range tracks {
+			if !isMixed(c.group, t) {
+				ts = append(ts, t)
+			}
+		}
+		tracks = ts
+	}
+
 	var audio, video, videoLow bool
-	for _, s := range requested {
+	for _, s := range requested.tracks {
 		switch s {
 		case "audio":
 			audio = true
@@ -770,6 +863,8 @@ func requestedTracks(c *webClient, requested []string, tracks []conn.UpTrack) ([
 			video = true
 		case "video-low":
 			videoLow = true
+		case "pin":
+			// handled by pushDownConn
 		default:
 			log.Printf("client requested unknown value %v", s)
 		}
@@ -800,7 +895,10 @@ func requestedTracks(c *webClient, requested []string, tracks []conn.UpTrack) ([
 		}
 	}
 	if video {
-		t, _ := find(webrtc.RTPCodecTypeVideo, false)
+		t := selectVideoTrack(tracks, requested.constraints)
+		if t == nil {
+			t, _ = find(webrtc.RTPCodecTypeVideo, false)
+		}
 		if t != nil {
 			ts = append(ts, t)
 		}
@@ -922,10 +1020,19 @@ type pushClientAction struct {
 	data        map[string]interface{}
 }
 
+type activeSpeakerAction struct {
+	group string
+	id    string
+}
+
 type changePermissionsAction struct {
 	kind string
 }
 
+type setPermissionsAction struct {
+	permissions []string
+}
+
 type permissionsChangedAction struct{}
 
 type joinedAction struct {
@@ -975,6 +1082,7 @@ func clientLoop(c *webClient, ws *websocket.Conn, versionError bool) error {
 	defer leaveGroup(c)
 
 	readTime := time.Now()
+	credentialsTime := time.Now()
 
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -1037,6 +1145,19 @@ func clientLoop(c *webClient, ws *websocket.Conn, versionError bool) error {
 					return err
 				}
 			}
+			// refresh the TURN credentials before they expire
+			lifetime := turnserver.CredentialLifetime
+			if time.Since(credentialsTime) > lifetime/2 {
+				credentialsTime = time.Now()
+				if c.Group() != nil {
+					err := handleAction(
+						c, permissionsChangedAction{},
+					)
+					if err != nil {
+						return err
+					}
+				}
+			}
 		}
 	}
 }
@@ -1044,6 +1165,9 @@ func clientLoop(c *webClient, ws *websocket.Conn, versionError bool) error {
 func pushDownConn(c *webClient, id string, up conn.Up, tracks []conn.UpTrack, replace string) error {
 	var requested []conn.UpTrack
 	limitSid := false
+	var constraints videoConstraints
+	pinned := false
+	data := false
 	if up != nil {
 		var old *rtpDownConnection
 		if replace != "" {
@@ -1051,11 +1175,10 @@ func pushDownConn(c *webClient, id string, up conn.Up, tracks []conn.UpTrack, re
 		} else {
 			old = getDownConn(c, up.Id())
 		}
-		var req []string
-		if old != nil {
-			req = old.requested
-		}
-		if req == nil {
+		var req streamRequest
+		if old != nil && old.requested != nil {
+			req = *old.requested
+		} else {
 			var ok bool
 			req, ok = c.requested[up.Label()]
 			if !ok {
@@ -1063,6 +1186,11 @@ func pushDownConn(c *webClient, id string, up conn.Up, tracks []conn.UpTrack, re
 			}
 		}
 		requested, limitSid = requestedTracks(c, req, tracks)
+		constraints = req.constraints
+		pinned = member("pin", req.tracks)
+		if rup, ok := up.(*rtpUpConnection); ok {
+			data = len(req.tracks) > 0 && rup.hasDataChannels(c)
+		}
 	}
 
 	if replace != "" {
@@ -1079,7 +1207,7 @@ func pushDownConn(c *webClient, id string, up conn.Up, tracks []conn.UpTrack, re
 		}
 	}()
 
-	if len(requested) == 0 {
+	if len(requested) == 0 && !data {
 		closeDownConn(c, id, "")
 		return nil
 	}
@@ -1091,10 +1219,18 @@ func pushDownConn(c *webClient, id string, up conn.Up, tracks []conn.UpTrack, re
 		}
 		return err
 	}
-	done, err := replaceTracks(down, requested, limitSid)
-	if err != nil || !done {
+	down.pinned = pinned
+	done, err := replaceTracks(down, requested, limitSid, constraints)
+	if err != nil {
+		return err
+	}
+	dataDone, err := replaceDataChannels(down)
+	if err != nil {
 		return err
 	}
+	if !done && !dataDone {
+		return nil
+	}
 	err = negotiate(c, down, false, replace)
 	if err != nil {
 		log.Printf("Negotiation failed: %v", err)
@@ -1112,7 +1248,9 @@ func handleAction(c *webClient, a any) error {
 			log.Printf("Got connectsions for wrong group")
 			return nil
 		}
-		return pushDownConn(c, a.id, a.conn, a.tracks, a.replace)
+		err := pushDownConn(c, a.id, a.conn, a.tracks, a.replace)
+		updateLastN(c)
+		return err
 	case requestConnsAction:
 		g := c.group
 		if g == nil || a.group != g {
@@ -1145,7 +1283,7 @@ func handleAction(c *webClient, a any) error {
 				[]conn.UpTrack, len(down.tracks),
 			)
 			for i, t := range down.tracks {
-				tracks[i] = t.remote
+				tracks[i] = t.getSource()
 			}
 			c.PushConn(
 				c.group,
@@ -1199,11 +1337,15 @@ func handleAction(c *webClient, a any) error {
 			Permissions:      perms,
 			Status:           status,
 			Data:             data,
-			RTCConfiguration: ice.ICEConfiguration(),
+			RTCConfiguration: ice.ClientConfiguration(c.id),
 		})
 		if err != nil {
 			return err
 		}
+		if a.kind == "change" {
+			// the group's last-n setting might have changed
+			updateLastN(c)
+		}
 		if a.kind == "join" {
 			if g == nil {
 				log.Println("g is null when joining" +
@@ -1225,29 +1367,56 @@ func handleAction(c *webClient, a any) error {
 					return err
 				}
 			}
+			if id := g.ActiveSpeaker(); id != "" {
+				err := c.write(clientMessage{
+					Type: "speaker",
+					Id:   id,
+				})
+				if err != nil {
+					return err
+				}
+			}
 		}
+	case activeSpeakerAction:
+		if c.group == nil || a.group != c.group.Name() {
+			return nil
+		}
+		updateLastN(c)
+		return c.write(clientMessage{
+			Type: "speaker",
+			Id:   a.id,
+		})
 	case changePermissionsAction:
+		// copy the slice, since remove modifies it in place
+		perms := append([]string(nil), c.permissions...)
 		switch a.kind {
 		case "op":
-			c.permissions = addnew("op", c.permissions)
+			perms = addnew("op", perms)
 			g := c.Group()
-			if g != nil && g.Description().AllowRecording {
-				c.permissions = addnew("record", c.permissions)
+			if g != nil && g.Description().AllowRecording &&
+				!g.Description().E2EE {
+				perms = addnew("record", perms)
 			}
 		case "unop":
-			c.permissions = remove("op", c.permissions)
-			c.permissions = remove("record", c.permissions)
+			perms = remove("op", perms)
+			perms = remove("record", perms)
 		case "present":
-			c.permissions = addnew("present", c.permissions)
+			perms = addnew("present", perms)
 		case "unpresent":
-			c.permissions = remove("present", c.permissions)
+			for _, p := range presentPermissions {
+				perms = remove(p, perms)
+			}
 		case "shutup":
-			c.permissions = remove("message", c.permissions)
+			perms = remove("message", perms)
 		case "unshutup":
-			c.permissions = addnew("message", c.permissions)
+			perms = addnew("message", perms)
 		default:
 			return group.UserError("unknown permission")
 		}
+		c.setPermissions(perms)
+		c.action(permissionsChangedAction{})
+	case setPermissionsAction:
+		c.setPermissions(a.permissions)
 		c.action(permissionsChangedAction{})
 	case permissionsChangedAction:
 		g := c.Group()
@@ -1264,20 +1433,15 @@ func handleAction(c *webClient, a any) error {
 			Username:         &username,
 			Permissions:      perms,
 			Status:           &status,
-			RTCConfiguration: ice.ICEConfiguration(),
+			RTCConfiguration: ice.ClientConfiguration(c.id),
 		})
-		if !member("present", c.permissions) {
-			up := getUpConns(c)
-			for _, u := range up {
-				err := delUpConn(
-					c, u.id, c.id, true,
-				)
-				if err == nil {
-					failUpConnection(
-						c, u.id,
-						"permission denied",
-					)
-				}
+		for _, u := range getUpConns(c) {
+			if checkUpConn(c.permissions, u) == nil {
+				continue
+			}
+			err := delUpConn(c, u.id, c.id, true)
+			if err == nil {
+				failUpConnection(c, u.id, "permission denied")
 			}
 		}
 		id := c.Id()
@@ -1337,10 +1501,11 @@ func leaveGroup(c *webClient) {
 		}
 	}
 
+	delMixerOutput(c)
 	group.DelClient(c)
-	c.permissions = nil
+	c.setPermissions(nil)
 	c.data = nil
-	c.requested = make(map[string][]string)
+	c.requested = make(map[string]streamRequest)
 	c.group = nil
 }
 
@@ -1365,6 +1530,11 @@ func closeDownConn(c *webClient, id string, message string) error {
 	return nil
 }
 
+func (c *webClient) ActiveSpeaker(group, id string) error {
+	c.action(activeSpeakerAction{group, id})
+	return nil
+}
+
 func (c *webClient) Kick(id string, user *string, message string) error {
 	c.action(kickAction{id, user, message})
 	return nil
@@ -1481,7 +1651,7 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 		if down == nil {
 			return ErrUnknownId
 		}
-		requested, err := toStringArray(m.Request)
+		requested, err := parseStreamRequest(m.Request)
 		if err != nil {
 			return err
 		}
@@ -1490,7 +1660,7 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 		if m.Id == "" {
 			return errEmptyId
 		}
-		if !member("present", c.permissions) {
+		if !CanPresent(c.permissions) {
 			if m.Replace != "" {
 				delUpConn(c, m.Replace, c.id, true)
 			}
@@ -1545,6 +1715,21 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 		} else {
 			log.Printf("Trying to renegotiate unknown connection")
 		}
+	case "pause", "resume":
+		if m.Id == "" {
+			return errEmptyId
+		}
+		ids, err := toStringArray(m.Value)
+		if err != nil {
+			return group.ProtocolError("bad track list")
+		}
+		down := getDownConn(c, m.Id)
+		if down == nil {
+			return ErrUnknownId
+		}
+		if !down.pauseTracks(ids, m.Type == "pause") {
+			log.Printf("Trying to %v unknown track", m.Type)
+		}
 	case "close":
 		if m.Id == "" {
 			return errEmptyId
@@ -1635,6 +1820,45 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 			}
 			ccc.write(mm)
 		}
+	case "e2ee":
+		g := c.group
+		if g == nil {
+			return c.error(group.UserError("join a group first"))
+		}
+		if !g.Description().E2EE {
+			return c.error(group.UserError(
+				"group is not end-to-end encrypted",
+			))
+		}
+		// key exchange messages are opaque to the server, which
+		// only sets the source and username
+		username := c.Username()
+		mm := clientMessage{
+			Type:     m.Type,
+			Kind:     m.Kind,
+			Source:   c.Id(),
+			Dest:     m.Dest,
+			Username: &username,
+			Value:    m.Value,
+		}
+		if m.Dest == "" {
+			err := broadcast(g.GetClients(c), mm)
+			if err != nil {
+				log.Printf("broadcast(e2ee): %v", err)
+			}
+		} else {
+			cc := g.GetClient(m.Dest)
+			if cc == nil {
+				return c.error(group.UserError("user unknown"))
+			}
+			ccc, ok := cc.(*webClient)
+			if !ok {
+				return c.error(group.UserError(
+					"this user doesn't do key exchange",
+				))
+			}
+			ccc.write(mm)
+		}
 	case "groupaction":
 		g := c.group
 		if g == nil {
@@ -1686,34 +1910,15 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 			if !member("record", c.permissions) {
 				return c.error(group.UserError("not authorised"))
 			}
-			for _, cc := range g.GetClients(c) {
-				_, ok := cc.(*diskwriter.Client)
-				if ok {
-					return c.error(group.UserError("already recording"))
-				}
-			}
-			disk := diskwriter.New(g)
-			_, err := group.AddClient(g.Name(), disk,
-				group.ClientCredentials{
-					System: true,
-				},
-			)
+			err := StartRecording(g)
 			if err != nil {
-				disk.Close()
 				return c.error(err)
 			}
-			requestConns(disk, c.group, "")
 		case "unrecord":
 			if !member("record", c.permissions) {
 				return c.error(group.UserError("not authorised"))
 			}
-			for _, cc := range g.GetClients(c) {
-				disk, ok := cc.(*diskwriter.Client)
-				if ok {
-					disk.Close()
-					group.DelClient(disk)
-				}
-			}
+			StopRecording(g)
 		case "subgroups":
 			if !member("op", c.permissions) {
 				return c.error(group.UserError("not authorised"))
@@ -1790,7 +1995,8 @@ func handleClientMessage(c *webClient, m clientMessage) error {
 				return terror("error", "that username is taken")
 			}
 
-			for _, p := range tok.Permissions {
+			desc := c.group.Description()
+			for _, p := range desc.ExpandRoles(tok.Permissions) {
 				if !member(p, c.permissions) {
 					return terror(
 						"not-authorised",
@@ -2,10 +2,14 @@ package rtpconn
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/jech/galene/group"
 	"github.com/jech/galene/token"
+	"github.com/jech/galene/unbounded"
 )
 
 var tokens = []string{
@@ -50,3 +54,77 @@ func TestParseStatefulToken(t *testing.T) {
 		}
 	}
 }
+
+func TestE2EEAttribution(t *testing.T) {
+	group.Directory = t.TempDir()
+	err := os.WriteFile(
+		filepath.Join(group.Directory, "e2ee-test.json"),
+		[]byte(`{
+		    "e2ee": true,
+		    "wildcard-user": {
+		        "password": {"type": "wildcard"},
+		        "permissions": "present"
+		    }
+		}`), 0600,
+	)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	defer group.Delete("e2ee-test")
+
+	newClient := func(id, username string) *webClient {
+		c := &webClient{
+			id:         id,
+			username:   username,
+			writeCh:    make(chan interface{}, 8),
+			writerDone: make(chan struct{}),
+			actions:    unbounded.New[any](),
+		}
+		var err error
+		c.group, err = group.AddClient("e2ee-test", c,
+			group.ClientCredentials{Username: &username},
+		)
+		if err != nil {
+			t.Fatalf("AddClient: %v", err)
+		}
+		return c
+	}
+	a := newClient("a", "alice")
+	defer group.DelClient(a)
+	b := newClient("b", "bob")
+	defer group.DelClient(b)
+
+	err = handleClientMessage(a, clientMessage{
+		Type:  "e2ee",
+		Kind:  "key",
+		Dest:  "b",
+		Value: "k",
+	})
+	if err != nil {
+		t.Fatalf("handleClientMessage: %v", err)
+	}
+	m, ok := (<-b.writeCh).(clientMessage)
+	if !ok || m.Source != "a" || m.Username == nil || *m.Username != "alice" ||
+		m.Value != "k" {
+		t.Errorf("Unicast: got %v", m)
+	}
+
+	err = handleClientMessage(a, clientMessage{
+		Type:   "e2ee",
+		Kind:   "key",
+		Source: "",
+		Value:  "k",
+	})
+	if err != nil {
+		t.Fatalf("handleClientMessage: %v", err)
+	}
+	buf, ok := (<-b.writeCh).([]byte)
+	if !ok {
+		t.Fatalf("Broadcast: expected bytes")
+	}
+	m = clientMessage{}
+	err = json.Unmarshal(buf, &m)
+	if err != nil || m.Source != "a" || m.Username == nil || *m.Username != "alice" {
+		t.Errorf("Broadcast: got %v %v", m, err)
+	}
+}
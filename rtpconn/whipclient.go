@@ -141,7 +141,33 @@ func (c *WhipClient) Close() error {
 	return nil
 }
 
+// checkOffer returns a user error if c is not allowed to publish offer.
+// WHIP streams are subject to the same permissions as camera streams.
+// Called with c.mu held.
+func (c *WhipClient) checkOffer(offer []byte) error {
+	var o sdp.SessionDescription
+	err := o.Unmarshal(offer)
+	if err != nil {
+		return err
+	}
+	return checkPresent(c.permissions, "camera", &o)
+}
+
 func (c *WhipClient) NewConnection(ctx context.Context, offer []byte) ([]byte, error) {
+	c.mu.Lock()
+	err := c.checkOffer(offer)
+	if err == nil {
+		n := 0
+		if c.connection != nil {
+			n = 1
+		}
+		err = checkStreamLimit(c.group, n)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := newUpConn(c, c.id, "", string(offer))
 	if err != nil {
 		return nil, err
@@ -178,6 +204,10 @@ func (c *WhipClient) NewConnection(ctx context.Context, offer []byte) ([]byte, e
 func (c *WhipClient) GotOffer(ctx context.Context, offer []byte) ([]byte, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	err := c.checkOffer(offer)
+	if err != nil {
+		return nil, err
+	}
 	return c.gotOffer(ctx, offer)
 }
 
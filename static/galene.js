@@ -589,21 +589,41 @@ function getVisibility(id) {
     return !elt.classList.contains('invisible');
 }
 
+/**
+ * The permissions that allow publishing some streams.
+ *
+ * @type {Array<string>}
+ */
+const presentPermissions = [
+    'present', 'present-audio', 'present-camera', 'present-screenshare',
+];
+
+/**
+ * Returns true if we are allowed to publish the given kind of media.
+ *
+ * @param {string} kind - one of 'audio', 'camera' or 'screenshare'.
+ * @returns {boolean}
+ */
+function canPresentMedia(kind) {
+    let permissions = serverConnection.permissions;
+    return permissions.indexOf('present') >= 0 ||
+        permissions.indexOf('present-' + kind) >= 0;
+}
+
 /**
  * Shows and hides various UI elements depending on the protocol state.
  */
 function setButtonsVisibility() {
     let connected = serverConnection && serverConnection.socket;
-    let permissions = serverConnection.permissions;
     let canWebrtc = !(typeof RTCPeerConnection === 'undefined');
     let canPresent = canWebrtc &&
         ('mediaDevices' in navigator) &&
         ('getUserMedia' in navigator.mediaDevices) &&
-        permissions.indexOf('present') >= 0;
+        (canPresentMedia('audio') || canPresentMedia('camera'));
     let canShare = canWebrtc &&
         ('mediaDevices' in navigator) &&
         ('getDisplayMedia' in navigator.mediaDevices) &&
-        permissions.indexOf('present') >= 0;
+        canPresentMedia('screenshare');
     let local = !!findUpMedia('camera');
     let mediacount = document.getElementById('peers').childElementCount;
     let mobilelayout = isMobileLayout();
@@ -1724,9 +1744,11 @@ async function addLocalMedia(localId) {
     let settings = getSettings();
 
     /** @type{boolean|MediaTrackConstraints} */
-    let audio = settings.audio ? {deviceId: settings.audio} : false;
+    let audio = settings.audio && canPresentMedia('audio') ?
+        {deviceId: settings.audio} : false;
     /** @type{boolean|MediaTrackConstraints} */
-    let video = settings.video ? {deviceId: settings.video} : false;
+    let video = settings.video && canPresentMedia('camera') ?
+        {deviceId: settings.video} : false;
 
     if(video) {
         let resolution = settings.resolution;
@@ -1823,7 +1845,7 @@ async function addShareMedia() {
             throw new Error('Your browser does not support screen sharing');
         stream = await navigator.mediaDevices.getDisplayMedia({
             video: true,
-            audio: true,
+            audio: canPresentMedia('audio'),
         });
     } catch(e) {
         console.error(e);
@@ -2568,7 +2590,7 @@ function userMenu(elt) {
                 inviteMenu();
             }});
         }
-        if(serverConnection.permissions.indexOf('present') >= 0 && canFile())
+        if(canPresentMedia('camera') && canFile())
             items.push({label: 'Broadcast file', onClick: presentFile});
         items.push({label: 'Restart media', onClick: renegotiateStreams});
     } else {
@@ -2577,7 +2599,7 @@ function userMenu(elt) {
         }});
         if(serverConnection.permissions.indexOf('op') >= 0) {
             items.push({type: 'seperator'}); // sic
-            if(user.permissions.indexOf('present') >= 0)
+            if(presentPermissions.some(p => user.permissions.indexOf(p) >= 0))
                 items.push({label: 'Forbid presenting', onClick: () => {
                     serverConnection.userAction('unpresent', id);
                 }});
@@ -2730,7 +2752,8 @@ function gotUser(id, kind) {
 function displayUsername() {
     document.getElementById('userspan').textContent = serverConnection.username;
     let op = serverConnection.permissions.indexOf('op') >= 0;
-    let present = serverConnection.permissions.indexOf('present') >= 0;
+    let present = canPresentMedia('audio') || canPresentMedia('camera') ||
+        canPresentMedia('screenshare');
     let text = '';
     if(op && present)
         text = '(op, presenter)';
@@ -2877,7 +2900,7 @@ async function gotJoined(kind, group, perms, status, data, error, message) {
 
     if(('mediaDevices' in navigator) &&
        ('getUserMedia' in navigator.mediaDevices) &&
-       serverConnection.permissions.indexOf('present') >= 0 &&
+       (canPresentMedia('audio') || canPresentMedia('camera')) &&
        !findUpMedia('camera')) {
         if(present) {
             if(present === 'mike')
@@ -3722,9 +3745,9 @@ function makeToken(template) {
     if('permissions' in template)
         v.permissions = template.permissions;
     else {
-        v.permissions = [];
-        if(serverConnection.permissions.indexOf('present') >= 0)
-            v.permissions.push('present');
+        v.permissions = presentPermissions.filter(
+            p => serverConnection.permissions.indexOf(p) >= 0
+        );
         if(serverConnection.permissions.indexOf('message') >= 0)
             v.permissions.push('message');
     }
@@ -4067,7 +4090,7 @@ commands.presentfile = {
         if(!canFile())
             return 'Your browser does not support presenting arbitrary files';
         if(!serverConnection || !serverConnection.permissions ||
-           serverConnection.permissions.indexOf('present') < 0)
+           !canPresentMedia('camera'))
             return 'You are not authorised to present.';
         return null;
     }
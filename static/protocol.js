@@ -100,6 +100,13 @@ function ServerConnection() {
      * @type {Object<string,user>}
      */
     this.users = {};
+    /**
+     * The id of the user that the server considers to be the dominant
+     * speaker, or null.
+     *
+     * @type {string}
+     */
+    this.speaker = null;
     /**
      * The underlying websocket.
      *
@@ -227,6 +234,13 @@ function ServerConnection() {
      * @type {(this: ServerConnection, id: string, dest: string, username: string, time: Date, privileged: boolean, kind: string, error: string, message: unknown) => void}
      */
     this.onusermessage = null;
+    /**
+     * onspeaker is called whenever the server's idea of the dominant
+     * speaker changes.  Id is null if there is no dominant speaker.
+     *
+     * @type {(this: ServerConnection, id: string) => void}
+     */
+    this.onspeaker = null;
     /**
      * The set of files currently being transferred.
      *
@@ -365,6 +379,7 @@ ServerConnection.prototype.connect = function(url) {
             if(sc.onuser)
                 sc.onuser.call(sc, id, 'delete');
         }
+        sc.speaker = null;
         if(sc.group && sc.onjoined)
             sc.onjoined.call(sc, 'leave', sc.group, [], {}, {}, '', '');
         sc.group = null;
@@ -431,6 +446,7 @@ ServerConnection.prototype.connect = function(url) {
                 sc.username = null;
                 sc.permissions = [];
                 sc.rtcConfiguration = null;
+                sc.speaker = null;
             } else if(m.kind === 'join' || m.kind == 'change') {
                 if(m.kind === 'join' && sc.group) {
                     throw new Error('Joined multiple groups');
@@ -493,6 +509,11 @@ ServerConnection.prototype.connect = function(url) {
             if(sc.onuser)
                 sc.onuser.call(sc, m.id, m.kind);
             break;
+        case 'speaker':
+            sc.speaker = m.id || null;
+            if(sc.onspeaker)
+                sc.onspeaker.call(sc, sc.speaker);
+            break;
         case 'chat':
         case 'chathistory':
             if(sc.onchat)
@@ -910,6 +931,11 @@ ServerConnection.prototype.gotOffer = async function(id, label, source, username
             if(changed && sc.onuser)
                 sc.onuser.call(sc, source, "change");
         };
+
+        c.pc.ondatachannel = function(e) {
+            if(c.ondatachannel)
+                c.ondatachannel.call(c, e.channel);
+        };
     }
 
     c.source = source;
@@ -1198,6 +1224,14 @@ function Stream(sc, id, localId, pc, up) {
      * @type{(this: Stream, track: MediaStreamTrack, transceiver: RTCRtpTransceiver, stream: MediaStream) => void}
      */
     this.ondowntrack = null;
+    /**
+     * ondatachannel is called whenever the server forwards a data channel
+     * opened by the sender of a down stream.  Messages sent on the
+     * channel are forwarded to the sender.
+     *
+     * @type{(this: Stream, channel: RTCDataChannel) => void}
+     */
+    this.ondatachannel = null;
     /**
      * onstatus is called whenever the status of the stream changes.
      *
@@ -1470,6 +1504,43 @@ Stream.prototype.request = function(what) {
     });
 };
 
+/**
+ * pause requests that the server stop forwarding some tracks of a down
+ * stream, without any renegotiation.
+ *
+ * @param {Array<string>} [tracks]
+ *     - the ids of the tracks to pause.  If absent, all tracks are paused.
+ */
+Stream.prototype.pause = function(tracks) {
+    let c = this;
+    if(c.up)
+        throw new Error("Attempting to pause an up stream");
+    c.sc.send({
+        type: 'pause',
+        id: c.id,
+        value: tracks,
+    });
+};
+
+/**
+ * resume requests that the server resume forwarding tracks that were
+ * paused by pause.  The server requests a keyframe for resumed video
+ * tracks.
+ *
+ * @param {Array<string>} [tracks]
+ *     - the ids of the tracks to resume.  If absent, all tracks are resumed.
+ */
+Stream.prototype.resume = function(tracks) {
+    let c = this;
+    if(c.up)
+        throw new Error("Attempting to resume an up stream");
+    c.sc.send({
+        type: 'resume',
+        id: c.id,
+        value: tracks,
+    });
+};
+
 /**
  * updateStats is called periodically, if requested by setStatsInterval,
  * in order to recompute stream statistics and invoke the onstats handler.
@@ -20,28 +20,141 @@
 
 'use strict';
 
-async function listStats() {
+/**
+ * The current statistics, updated by the event stream.
+ *
+ * @type {Array<Object>}
+ */
+let groups = [];
+
+/**
+ * True if a redraw of the table is pending.
+ *
+ * @type {boolean}
+ */
+let redrawPending = false;
+
+function listStats() {
     let table = document.getElementById('stats-table');
+    let source = new EventSource('/galene-api/v0/.events');
+    source.addEventListener('snapshot', e => {
+        groups = JSON.parse(e.data).groups || [];
+        redraw();
+    });
+    for(let type of ['join', 'leave', 'add', 'update', 'remove']) {
+        source.addEventListener(type, e => {
+            applyEvent(type, JSON.parse(e.data));
+            redraw();
+        });
+    }
+    source.onerror = function(e) {
+        if(source.readyState === EventSource.CLOSED) {
+            console.error(e);
+            table.textContent = "Couldn't fetch stats";
+        }
+    };
+}
 
-    let l;
-    try {
-        let r = await fetch('/galene-api/v0/.stats');
-        if(!r.ok)
-            throw new Error(`${r.status} ${r.statusText}`);
-        l = await r.json();
-    } catch(e) {
-        console.error(e);
-        table.textContent = `Couldn't fetch stats: ${e}`;
-        return;
+/**
+ * @param {string} a
+ * @param {string} b
+ */
+function compare(a, b) {
+    return a < b ? -1 : a > b ? 1 : 0;
+}
+
+/**
+ * @param {string} name
+ * @param {boolean} create
+ */
+function findGroup(name, create) {
+    let g = groups.find(g => g.name === name);
+    if(!g && create) {
+        g = {name: name, clients: []};
+        groups.push(g);
+        groups.sort((a, b) => compare(a.name, b.name));
     }
+    return g;
+}
 
-    if(l.length === 0) {
-        table.textContent = '(No group found.)';
+/**
+ * @param {string} type
+ * @param {Object} e
+ */
+function applyEvent(type, e) {
+    let g = findGroup(e.group, type !== 'leave' && type !== 'remove');
+    if(!g)
+        return;
+    if(!g.clients)
+        g.clients = [];
+    let i = g.clients.findIndex(c => c.id === e.client);
+    if(type === 'join') {
+        if(i < 0) {
+            g.clients.push({id: e.client});
+            g.clients.sort((a, b) => compare(a.id, b.id));
+        }
         return;
     }
+    if(i < 0)
+        return;
+    if(type === 'leave') {
+        g.clients.splice(i, 1);
+        if(g.clients.length === 0)
+            groups.splice(groups.indexOf(g), 1);
+        return;
+    }
+    let client = g.clients[i];
+    let conns = client[e.direction] || [];
+    let j = conns.findIndex(c => c.id === e.conn.id);
+    if(type === 'remove') {
+        if(j >= 0)
+            conns.splice(j, 1);
+    } else if(j >= 0 && e.delta) {
+        applyDelta(conns[j], e.delta);
+    } else if(j >= 0) {
+        conns[j] = e.conn;
+    } else {
+        conns.push(e.conn);
+        conns.sort((a, b) => compare(a.id, b.id));
+    }
+    client[e.direction] = conns;
+}
 
-    for(let i = 0; i < l.length; i++)
-        formatGroup(table, l[i]);
+/**
+ * @param {Object} conn
+ * @param {Object} delta
+ */
+function applyDelta(conn, delta) {
+    if('maxBitrate' in delta)
+        conn.maxBitrate = delta.maxBitrate;
+    if(!conn.tracks)
+        conn.tracks = [];
+    for(let i = 0; i < delta.tracks.length; i++) {
+        let t = conn.tracks[i] || (conn.tracks[i] = {});
+        for(let k in delta.tracks[i]) {
+            if(delta.tracks[i][k] === null)
+                delete(t[k]);
+            else
+                t[k] = delta.tracks[i][k];
+        }
+    }
+}
+
+function redraw() {
+    if(redrawPending)
+        return;
+    redrawPending = true;
+    requestAnimationFrame(() => {
+        redrawPending = false;
+        let table = document.getElementById('stats-table');
+        table.textContent = '';
+        if(groups.length === 0) {
+            table.textContent = '(No group found.)';
+            return;
+        }
+        for(let i = 0; i < groups.length; i++)
+            formatGroup(table, groups[i]);
+    });
 }
 
 function formatGroup(table, group) {
@@ -127,7 +240,73 @@ function formatTrack(table, track) {
         text = text + `±${Math.round(track.jitter * 1000) / 1000}ms`;
     td4.textContent = text;
     tr.appendChild(td4);
+    let td5 = document.createElement('td');
+    text = '';
+    if(track.pacerQueue || track.pacerDelay)
+        text = `${track.pacerQueue||0}p/` +
+            `${Math.round(track.pacerDelay||0)}ms`;
+    if(track.pacerDropped)
+        text = text + ` (${track.pacerDropped} dropped)`;
+    if(track.cacheMemory) {
+        text = `${Math.round(track.cacheMemory / 1024)}kB`;
+        if(track.cacheHits || track.cacheMisses)
+            text = text +
+                ` (${track.cacheHits||0}/${track.cacheMisses||0})`;
+    }
+    td5.textContent = text;
+    tr.appendChild(td5);
+    table.appendChild(tr);
+}
+
+/**
+ * The interval at which the health of the TURN servers is refreshed,
+ * in milliseconds.
+ */
+const iceInterval = 30 * 1000;
+
+async function listICE() {
+    let table = document.getElementById('ice-table');
+    let servers;
+    try {
+        let r = await fetch('/galene-api/v0/.ice');
+        if(!r.ok)
+            throw new Error(`${r.status} ${r.statusText}`);
+        servers = await r.json();
+    } catch(e) {
+        console.error(e);
+        table.textContent = "Couldn't fetch TURN server health";
+        return;
+    }
+    table.textContent = '';
+    if(!servers || servers.length === 0) {
+        table.textContent = '(No TURN server configured.)';
+        return;
+    }
+    for(let i = 0; i < servers.length; i++)
+        formatServer(table, servers[i]);
+}
+
+function formatServer(table, server) {
+    let tr = document.createElement('tr');
+    let td = document.createElement('td');
+    td.textContent = server.urls.join(' ');
+    tr.appendChild(td);
+    let td2 = document.createElement('td');
+    td2.textContent = server.healthy ? 'healthy' : 'failing';
+    tr.appendChild(td2);
+    let td3 = document.createElement('td');
+    if(server.latency)
+        td3.textContent = `${Math.round(server.latency)}ms`;
+    tr.appendChild(td3);
+    let td4 = document.createElement('td');
+    let text = `${server.successes||0}/${server.failures||0}`;
+    if(server.consecutiveFailures)
+        text = text + ` (${server.consecutiveFailures} in a row)`;
+    td4.textContent = text;
+    tr.appendChild(td4);
     table.appendChild(tr);
 }
 
 listStats();
+listICE();
+setInterval(listICE, iceInterval);
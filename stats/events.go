@@ -0,0 +1,375 @@
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// EventInterval is the interval at which statistics are sampled in order
+// to generate events.
+var EventInterval = time.Second
+
+// the number of events buffered for each subscriber
+const eventQueueSize = 1024
+
+// An update is only sent when a value has changed by more than
+// changeThreshold relative to the value last sent, or, for the loss
+// rate, by more than lossThreshold.
+const (
+	changeThreshold = 0.1
+	lossThreshold   = 0.01
+)
+
+// An Event is an incremental update to the statistics of a group.
+//
+// Type is one of "snapshot", "join", "leave", "add", "remove" and
+// "update".  A snapshot carries the full statistics of all the groups
+// that the subscriber is interested in, and is sent when the subscription
+// starts.  Join and leave events are sent when a client joins or leaves
+// a group, add and remove events when a stream is created or destroyed,
+// and update events when the statistics of the tracks of a stream have
+// changed significantly since the last event.  An update event carries
+// the changed fields in Delta, except when the number of tracks has
+// changed, in which case it carries the full statistics in Conn.
+type Event struct {
+	Type      string       `json:"-"`
+	Groups    []GroupStats `json:"groups,omitempty"`
+	Group     string       `json:"group,omitempty"`
+	Client    string       `json:"client,omitempty"`
+	Direction string       `json:"direction,omitempty"`
+	Conn      *Conn        `json:"conn,omitempty"`
+	Delta     *ConnDelta   `json:"delta,omitempty"`
+}
+
+// A ConnDelta holds the statistics of a stream that have changed.  Tracks
+// has one entry per track, mapping the JSON names of the fields that
+// have changed to their new value, or to nil if the field is no longer
+// present.
+type ConnDelta struct {
+	MaxBitrate *uint64          `json:"maxBitrate,omitempty"`
+	Tracks     []map[string]any `json:"tracks"`
+}
+
+// trackFields returns the fields of a track as they appear in JSON.
+func trackFields(t *Track) map[string]any {
+	var fields map[string]any
+	data, err := json.Marshal(t)
+	if err == nil {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+// number converts a JSON value to a float64.  A missing value is zero.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// significant returns true if the change of the field key from old to
+// new is worth sending to subscribers.
+func significant(key string, old, new any) bool {
+	x, ok1 := number(old)
+	y, ok2 := number(new)
+	if !ok1 || !ok2 {
+		return !reflect.DeepEqual(old, new)
+	}
+	d := math.Abs(y - x)
+	if key == "loss" {
+		return d > lossThreshold
+	}
+	return d > 0 && d >= changeThreshold*math.Abs(x)
+}
+
+// diffTracks returns the fields that differ between two lists of tracks
+// of the same length, and whether any of the changes is significant.
+func diffTracks(old, new []Track) ([]map[string]any, bool) {
+	sig := false
+	tracks := make([]map[string]any, len(new))
+	for i := range new {
+		o := trackFields(&old[i])
+		n := trackFields(&new[i])
+		d := make(map[string]any)
+		for k, v := range n {
+			if !reflect.DeepEqual(o[k], v) {
+				d[k] = v
+				sig = sig || significant(k, o[k], v)
+			}
+		}
+		for k, v := range o {
+			if _, ok := n[k]; !ok {
+				d[k] = nil
+				sig = sig || significant(k, v, nil)
+			}
+		}
+		tracks[i] = d
+	}
+	return tracks, sig
+}
+
+// diffConns returns the events needed to go from old to new, as well as
+// the statistics known to subscribers after these events have been
+// applied, which differ from new when a change was not significant.
+func diffConns(group, client, direction string, old, new []Conn) ([]Event, []Conn) {
+	var events []Event
+	var conns []Conn
+	oldConns := make(map[string]*Conn, len(old))
+	for i := range old {
+		oldConns[old[i].Id] = &old[i]
+	}
+	newConns := make(map[string]bool, len(new))
+	for i := range new {
+		c := &new[i]
+		newConns[c.Id] = true
+		o := oldConns[c.Id]
+		e := Event{
+			Type:      "update",
+			Group:     group,
+			Client:    client,
+			Direction: direction,
+		}
+		if o == nil || len(o.Tracks) != len(c.Tracks) {
+			if o == nil {
+				e.Type = "add"
+			}
+			e.Conn = c
+		} else {
+			tracks, sig := diffTracks(o.Tracks, c.Tracks)
+			delta := &ConnDelta{Tracks: tracks}
+			if o.MaxBitrate != c.MaxBitrate {
+				maxBitrate := c.MaxBitrate
+				delta.MaxBitrate = &maxBitrate
+				sig = sig || significant("maxBitrate",
+					float64(o.MaxBitrate), float64(c.MaxBitrate),
+				)
+			}
+			if !sig {
+				conns = append(conns, *o)
+				continue
+			}
+			e.Conn = &Conn{Id: c.Id}
+			e.Delta = delta
+		}
+		events = append(events, e)
+		conns = append(conns, *c)
+	}
+	for i := range old {
+		if !newConns[old[i].Id] {
+			events = append(events, Event{
+				Type:      "remove",
+				Group:     group,
+				Client:    client,
+				Direction: direction,
+				Conn:      &Conn{Id: old[i].Id},
+			})
+		}
+	}
+	return events, conns
+}
+
+func diffClients(group string, old, new []*Client) ([]Event, []*Client) {
+	var events []Event
+	var clients []*Client
+	oldClients := make(map[string]*Client, len(old))
+	for _, c := range old {
+		oldClients[c.Id] = c
+	}
+	newClients := make(map[string]bool, len(new))
+	for _, c := range new {
+		newClients[c.Id] = true
+		o := oldClients[c.Id]
+		if o == nil {
+			events = append(events, Event{
+				Type:   "join",
+				Group:  group,
+				Client: c.Id,
+			})
+			o = &Client{}
+		}
+		up, upConns := diffConns(group, c.Id, "up", o.Up, c.Up)
+		events = append(events, up...)
+		down, downConns := diffConns(group, c.Id, "down", o.Down, c.Down)
+		events = append(events, down...)
+		clients = append(clients, &Client{
+			Id:   c.Id,
+			Up:   upConns,
+			Down: downConns,
+		})
+	}
+	for _, c := range old {
+		if newClients[c.Id] {
+			continue
+		}
+		for _, conn := range c.Up {
+			events = append(events, Event{
+				Type:      "remove",
+				Group:     group,
+				Client:    c.Id,
+				Direction: "up",
+				Conn:      &Conn{Id: conn.Id},
+			})
+		}
+		for _, conn := range c.Down {
+			events = append(events, Event{
+				Type:      "remove",
+				Group:     group,
+				Client:    c.Id,
+				Direction: "down",
+				Conn:      &Conn{Id: conn.Id},
+			})
+		}
+		events = append(events, Event{
+			Type:   "leave",
+			Group:  group,
+			Client: c.Id,
+		})
+	}
+	return events, clients
+}
+
+// diff returns the events needed to go from one snapshot to the next,
+// and the statistics known to subscribers once they have been applied,
+// against which the next snapshot should be compared.
+func diff(old, new []GroupStats) ([]Event, []GroupStats) {
+	var events []Event
+	var groups []GroupStats
+	oldGroups := make(map[string]*GroupStats, len(old))
+	for i := range old {
+		oldGroups[old[i].Name] = &old[i]
+	}
+	newGroups := make(map[string]bool, len(new))
+	for i := range new {
+		g := &new[i]
+		newGroups[g.Name] = true
+		var clients []*Client
+		if o := oldGroups[g.Name]; o != nil {
+			clients = o.Clients
+		}
+		evs, cs := diffClients(g.Name, clients, g.Clients)
+		events = append(events, evs...)
+		groups = append(groups, GroupStats{Name: g.Name, Clients: cs})
+	}
+	for i := range old {
+		if !newGroups[old[i].Name] {
+			evs, _ := diffClients(old[i].Name, old[i].Clients, nil)
+			events = append(events, evs...)
+		}
+	}
+	return events, groups
+}
+
+type subscriber struct {
+	group string
+	ch    chan Event
+}
+
+var events struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	running     bool
+	last        []GroupStats
+}
+
+func (s *subscriber) wants(group string) bool {
+	return s.group == "" || s.group == group
+}
+
+// send queues an event for a subscriber.  If the subscriber is not
+// keeping up, it is dropped and its channel is closed.  Called with
+// events.mu held.
+func (s *subscriber) send(e Event) {
+	select {
+	case s.ch <- e:
+	default:
+		delete(events.subscribers, s)
+		close(s.ch)
+	}
+}
+
+func snapshot(group string, groups []GroupStats) Event {
+	e := Event{Type: "snapshot", Groups: []GroupStats{}}
+	for _, g := range groups {
+		if group == "" || g.Name == group {
+			e.Groups = append(e.Groups, g)
+		}
+	}
+	return e
+}
+
+// Subscribe returns a channel on which events about the given group, or
+// about all groups if group is empty, will be delivered, starting with
+// a snapshot.  The channel is closed if the receiver doesn't keep up.
+// The returned function must be called in order to unsubscribe.
+func Subscribe(group string) (<-chan Event, func()) {
+	s := &subscriber{
+		group: group,
+		ch:    make(chan Event, eventQueueSize),
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	if events.subscribers == nil {
+		events.subscribers = make(map[*subscriber]struct{})
+	}
+	if !events.running {
+		events.last = GetGroups()
+		events.running = true
+		go eventLoop()
+	}
+	events.subscribers[s] = struct{}{}
+	s.send(snapshot(group, events.last))
+
+	return s.ch, func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		_, ok := events.subscribers[s]
+		if ok {
+			delete(events.subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// eventLoop periodically samples the statistics and distributes events
+// to subscribers.  It terminates when there are no subscribers left.
+func eventLoop() {
+	ticker := time.NewTicker(EventInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		groups := GetGroups()
+
+		events.mu.Lock()
+		if len(events.subscribers) == 0 {
+			events.running = false
+			events.last = nil
+			events.mu.Unlock()
+			return
+		}
+		var evs []Event
+		evs, events.last = diff(events.last, groups)
+		for s := range events.subscribers {
+			for _, e := range evs {
+				if s.wants(e.Group) {
+					s.send(e)
+					if _, ok := events.subscribers[s]; !ok {
+						break
+					}
+				}
+			}
+		}
+		events.mu.Unlock()
+	}
+}
@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := []GroupStats{
+		{
+			Name: "a",
+			Clients: []*Client{
+				{
+					Id: "c1",
+					Up: []Conn{
+						{Id: "u1", Tracks: []Track{{Bitrate: 1}}},
+						{Id: "u2", Tracks: []Track{{Bitrate: 2}}},
+					},
+				},
+				{
+					Id:   "c2",
+					Down: []Conn{{Id: "d1"}},
+				},
+			},
+		},
+		{Name: "b", Clients: []*Client{{Id: "c3"}}},
+	}
+	new := []GroupStats{
+		{
+			Name: "a",
+			Clients: []*Client{
+				{
+					Id: "c1",
+					Up: []Conn{
+						{Id: "u1", Tracks: []Track{{Bitrate: 1}}},
+						{Id: "u2", Tracks: []Track{{Bitrate: 3}}},
+						{Id: "u3"},
+					},
+				},
+				{Id: "c4"},
+			},
+		},
+	}
+
+	type ev struct {
+		typ, group, client, direction, conn string
+	}
+	expected := []ev{
+		{"update", "a", "c1", "up", "u2"},
+		{"add", "a", "c1", "up", "u3"},
+		{"join", "a", "c4", "", ""},
+		{"remove", "a", "c2", "down", "d1"},
+		{"leave", "a", "c2", "", ""},
+		{"leave", "b", "c3", "", ""},
+	}
+
+	var result []ev
+	evs, _ := diff(old, new)
+	for _, e := range evs {
+		conn := ""
+		if e.Conn != nil {
+			conn = e.Conn.Id
+		}
+		result = append(result,
+			ev{e.Type, e.Group, e.Client, e.Direction, conn},
+		)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got %v, expected %v", result, expected)
+	}
+
+	if evs, _ := diff(new, new); len(evs) != 0 {
+		t.Errorf("Diff of identical snapshots: %v", evs)
+	}
+}
+
+func TestDiffThreshold(t *testing.T) {
+	sample := func(bitrate uint64, loss float64, paused bool) []GroupStats {
+		return []GroupStats{{
+			Name: "a",
+			Clients: []*Client{{
+				Id: "c1",
+				Up: []Conn{{
+					Id: "u1",
+					Tracks: []Track{
+						{Bitrate: 100},
+						{
+							Bitrate: bitrate,
+							Loss:    loss,
+							Paused:  paused,
+						},
+					},
+				}},
+			}},
+		}}
+	}
+
+	tests := []struct {
+		bitrate uint64
+		loss    float64
+		paused  bool
+		delta   map[string]any
+	}{
+		{1000, 0, false, nil},
+		{1050, 0.005, false, nil},
+		// compared with the last value sent, not the last sample
+		{1110, 0.005, false, map[string]any{
+			"bitrate": 1110.0, "loss": 0.005,
+		}},
+		{1110, 0.02, false, map[string]any{"loss": 0.02}},
+		{1120, 0.02, true, map[string]any{
+			"bitrate": 1120.0, "paused": true,
+		}},
+		{1120, 0.02, false, map[string]any{"paused": nil}},
+	}
+
+	last := sample(1000, 0, false)
+	for i, test := range tests {
+		var evs []Event
+		evs, last = diff(last, sample(test.bitrate, test.loss, test.paused))
+		if test.delta == nil {
+			if len(evs) != 0 {
+				t.Errorf("%v: got %v, expected no events", i, evs)
+			}
+			continue
+		}
+		if len(evs) != 1 || evs[0].Type != "update" ||
+			evs[0].Conn == nil || evs[0].Conn.Id != "u1" ||
+			evs[0].Delta == nil {
+			t.Errorf("%v: got %v, expected update", i, evs)
+			continue
+		}
+		expected := []map[string]any{{}, test.delta}
+		if !reflect.DeepEqual(evs[0].Delta.Tracks, expected) {
+			t.Errorf("%v: got %v, expected %v",
+				i, evs[0].Delta.Tracks, expected,
+			)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ch, unsubscribe := Subscribe("nonexistent")
+	e := <-ch
+	if e.Type != "snapshot" || len(e.Groups) != 0 {
+		t.Errorf("Got %v, expected empty snapshot", e)
+	}
+	unsubscribe()
+	_, ok := <-ch
+	if ok {
+		t.Errorf("Channel not closed")
+	}
+	// unsubscribing twice is harmless
+	unsubscribe()
+}
@@ -47,15 +47,22 @@ func (d *Duration) UnmarshalJSON(buf []byte) error {
 }
 
 type Track struct {
-	Sid        *uint8   `json:"sid,omitempty"`
-	MaxSid     *uint8   `json:"maxSid,omitempty"`
-	Tid        *uint8   `json:"tid,omitempty"`
-	MaxTid     *uint8   `json:"maxTid,omitempty"`
-	Bitrate    uint64   `json:"bitrate"`
-	MaxBitrate uint64   `json:"maxBitrate,omitempty"`
-	Loss       float64  `json:"loss"`
-	Rtt        Duration `json:"rtt,omitempty"`
-	Jitter     Duration `json:"jitter,omitempty"`
+	Sid          *uint8   `json:"sid,omitempty"`
+	MaxSid       *uint8   `json:"maxSid,omitempty"`
+	Tid          *uint8   `json:"tid,omitempty"`
+	MaxTid       *uint8   `json:"maxTid,omitempty"`
+	Bitrate      uint64   `json:"bitrate"`
+	MaxBitrate   uint64   `json:"maxBitrate,omitempty"`
+	Loss         float64  `json:"loss"`
+	Rtt          Duration `json:"rtt,omitempty"`
+	Jitter       Duration `json:"jitter,omitempty"`
+	Paused       bool     `json:"paused,omitempty"`
+	PacerQueue   int      `json:"pacerQueue,omitempty"`
+	PacerDelay   Duration `json:"pacerDelay,omitempty"`
+	PacerDropped uint64   `json:"pacerDropped,omitempty"`
+	CacheMemory  int64    `json:"cacheMemory,omitempty"`
+	CacheHits    uint32   `json:"cacheHits,omitempty"`
+	CacheMisses  uint32   `json:"cacheMisses,omitempty"`
 }
 
 func GetGroups() []GroupStats {
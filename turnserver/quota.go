@@ -0,0 +1,115 @@
+package turnserver
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+// MaxLifetime is the maximum lifetime of an allocation, after which its
+// relayed address is closed, or 0 for no limit.
+var MaxLifetime = 24 * time.Hour
+
+// MaxRate is the maximum rate, in bits per second, relayed in each
+// direction by a single allocation, or 0 for no limit.
+var MaxRate = 20 * 1024 * 1024
+
+// quotaGenerator wraps a relay address generator in order to enforce the
+// lifetime and rate limits on the allocated relayed addresses.
+type quotaGenerator struct {
+	turn.RelayAddressGenerator
+}
+
+func (g quotaGenerator) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.RelayAddressGenerator.AllocatePacketConn(
+		network, requestedPort,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newQuotaConn(conn, MaxLifetime, MaxRate), addr, nil
+}
+
+// A bucket is a token bucket that allows bursts of one second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow returns true if n bytes may be sent at the given rate, in bytes
+// per second.
+func (b *bucket) allow(rate float64, n int, now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else {
+		b.tokens += rate * now.Sub(b.last).Seconds()
+		if b.tokens > rate {
+			b.tokens = rate
+		}
+	}
+	b.last = now
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// A quotaConn is a relayed address that is closed after a given lifetime,
+// and that drops packets in excess of a given rate.
+type quotaConn struct {
+	net.PacketConn
+	rate  float64
+	timer *time.Timer
+
+	mu            sync.Mutex
+	read, written bucket
+}
+
+func newQuotaConn(conn net.PacketConn, lifetime time.Duration, rate int) *quotaConn {
+	c := &quotaConn{
+		PacketConn: conn,
+		rate:       float64(rate) / 8,
+	}
+	if lifetime > 0 {
+		c.timer = time.AfterFunc(lifetime, func() {
+			conn.Close()
+		})
+	}
+	return c
+}
+
+func (c *quotaConn) allow(b *bucket, n int) bool {
+	if c.rate <= 0 {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return b.allow(c.rate, n, time.Now())
+}
+
+func (c *quotaConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || c.allow(&c.read, n) {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *quotaConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if !c.allow(&c.written, len(p)) {
+		// pretend the packet was lost in the network
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *quotaConn) Close() error {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return c.PacketConn.Close()
+}
@@ -1,52 +1,124 @@
 package turnserver
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pion/turn/v4"
 	"github.com/pion/webrtc/v4"
 )
 
-var username string
-var password string
+// the username used by the server itself
+const serverUsername = "galene"
+
+// the secret used to compute credentials, generated at startup
+var secret []byte
+
+// Address is the address of the built-in TURN server, "auto" to start
+// it only when no other TURN server is configured, or "" to disable it.
 var Address string
 
+// TLSAddress is the public name and port of the TLS listener of the
+// built-in TURN server, or "" to disable it.
+var TLSAddress string
+
+// GetCertificate is used to obtain the certificate of the TLS listener.
+var GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// AddressFilter, if not nil, restricts the local addresses on which the
+// server listens.
+var AddressFilter func(ifname string, ip net.IP) bool
+
+// PublicAddress, if not nil, returns the public address of a local
+// address in the case of 1:1 NAT, or nil if the address is not mapped.
+var PublicAddress func(ip net.IP) net.IP
+
+// CredentialLifetime is the validity of the credentials handed out to
+// clients.
+var CredentialLifetime = 24 * time.Hour
+
 var server struct {
-	mu        sync.Mutex
-	addresses []net.Addr
-	server    *turn.Server
+	mu         sync.Mutex
+	addresses  []net.Addr
+	tlsAddress string
+	server     *turn.Server
 }
 
-func publicAddresses() ([]net.IP, error) {
-	addrs, err := net.InterfaceAddrs()
+// a local address, and the address seen by clients if it is different
+type localAddress struct {
+	local, public net.IP
+}
+
+func (a localAddress) advertised() net.IP {
+	if a.public != nil {
+		return a.public
+	}
+	return a.local
+}
+
+func isPrivate(a net.IP) bool {
+	return a[0] == 10 ||
+		a[0] == 172 && a[1] >= 16 && a[1] < 32 ||
+		a[0] == 192 && a[1] == 168
+}
+
+// publicAddresses returns the local addresses that are reachable from the
+// Internet, either directly or through 1:1 NAT.
+func publicAddresses() ([]localAddress, error) {
+	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 
-	var as []net.IP
+	var as []localAddress
+	seen := make(map[string]bool)
 
-	for _, addr := range addrs {
-		switch addr := addr.(type) {
-		case *net.IPNet:
-			a := addr.IP.To4()
-			if a == nil {
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Printf("TURN: %v: %v", iface.Name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			a := ipnet.IP.To4()
+			if a == nil || !a.IsGlobalUnicast() {
 				continue
 			}
-			if !a.IsGlobalUnicast() {
+			if AddressFilter != nil && !AddressFilter(iface.Name, a) {
 				continue
 			}
-			if a[0] == 10 ||
-				a[0] == 172 && a[1] >= 16 && a[1] < 32 ||
-				a[0] == 192 && a[1] == 168 {
+			if PublicAddress != nil {
+				p := PublicAddress(a).To4()
+				if p != nil {
+					if !seen[p.String()] {
+						seen[p.String()] = true
+						as = append(as, localAddress{a, p})
+					}
+					continue
+				}
+			}
+			if isPrivate(a) {
 				continue
 			}
-			as = append(as, a)
+			as = append(as, localAddress{a, nil})
 		}
 	}
 	return as, nil
@@ -68,6 +140,7 @@ func listener(a net.IP, port int, relay net.IP) (*turn.PacketConnConfig, *turn.L
 			Address:      a.String(),
 		}
 	}
+	g = quotaGenerator{g}
 
 	p, err := net.ListenPacket("udp4", s)
 	if err == nil {
@@ -113,17 +186,13 @@ func Start() error {
 		return err
 	}
 
-	username = "galene"
-	buf := make([]byte, 6)
-	_, err = rand.Read(buf)
+	secret = make([]byte, 32)
+	_, err = rand.Read(secret)
 	if err != nil {
 		return err
 	}
 
-	buf2 := make([]byte, 8)
-	base64.RawStdEncoding.Encode(buf2, buf)
-	password = string(buf2)
-
+	var relay net.IP
 	var lcs []turn.ListenerConfig
 	var pccs []turn.PacketConnConfig
 
@@ -132,6 +201,7 @@ func Start() error {
 		if a == nil {
 			return errors.New("couldn't parse address")
 		}
+		relay = a
 		pcc, lc := listener(net.IP{0, 0, 0, 0}, addr.Port, a)
 		if pcc != nil {
 			pccs = append(pccs, *pcc)
@@ -156,14 +226,15 @@ func Start() error {
 		if len(as) == 0 {
 			return errors.New("no public addresses")
 		}
+		relay = as[0].advertised()
 
 		for _, a := range as {
-			pcc, lc := listener(a, addr.Port, nil)
+			pcc, lc := listener(a.local, addr.Port, a.public)
 			if pcc != nil {
 				pccs = append(pccs, *pcc)
 				server.addresses = append(server.addresses,
 					&net.UDPAddr{
-						IP:   a,
+						IP:   a.advertised(),
 						Port: addr.Port,
 					},
 				)
@@ -172,7 +243,7 @@ func Start() error {
 				lcs = append(lcs, *lc)
 				server.addresses = append(server.addresses,
 					&net.TCPAddr{
-						IP:   a,
+						IP:   a.advertised(),
 						Port: addr.Port,
 					},
 				)
@@ -180,6 +251,16 @@ func Start() error {
 		}
 	}
 
+	if TLSAddress != "" {
+		lc, err := tlsListener(TLSAddress, relay)
+		if err != nil {
+			log.Printf("TURN: %v", err)
+		} else {
+			lcs = append(lcs, *lc)
+			server.tlsAddress = TLSAddress
+		}
+	}
+
 	if len(pccs) == 0 && len(lcs) == 0 {
 		return errors.New("couldn't establish any listeners")
 	}
@@ -189,10 +270,10 @@ func Start() error {
 	server.server, err = turn.NewServer(turn.ServerConfig{
 		Realm: "galene.org",
 		AuthHandler: func(u, r string, src net.Addr) ([]byte, bool) {
-			if u != username || r != "galene.org" {
+			if r != "galene.org" || !validUsername(u, time.Now()) {
 				return nil, false
 			}
-			return turn.GenerateAuthKey(u, r, password), true
+			return turn.GenerateAuthKey(u, r, password(u)), true
 		},
 		ListenerConfigs:   lcs,
 		PacketConnConfigs: pccs,
@@ -200,13 +281,82 @@ func Start() error {
 
 	if err != nil {
 		server.addresses = nil
+		server.tlsAddress = ""
 		return err
 	}
 
 	return nil
 }
 
+// tlsListener creates a TLS listener on the port of address, which must
+// be of the form host:port.
+func tlsListener(address string, relay net.IP) (*turn.ListenerConfig, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if GetCertificate == nil {
+		return nil, errors.New("no certificate for TLS listener")
+	}
+	if relay == nil {
+		return nil, errors.New("no relay address for TLS listener")
+	}
+	l, err := tls.Listen("tcp4", ":"+port, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: GetCertificate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &turn.ListenerConfig{
+		Listener: l,
+		RelayAddressGenerator: quotaGenerator{
+			&turn.RelayAddressGeneratorStatic{
+				RelayAddress: relay,
+				Address:      "0.0.0.0",
+			},
+		},
+	}, nil
+}
+
+// password computes the password associated with a username, using the
+// scheme of the TURN REST API.
+func password(username string) string {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validUsername returns true if username is of the form expiry:user,
+// where expiry is a Unix timestamp in the future.
+func validUsername(username string, now time.Time) bool {
+	ts, _, found := strings.Cut(username, ":")
+	if !found {
+		return false
+	}
+	expiry, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Unix() < expiry
+}
+
+// credentials returns a time-limited username and password for user.
+func credentials(user string, now time.Time) (string, string) {
+	expiry := now.Add(CredentialLifetime).Unix()
+	username := fmt.Sprintf("%d:%s", expiry, user)
+	return username, password(username)
+}
+
+// ICEServers returns the ICE configuration of the built-in TURN server,
+// with credentials for use by the server itself.
 func ICEServers() []webrtc.ICEServer {
+	return ClientICEServers(serverUsername)
+}
+
+// ClientICEServers returns the ICE configuration of the built-in TURN
+// server, with credentials specific to the given client.
+func ClientICEServers(user string) []webrtc.ICEServer {
 	server.mu.Lock()
 	defer server.mu.Unlock()
 
@@ -225,7 +375,11 @@ func ICEServers() []webrtc.ICEServer {
 			log.Printf("unexpected TURN address %T", a)
 		}
 	}
+	if server.tlsAddress != "" {
+		urls = append(urls, "turns:"+server.tlsAddress+"?transport=tcp")
+	}
 
+	username, password := credentials(user, time.Now())
 	return []webrtc.ICEServer{
 		{
 			URLs:       urls,
@@ -241,6 +395,7 @@ func Stop() error {
 	defer server.mu.Unlock()
 
 	server.addresses = nil
+	server.tlsAddress = ""
 	if server.server == nil {
 		return nil
 	}
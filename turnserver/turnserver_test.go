@@ -0,0 +1,90 @@
+package turnserver
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentials(t *testing.T) {
+	secret = []byte("secret")
+	now := time.Now()
+	username, pw := credentials("client", now)
+	if !strings.HasSuffix(username, ":client") {
+		t.Errorf("Bad username %v", username)
+	}
+	if pw != password(username) {
+		t.Errorf("Bad password for %v", username)
+	}
+	if !validUsername(username, now) {
+		t.Errorf("Username %v is not valid", username)
+	}
+	if validUsername(username, now.Add(CredentialLifetime+time.Second)) {
+		t.Errorf("Username %v is valid after expiry", username)
+	}
+	for _, u := range []string{"galene", "abc:client", ":client"} {
+		if validUsername(u, now) {
+			t.Errorf("Username %v is valid", u)
+		}
+	}
+
+	secret = []byte("other secret")
+	if pw == password(username) {
+		t.Errorf("Password didn't change with secret")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	var b bucket
+	now := time.Now()
+	if !b.allow(1000, 600, now) {
+		t.Errorf("First packet not allowed")
+	}
+	if b.allow(1000, 600, now) {
+		t.Errorf("Burst allowed")
+	}
+	if !b.allow(1000, 600, now.Add(200*time.Millisecond)) {
+		t.Errorf("Packet not allowed after 200ms")
+	}
+}
+
+func TestQuotaConn(t *testing.T) {
+	p1, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer p1.Close()
+	p2, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+
+	c := newQuotaConn(p2, 100*time.Millisecond, 8*1000)
+	buf := make([]byte, 600)
+	n, err := c.WriteTo(buf, p1.LocalAddr())
+	if n != 600 || err != nil {
+		t.Errorf("WriteTo: %v %v", n, err)
+	}
+	// dropped, but reported as successful
+	n, err = c.WriteTo(buf, p1.LocalAddr())
+	if n != 600 || err != nil {
+		t.Errorf("WriteTo: %v %v", n, err)
+	}
+
+	p1.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	n, _, err = p1.ReadFrom(buf)
+	if n != 600 || err != nil {
+		t.Errorf("ReadFrom: %v %v", n, err)
+	}
+	n, _, err = p1.ReadFrom(buf)
+	if err == nil {
+		t.Errorf("Got %v bytes, expected timeout", n)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	_, err = c.WriteTo(buf[:10], p1.LocalAddr())
+	if err == nil {
+		t.Errorf("Connection still open after lifetime")
+	}
+}
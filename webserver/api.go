@@ -14,6 +14,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/jech/galene/group"
+	"github.com/jech/galene/ice"
 	"github.com/jech/galene/stats"
 	"github.com/jech/galene/token"
 )
@@ -127,6 +128,37 @@ func getJSON(w http.ResponseWriter, r *http.Request, v any) bool {
 	return false
 }
 
+// getPatch reads a JSON merge patch (RFC 7396) from the request body.
+func getPatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	ctype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil ||
+		!strings.EqualFold(ctype, "application/merge-patch+json") {
+		w.Header().Set("Accept-Patch", "application/merge-patch+json")
+		http.Error(w, "unsupported content type",
+			http.StatusUnsupportedMediaType)
+		return nil, true
+	}
+
+	body, err := io.ReadAll(
+		http.MaxBytesReader(w, r.Body, maxAPIMessageSize),
+	)
+	if err != nil {
+		httpError(w, err)
+		return nil, true
+	}
+	return body, false
+}
+
+// patchTag returns the ETag that a patch must be applied to, or the empty
+// string if the patch applies to any version.
+func patchTag(r *http.Request, etag string) string {
+	im := strings.TrimSpace(r.Header.Get("If-Match"))
+	if im == "" || im == "*" {
+		return ""
+	}
+	return etag
+}
+
 func apiCORS(w http.ResponseWriter, r *http.Request, methods string) bool {
 	CheckOrigin(w, r, true)
 	if r.Method == "OPTIONS" {
@@ -169,6 +201,41 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("cache-control", "no-cache")
 		sendJSON(w, r, stats.GetGroups())
+	case ".events":
+		if rest != "" {
+			http.NotFound(w, r)
+			return
+		}
+		eventsHandler(w, r)
+	case ".ice":
+		if rest != "" {
+			http.NotFound(w, r)
+			return
+		}
+		if apiCORS(w, r, "HEAD, GET") {
+			return
+		}
+		if !checkAdmin(w, r) {
+			return
+		}
+		if r.Method != "HEAD" && r.Method != "GET" {
+			methodNotAllowed(w, "HEAD, GET")
+			return
+		}
+		w.Header().Set("cache-control", "no-cache")
+		sendJSON(w, r, ice.Health())
+	case ".config":
+		if rest != "" {
+			http.NotFound(w, r)
+			return
+		}
+		configHandler(w, r)
+	case ".ice-servers":
+		if rest != "" {
+			http.NotFound(w, r)
+			return
+		}
+		iceServersHandler(w, r)
 	case ".groups":
 		apiGroupHandler(w, r, rest)
 	default:
@@ -217,6 +284,18 @@ func apiGroupHandler(w http.ResponseWriter, r *http.Request, pth string) {
 	} else if kind == ".tokens" {
 		tokensHandler(w, r, g, rest)
 		return
+	} else if kind == ".clients" {
+		clientsHandler(w, r, g, rest)
+		return
+	} else if kind == ".lock" && rest == "" {
+		lockHandler(w, r, g)
+		return
+	} else if kind == ".wallops" && rest == "" {
+		wallopsHandler(w, r, g)
+		return
+	} else if kind == ".recording" && rest == "" {
+		recordingHandler(w, r, g)
+		return
 	} else if kind != "" {
 		if !checkAdmin(w, r) {
 			return
@@ -225,7 +304,7 @@ func apiGroupHandler(w http.ResponseWriter, r *http.Request, pth string) {
 		return
 	}
 
-	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+	if apiCORS(w, r, "HEAD, GET, PUT, PATCH, DELETE") {
 		return
 	}
 	if !checkAdmin(w, r) {
@@ -279,6 +358,29 @@ func apiGroupHandler(w http.ResponseWriter, r *http.Request, pth string) {
 			w.WriteHeader(http.StatusNoContent)
 		}
 		return
+	} else if r.Method == "PATCH" {
+		etag, err := group.GetDescriptionTag(g)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+
+		patch, done := getPatch(w, r)
+		if done {
+			return
+		}
+		err = group.PatchDescription(g, patchTag(r, etag), patch)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
 	} else if r.Method == "DELETE" {
 		etag, err := group.GetDescriptionTag(g)
 		if err != nil {
@@ -298,7 +400,7 @@ func apiGroupHandler(w http.ResponseWriter, r *http.Request, pth string) {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	methodNotAllowed(w, "HEAD, GET, PUT, DELETE")
+	methodNotAllowed(w, "HEAD, GET, PUT, PATCH, DELETE")
 	return
 }
 
@@ -363,7 +465,7 @@ func specialUserHandler(w http.ResponseWriter, r *http.Request, g, pth string, w
 }
 
 func userHandler(w http.ResponseWriter, r *http.Request, g, user string, wildcard bool) {
-	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+	if apiCORS(w, r, "HEAD, GET, PUT, PATCH, DELETE") {
 		return
 	}
 	if !checkAdmin(w, r) {
@@ -414,6 +516,31 @@ func userHandler(w http.ResponseWriter, r *http.Request, g, user string, wildcar
 			w.WriteHeader(http.StatusNoContent)
 		}
 		return
+	} else if r.Method == "PATCH" {
+		etag, err := group.GetUserTag(g, user, wildcard)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+
+		patch, done := getPatch(w, r)
+		if done {
+			return
+		}
+		err = group.PatchUser(
+			g, user, wildcard, patchTag(r, etag), patch,
+		)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
 	} else if r.Method == "DELETE" {
 		etag, err := group.GetUserTag(g, user, wildcard)
 		if err != nil {
@@ -434,7 +561,7 @@ func userHandler(w http.ResponseWriter, r *http.Request, g, user string, wildcar
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	methodNotAllowed(w, "HEAD, GET, PUT, DELETE")
+	methodNotAllowed(w, "HEAD, GET, PUT, PATCH, DELETE")
 	return
 }
 
@@ -420,6 +420,110 @@ func TestApi(t *testing.T) {
 	}
 }
 
+func TestApiPatch(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := http.Client{}
+
+	do := func(method, path, ctype, im, body string) int {
+		req, err := http.NewRequest(method,
+			"http://localhost:1234/galene-api/v0/.groups"+path,
+			strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("New request: %v", err)
+		}
+		if ctype != "" {
+			req.Header.Set("Content-Type", ctype)
+		}
+		if im != "" {
+			req.Header.Set("If-Match", im)
+		}
+		req.SetBasicAuth("root", "pw")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%v %v: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const patch = "application/merge-patch+json"
+
+	status := do("PATCH", "/test/", patch, "", `{"public": true}`)
+	if status != http.StatusNotFound {
+		t.Errorf("Patch nonexistent group: %v", status)
+	}
+
+	status = do("PUT", "/test/", "application/json", "",
+		`{"contact": "jch"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Create group: %v", status)
+	}
+
+	status = do("PATCH", "/test/", "application/json", "",
+		`{"public": true}`)
+	if status != http.StatusUnsupportedMediaType {
+		t.Errorf("Patch group (bad content-type): %v", status)
+	}
+
+	status = do("PATCH", "/test/", patch, "\"foo\"", `{"public": true}`)
+	if status != http.StatusPreconditionFailed {
+		t.Errorf("Patch group (bad ETag): %v", status)
+	}
+
+	status = do("PATCH", "/test/", patch, "", `{"users": {}}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Patch group (users): %v", status)
+	}
+
+	_, etag, err := group.GetSanitisedDescription("test")
+	if err != nil {
+		t.Fatalf("GetSanitisedDescription: %v", err)
+	}
+	status = do("PATCH", "/test/", patch, etag,
+		`{"public": true, "contact": null}`)
+	if status != http.StatusNoContent {
+		t.Errorf("Patch group: %v", status)
+	}
+
+	desc, err := group.GetDescription("test")
+	if err != nil || !desc.Public || desc.Contact != "" {
+		t.Errorf("Patched group: %v %v", err, desc)
+	}
+
+	status = do("PUT", "/test/.users/jch", "application/json", "",
+		`{"permissions": "present"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Create user: %v", status)
+	}
+
+	status = do("PATCH", "/test/.users/jch", patch, "",
+		`{"permissions": "op"}`)
+	if status != http.StatusNoContent {
+		t.Errorf("Patch user: %v", status)
+	}
+
+	status = do("PATCH", "/test/.users/jch", patch, "",
+		`{"password": "pw"}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Patch user (password): %v", status)
+	}
+
+	user, _, err := group.GetSanitisedUser("test", "jch", false)
+	if err != nil || user.Permissions.String() != "op" {
+		t.Errorf("Patched user: %v %v", err, user.Permissions)
+	}
+
+	status = do("PATCH", "/test/.wildcard-user", patch, "",
+		`{"permissions": "op"}`)
+	if status != http.StatusNotFound {
+		t.Errorf("Patch nonexistent wildcard user: %v", status)
+	}
+}
+
 func TestApiBadAuth(t *testing.T) {
 	err := setupTest(t.TempDir(), t.TempDir())
 	if err != nil {
@@ -448,6 +552,12 @@ func TestApiBadAuth(t *testing.T) {
 	}
 
 	do("GET", "/galene-api/v0/.stats")
+	do("GET", "/galene-api/v0/.ice")
+	do("GET", "/galene-api/v0/.events")
+	do("GET", "/galene-api/v0/.config")
+	do("PATCH", "/galene-api/v0/.config")
+	do("GET", "/galene-api/v0/.ice-servers")
+	do("PUT", "/galene-api/v0/.ice-servers")
 	do("GET", "/galene-api/v0/.groups/")
 	do("PUT", "/galene-api/v0/.groups/test/")
 
@@ -468,6 +578,10 @@ func TestApiBadAuth(t *testing.T) {
 	do("PUT", "/galene-api/v0/.groups/test/.users/jch")
 	do("DELETE", "/galene-api/v0/.groups/test/.users/jch")
 	do("GET", "/galene-api/v0/.groups/test/.users/not-jch")
+	do("GET", "/galene-api/v0/.groups/test/.clients/")
+	do("PUT", "/galene-api/v0/.groups/test/.lock")
+	do("POST", "/galene-api/v0/.groups/test/.wallops")
+	do("PUT", "/galene-api/v0/.groups/test/.recording")
 	do("PUT", "/galene-api/v0/.groups/test/.users/not-jch")
 	do("PUT", "/galene-api/v0/.groups/test/.users/jch/.password")
 	do("POST", "/galene-api/v0/.groups/test/.users/jch/.password")
@@ -0,0 +1,162 @@
+package webserver
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/ice"
+)
+
+// configHandler handles the server configuration in config.json.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	if apiCORS(w, r, "HEAD, GET, PUT, PATCH") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	if r.Method == "HEAD" || r.Method == "GET" {
+		conf, etag, err := group.GetSanitisedConfiguration()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.Header().Set("etag", etag)
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+		sendJSON(w, r, conf)
+		return
+	} else if r.Method == "PUT" || r.Method == "PATCH" {
+		etag, err := group.GetConfigurationTag()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+
+		if r.Method == "PUT" {
+			var conf group.Configuration
+			done = getJSON(w, r, &conf)
+			if done {
+				return
+			}
+			err = group.UpdateConfiguration(etag, &conf)
+		} else {
+			patch, done := getPatch(w, r)
+			if done {
+				return
+			}
+			err = group.PatchConfiguration(patchTag(r, etag), patch)
+		}
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	methodNotAllowed(w, "HEAD, GET, PUT, PATCH")
+}
+
+// iceServersHandler handles the ICE servers in ice-servers.json.  Since
+// the file contains an array, which would be replaced as a whole by a
+// merge patch, we don't support PATCH.
+func iceServersHandler(w http.ResponseWriter, r *http.Request) {
+	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	if r.Method == "HEAD" || r.Method == "GET" {
+		servers, etag, err := ice.GetServers()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.Header().Set("etag", etag)
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+		w.Header().Set("cache-control", "no-cache")
+		sendJSON(w, r, ice.SanitiseServers(servers))
+		return
+	} else if r.Method != "PUT" && r.Method != "DELETE" {
+		methodNotAllowed(w, "HEAD, GET, PUT, DELETE")
+		return
+	}
+
+	conf, err := group.GetConfiguration()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if !conf.WritableGroups {
+		httpError(w, group.ErrConfigurationNotWritable)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		etag, err := ice.GetServersTag()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		done := checkPreconditions(w, r, etag)
+		if done {
+			return
+		}
+		err = ice.DeleteServers(etag)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	old, etag, err := ice.GetServers()
+	if errors.Is(err, os.ErrNotExist) {
+		etag = ""
+	} else if err != nil {
+		httpError(w, err)
+		return
+	}
+	done := checkPreconditions(w, r, etag)
+	if done {
+		return
+	}
+
+	var servers []ice.Server
+	done = getJSON(w, r, &servers)
+	if done {
+		return
+	}
+	servers = ice.KeepCredentials(old, servers)
+
+	err = ice.CheckServers(servers)
+	if err != nil {
+		httpError(w, group.UserError(err.Error()))
+		return
+	}
+	err = ice.UpdateServers(etag, servers)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if etag == "" {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
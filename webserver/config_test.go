@@ -0,0 +1,124 @@
+package webserver
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/ice"
+)
+
+func TestApiConfig(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ice.ICEFilename = filepath.Join(t.TempDir(), "ice-servers.json")
+	defer func() {
+		ice.ICEFilename = ""
+	}()
+
+	client := http.Client{}
+
+	do := func(method, path, ctype, body string) (int, string) {
+		req, err := http.NewRequest(method,
+			"http://localhost:1234/galene-api/v0"+path,
+			strings.NewReader(body),
+		)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if ctype != "" {
+			req.Header.Set("Content-Type", ctype)
+		}
+		req.SetBasicAuth("root", "pw")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%v %v: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	const patch = "application/merge-patch+json"
+
+	status, body := do("GET", "/.config", "", "")
+	if status != http.StatusOK || strings.Contains(body, "pw") {
+		t.Errorf("Get config: %v %v", status, body)
+	}
+
+	status, _ = do("PATCH", "/.config", patch,
+		`{"canonicalHost": "galene.example.org"}`)
+	if status != http.StatusNoContent {
+		t.Errorf("Patch config: %v", status)
+	}
+	conf, err := group.GetConfiguration()
+	if err != nil || conf.CanonicalHost != "galene.example.org" {
+		t.Errorf("Patched config: %v %v", err, conf)
+	}
+
+	status, _ = do("PATCH", "/.config", patch, `{"users": null}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Patch config (no admin): %v", status)
+	}
+
+	status, _ = do("GET", "/.ice-servers", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Get ICE servers: %v", status)
+	}
+
+	status, _ = do("PUT", "/.ice-servers", "application/json",
+		`[{"urls": ["turn:turn.example.org"], "credentialType": "bogus"}]`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Put bad ICE servers: %v", status)
+	}
+
+	status, _ = do("PUT", "/.ice-servers", "application/json",
+		`[{"urls": ["turn:turn.example.org"],
+                   "username": "galene", "credential": "secret"}]`)
+	if status != http.StatusCreated {
+		t.Errorf("Put ICE servers: %v", status)
+	}
+
+	status, body = do("GET", "/.ice-servers", "", "")
+	if status != http.StatusOK || strings.Contains(body, "secret") {
+		t.Errorf("Get ICE servers: %v %v", status, body)
+	}
+
+	status, _ = do("PATCH", "/.ice-servers", patch,
+		`[{"urls": ["stun:stun2.example.org"]}]`)
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("Patch ICE servers: %v", status)
+	}
+
+	// the credential is kept if omitted
+	status, _ = do("PUT", "/.ice-servers", "application/json",
+		`[{"urls": ["turn:turn.example.org"], "username": "galene"},
+                  {"urls": ["stun:stun2.example.org"]}]`)
+	if status != http.StatusNoContent {
+		t.Errorf("Put ICE servers: %v", status)
+	}
+	servers, _, err := ice.GetServers()
+	if err != nil || len(servers) != 2 ||
+		servers[0].Credential != "secret" {
+		t.Errorf("Put ICE servers: got %v %v", servers, err)
+	}
+
+	status, _ = do("DELETE", "/.ice-servers", "", "")
+	if status != http.StatusNoContent {
+		t.Errorf("Delete ICE servers: %v", status)
+	}
+
+	status, _ = do("PATCH", "/.config", patch, `{"writableGroups": null}`)
+	if status != http.StatusNoContent {
+		t.Errorf("Patch config: %v", status)
+	}
+	status, _ = do("PATCH", "/.config", patch, `{"writableGroups": true}`)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Patch non-writable config: %v", status)
+	}
+}
@@ -0,0 +1,78 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jech/galene/stats"
+)
+
+// the interval between two keepalives on an idle event stream
+var eventKeepalive = 30 * time.Second
+
+// eventsHandler streams statistics events as server-sent events.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if apiCORS(w, r, "GET") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	ch, unsubscribe := stats.Subscribe(r.URL.Query().Get("group"))
+	defer unsubscribe()
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	err := rc.Flush()
+	if err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// we didn't keep up, let the client reconnect
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %v\ndata: %s\n\n",
+				e.Type, data,
+			)
+			if err != nil {
+				return
+			}
+			// send all pending events in a single write
+			if len(ch) > 0 {
+				continue
+			}
+		case <-keepalive.C:
+			_, err := w.Write([]byte(":\n\n"))
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		err := rc.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package webserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/stats"
+)
+
+func TestApiEvents(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(group.Directory, "events.json"),
+		[]byte("{}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, err = group.Add("events", nil)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("events")
+
+	req, err := http.NewRequest("GET",
+		"http://localhost:1234/galene-api/v0/.events?group=events", nil,
+	)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.SetBasicAuth("root", "pw")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status: %v", resp.StatusCode)
+	}
+	ctype := resp.Header.Get("Content-Type")
+	if ctype != "text/event-stream" {
+		t.Errorf("Content-Type: %v", ctype)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "event: snapshot\n" {
+		t.Fatalf("Event: %#v %v", line, err)
+	}
+	line, err = reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("Data: %#v %v", line, err)
+	}
+	var e stats.Event
+	err = json.Unmarshal([]byte(line[len("data: "):]), &e)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(e.Groups) != 1 || e.Groups[0].Name != "events" {
+		t.Errorf("Snapshot: %v", e.Groups)
+	}
+}
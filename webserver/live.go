@@ -0,0 +1,249 @@
+package webserver
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/rtpconn"
+)
+
+// liveGroup returns the running group g.  If the group is not running,
+// it replies with an error and returns nil.
+func liveGroup(w http.ResponseWriter, g string) *group.Group {
+	gg := group.Get(g)
+	if gg == nil {
+		notFound(w)
+	}
+	return gg
+}
+
+// clientsHandler handles the clients of a running group.
+func clientsHandler(w http.ResponseWriter, r *http.Request, g, pth string) {
+	if pth == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	if pth == "/" {
+		if r.Method != "HEAD" && r.Method != "GET" {
+			methodNotAllowed(w, "HEAD, GET")
+			return
+		}
+		w.Header().Set("cache-control", "no-cache")
+		gg := group.Get(g)
+		if gg == nil {
+			// check that the group exists
+			_, err := group.GetDescription(g)
+			if err != nil {
+				httpError(w, err)
+				return
+			}
+			sendJSON(w, r, []rtpconn.ClientInfo{})
+			return
+		}
+		sendJSON(w, r, rtpconn.GetClientsInfo(gg))
+		return
+	}
+
+	first, kind, rest := splitPath(pth)
+	if first == "" || first == "/" {
+		notFound(w)
+		return
+	}
+	id := first[1:]
+	if kind == "" {
+		clientHandler(w, r, g, id)
+		return
+	} else if kind == ".permissions" && rest == "" {
+		clientPermissionsHandler(w, r, g, id)
+		return
+	}
+	notFound(w)
+}
+
+func clientHandler(w http.ResponseWriter, r *http.Request, g, id string) {
+	gg := liveGroup(w, g)
+	if gg == nil {
+		return
+	}
+
+	if r.Method == "HEAD" || r.Method == "GET" {
+		c := gg.GetClient(id)
+		if c == nil {
+			notFound(w)
+			return
+		}
+		w.Header().Set("cache-control", "no-cache")
+		sendJSON(w, r, rtpconn.GetClientInfo(c))
+		return
+	} else if r.Method == "DELETE" {
+		message := ""
+		if r.ContentLength != 0 {
+			body, done := getText(w, r)
+			if done {
+				return
+			}
+			message = string(body)
+		}
+		c := gg.GetClient(id)
+		if c == nil {
+			notFound(w)
+			return
+		}
+		err := c.Kick("", nil, message)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	methodNotAllowed(w, "HEAD, GET, DELETE")
+}
+
+func clientPermissionsHandler(w http.ResponseWriter, r *http.Request, g, id string) {
+	if r.Method != "PUT" {
+		methodNotAllowed(w, "PUT")
+		return
+	}
+	gg := liveGroup(w, g)
+	if gg == nil {
+		return
+	}
+	var perms group.Permissions
+	done := getJSON(w, r, &perms)
+	if done {
+		return
+	}
+	desc := gg.Description()
+	err := perms.Check(desc)
+	if err == nil {
+		err = rtpconn.SetClientPermissions(
+			gg, id, perms.Permissions(desc),
+		)
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lockHandler handles the lock of a running group.  The lock exists if
+// the group is locked, and its value is the lock message.
+func lockHandler(w http.ResponseWriter, r *http.Request, g string) {
+	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+	gg := liveGroup(w, g)
+	if gg == nil {
+		return
+	}
+
+	if r.Method == "HEAD" || r.Method == "GET" {
+		locked, message := gg.Locked()
+		if !locked {
+			notFound(w)
+			return
+		}
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		w.Header().Set("cache-control", "no-cache")
+		if r.Method == "HEAD" {
+			return
+		}
+		w.Write([]byte(message))
+		return
+	} else if r.Method == "PUT" {
+		message := ""
+		if r.ContentLength != 0 {
+			body, done := getText(w, r)
+			if done {
+				return
+			}
+			message = string(body)
+		}
+		gg.SetLocked(true, message)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method == "DELETE" {
+		gg.SetLocked(false, "")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	methodNotAllowed(w, "HEAD, GET, PUT, DELETE")
+}
+
+// wallopsHandler sends a warning to all the operators of a running group.
+func wallopsHandler(w http.ResponseWriter, r *http.Request, g string) {
+	if apiCORS(w, r, "POST") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	gg := liveGroup(w, g)
+	if gg == nil {
+		return
+	}
+	body, done := getText(w, r)
+	if done {
+		return
+	}
+	gg.WallOps(string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordingHandler handles the recording of a running group.  The
+// recording exists if the group is being recorded.
+func recordingHandler(w http.ResponseWriter, r *http.Request, g string) {
+	if apiCORS(w, r, "HEAD, GET, PUT, DELETE") {
+		return
+	}
+	if !checkAdmin(w, r) {
+		return
+	}
+	gg := liveGroup(w, g)
+	if gg == nil {
+		return
+	}
+
+	if r.Method == "HEAD" || r.Method == "GET" {
+		if !rtpconn.IsRecording(gg) {
+			notFound(w)
+			return
+		}
+		w.Header().Set("cache-control", "no-cache")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	} else if r.Method == "PUT" {
+		err := rtpconn.StartRecording(gg)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	} else if r.Method == "DELETE" {
+		if !rtpconn.StopRecording(gg) {
+			httpError(w, os.ErrNotExist)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	methodNotAllowed(w, "HEAD, GET, PUT, DELETE")
+}
@@ -0,0 +1,123 @@
+package webserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jech/galene/group"
+	"github.com/jech/galene/rtpconn"
+)
+
+func TestApiLive(t *testing.T) {
+	err := setupTest(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(group.Directory, "live.json"),
+		[]byte("{}\n"), 0o600)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, err = group.Add("live", nil)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer group.Delete("live")
+
+	client := http.Client{}
+
+	do := func(method, path, ctype, body string) (int, string) {
+		req, err := http.NewRequest(method,
+			"http://localhost:1234/galene-api/v0/.groups"+path,
+			strings.NewReader(body),
+		)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if ctype != "" {
+			req.Header.Set("Content-Type", ctype)
+		}
+		req.SetBasicAuth("root", "pw")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%v %v: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := do("GET", "/live/.clients/", "", "")
+	var clients []rtpconn.ClientInfo
+	err = json.Unmarshal([]byte(body), &clients)
+	if status != http.StatusOK || err != nil || len(clients) != 0 {
+		t.Errorf("Get clients: %v %v %v", status, err, body)
+	}
+
+	status, _ = do("GET", "/live/.clients/nosuchclient", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Get client: %v", status)
+	}
+	status, _ = do("DELETE", "/live/.clients/nosuchclient", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Kick client: %v", status)
+	}
+	status, _ = do("PUT", "/live/.clients/nosuchclient/.permissions",
+		"application/json", `"op"`)
+	if status != http.StatusNotFound {
+		t.Errorf("Set permissions: %v", status)
+	}
+
+	status, _ = do("GET", "/live/.lock", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Get unlocked: %v", status)
+	}
+	status, _ = do("PUT", "/live/.lock", "text/plain", "Closed")
+	if status != http.StatusNoContent {
+		t.Errorf("Lock: %v", status)
+	}
+	status, body = do("GET", "/live/.lock", "", "")
+	if status != http.StatusOK || body != "Closed" {
+		t.Errorf("Get locked: %v %v", status, body)
+	}
+	status, _ = do("DELETE", "/live/.lock", "", "")
+	if status != http.StatusNoContent {
+		t.Errorf("Unlock: %v", status)
+	}
+	if locked, _ := group.Get("live").Locked(); locked {
+		t.Errorf("Group is still locked")
+	}
+
+	status, _ = do("POST", "/live/.wallops", "text/plain", "Hello")
+	if status != http.StatusNoContent {
+		t.Errorf("Wallops: %v", status)
+	}
+	status, _ = do("POST", "/live/.wallops", "application/json", "{}")
+	if status != http.StatusUnsupportedMediaType {
+		t.Errorf("Wallops (bad content-type): %v", status)
+	}
+
+	status, _ = do("GET", "/live/.recording", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Get recording: %v", status)
+	}
+	status, _ = do("DELETE", "/live/.recording", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Stop recording: %v", status)
+	}
+
+	status, _ = do("PUT", "/notrunning/.lock", "text/plain", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Lock non-running group: %v", status)
+	}
+	status, _ = do("GET", "/notrunning/.clients/", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("Clients of non-existent group: %v", status)
+	}
+}
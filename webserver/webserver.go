@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -24,11 +25,16 @@ import (
 	"github.com/jech/cert"
 	"github.com/jech/galene/diskwriter"
 	"github.com/jech/galene/group"
+	"github.com/jech/galene/ice"
 	"github.com/jech/galene/rtpconn"
 )
 
 var server *http.Server
 
+// the web server's certificate, also used by the TURN server's TLS
+// listener, which might be started before the web server
+var certificate atomic.Pointer[cert.Certificate]
+
 var StaticRoot string
 
 var Insecure bool
@@ -52,15 +58,13 @@ func Serve(address string, dataDir string) error {
 		IdleTimeout:       120 * time.Second,
 	}
 	if !Insecure {
-		certificate := cert.New(
+		certificate.Store(cert.New(
 			filepath.Join(dataDir, "cert.pem"),
 			filepath.Join(dataDir, "key.pem"),
-		)
+		))
 		s.TLSConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				return certificate.Get()
-			},
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: GetCertificate,
 		}
 	}
 	s.RegisterOnShutdown(func() {
@@ -89,6 +93,16 @@ func Serve(address string, dataDir string) error {
 	return nil
 }
 
+// GetCertificate returns the certificate of the web server.  It may be
+// used by other TLS servers that share the web server's identity.
+func GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c := certificate.Load()
+	if c == nil {
+		return nil, errors.New("server is not running TLS")
+	}
+	return c.Get()
+}
+
 func cspHeader(w http.ResponseWriter, connect string) {
 	c := "connect-src ws: wss: 'self'; "
 	if connect != "" {
@@ -134,6 +148,17 @@ func httpError(w http.ResponseWriter, err error) {
 		http.Error(w, "unknown permission", http.StatusBadRequest)
 		return
 	}
+	if errors.Is(err, group.ErrTagMismatch) ||
+		errors.Is(err, ice.ErrTagMismatch) {
+		http.Error(w, "precondition failed",
+			http.StatusPreconditionFailed)
+		return
+	}
+	var usererr group.UserError
+	if errors.As(err, &usererr) {
+		http.Error(w, usererr.Error(), http.StatusBadRequest)
+		return
+	}
 	var autherr *group.NotAuthorisedError
 	if errors.As(err, &autherr) {
 		log.Printf("HTTP server error: %v", err)
@@ -75,15 +75,6 @@ func deobfuscate(id string) (string, error) {
 	return base64.RawURLEncoding.EncodeToString(v), nil
 }
 
-func canPresent(perms []string) bool {
-	for _, p := range perms {
-		if p == "present" {
-			return true
-		}
-	}
-	return false
-}
-
 func parseBearerToken(auth string) string {
 	auths := strings.Split(auth, ",")
 	for _, a := range auths {
@@ -228,7 +219,7 @@ func whipEndpointHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !canPresent(c.Permissions()) {
+	if !rtpconn.CanPresent(c.Permissions()) {
 		group.DelClient(c)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return